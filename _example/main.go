@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"time"
@@ -13,6 +14,9 @@ import (
 )
 
 func main() {
+	inMemory := flag.Bool("in-memory", false, "count the requests in memory, without Redis")
+	flag.Parse()
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 
@@ -28,7 +32,7 @@ func main() {
 		// in use (redis vs. local in-memory fallback).
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if rc.IsFallbackActivated() {
+				if *inMemory || rc.IsFallbackActivated() {
 					w.Header().Set("X-RateLimit-Backend", "in-memory")
 				} else {
 					w.Header().Set("X-RateLimit-Backend", "redis")
@@ -37,6 +41,13 @@ func main() {
 			})
 		})
 
+		// With -in-memory, the requests are counted by the in-memory counter,
+		// so the example runs without Redis.
+		var counter httprate.LimitCounter = rc
+		if *inMemory {
+			counter = httprateredis.NewInMemoryCounter(nil)
+		}
+
 		// Rate-limit at 50 req/s per IP address.
 		r.Use(httprate.Limit(
 			50, time.Second,
@@ -44,7 +55,7 @@ func main() {
 			httprateredis.WithRedisLimitCounter(&httprateredis.Config{
 				Host: "127.0.0.1", Port: 6379,
 			}),
-			httprate.WithLimitCounter(rc),
+			httprate.WithLimitCounter(counter),
 		))
 
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,82 @@
+package httprateredis
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultInFlightTTL is long enough for most requests, but short enough to
+// reclaim the slots of crashed holders before they're missed too much.
+const defaultInFlightTTL = time.Minute
+
+// acquireScript drops the expired slots of crashed holders and adds a new one,
+// if there are less than ARGV[3] slots. Each slot is a member scored by its
+// expiration time.
+var acquireScript = newScript("acquire", `
+local now = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ttl)
+return 1
+`)
+
+// Acquire takes one of MaxInFlight slots of the given rate-limit key, capping
+// the number of concurrent requests e.g. to an expensive downstream. If all
+// slots are taken, ok is false. Otherwise, release must be called once the
+// request is done; it's safe to call release multiple times. Slots not released
+// within InFlightTTL (e.g. of crashed holders) are reclaimed.
+//
+// Acquire is not served by the local in-memory fallback, Redis errors are
+// returned (or with OnErrorAllow, the slot is granted without Redis).
+func (c *redisCounter) Acquire(ctx context.Context, key string) (release func(), ok bool, err error) {
+	if !c.begin() {
+		return nil, false, errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return func() {}, true, nil
+	}
+	if c.maxInFlight <= 0 {
+		return nil, false, errNotConfigured
+	}
+
+	slotsKey := c.stateKey(key, "inflight")
+	slot := strconv.FormatUint(rand.Uint64(), 36)
+
+	var acquired int64
+	err = c.withRetry(ctx, false, func() (err error) {
+		acquired, err = c.runScriptOn(ctx, c.clientFor(key), acquireScript, []string{slotsKey},
+			c.now().UnixMilli(), c.inFlightTTL.Milliseconds(), c.maxInFlight, slot).Int64()
+		return err
+	})
+	if err != nil {
+		err = c.commandError(ctx, "redis acquire failed", err)
+		if c.onErrorAllow {
+			c.onError(err)
+			return func() {}, true, nil
+		}
+		return nil, false, err
+	}
+	if acquired != 1 {
+		return nil, false, nil
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.inFlightTTL)
+			defer cancel()
+			if err := c.clientFor(key).ZRem(ctx, slotsKey, slot).Err(); err != nil {
+				// The slot is reclaimed after InFlightTTL anyway.
+				c.onError(c.commandError(ctx, "redis release failed", err))
+			}
+		})
+	}, true, nil
+}
@@ -0,0 +1,116 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestAcquire(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithMaxInFlight(5, 10*time.Second),
+		httprateredis.WithClock(func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}),
+	)
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+
+	// The cap is enforced across concurrent acquirers.
+	var wg sync.WaitGroup
+	var acquired atomic.Int32
+	var inFlightMu sync.Mutex
+	var inFlight, maxInFlight int
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, ok, err := limitCounter.Acquire(ctx, "key:acquire")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !ok {
+				return
+			}
+			acquired.Add(1)
+			inFlightMu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			inFlightMu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			inFlightMu.Lock()
+			inFlight--
+			inFlightMu.Unlock()
+			release()
+			release() // Safe to call multiple times.
+		}()
+	}
+	wg.Wait()
+	if maxInFlight > 5 {
+		t.Errorf("unexpected max in-flight %v, expected at most 5", maxInFlight)
+	}
+	if acquired.Load() < 5 {
+		t.Errorf("unexpected number of acquired slots %v, expected at least 5", acquired.Load())
+	}
+
+	// All slots were released.
+	var releases []func()
+	for i := 0; i < 5; i++ {
+		release, ok, err := limitCounter.Acquire(ctx, "key:acquire")
+		if err != nil || !ok {
+			t.Fatalf("unexpected Acquire() = %v, %v, expected a free slot", ok, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, ok, err := limitCounter.Acquire(ctx, "key:acquire"); err != nil || ok {
+		t.Fatalf("unexpected Acquire() = %v, %v, expected all slots to be taken", ok, err)
+	}
+
+	// Leaked slots are reclaimed after the TTL.
+	mu.Lock()
+	now = now.Add(10*time.Second + time.Millisecond)
+	mu.Unlock()
+	release, ok, err := limitCounter.Acquire(ctx, "key:acquire")
+	if err != nil || !ok {
+		t.Fatalf("unexpected Acquire() = %v, %v, expected leaked slots to be reclaimed", ok, err)
+	}
+	release()
+
+	// Releasing a reclaimed slot doesn't free any other slot.
+	for _, release := range releases {
+		release()
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok, err := limitCounter.Acquire(ctx, "key:acquire"); err != nil || !ok {
+			t.Fatalf("unexpected Acquire() = %v, %v, expected a free slot", ok, err)
+		}
+	}
+	if _, ok, err := limitCounter.Acquire(ctx, "key:acquire"); err != nil || ok {
+		t.Fatalf("unexpected Acquire() = %v, %v, expected all slots to be taken", ok, err)
+	}
+}
@@ -0,0 +1,120 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// activeKeysBatchSize is the SCAN COUNT hint of ActiveKeys.
+const activeKeysBatchSize = 500
+
+var errActiveKeysUnsupported = errors.New("httprateredis: active keys require hash-tagged keys, see UseHashTags")
+
+// ActiveKeys returns the distinct rate-limit keys with a counter (or the state
+// of ModeSlidingLog and ModeTokenBucket) in Redis, e.g. to find a noisy client.
+// It's AllActiveKeys collected into a slice, see there.
+func (c *redisCounter) ActiveKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	for key, err := range c.AllActiveKeys(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// AllActiveKeys iterates over the distinct rate-limit keys with a counter in
+// Redis. The keys are found by incremental SCAN of "<prefix>:{*", never KEYS,
+// one batch at a time, so only the keys seen so far are kept in memory (to skip
+// the duplicates). In cluster mode and with ShardAddrs, all nodes are scanned
+// one after another. Cancelling ctx stops the iteration with its error.
+//
+// The rate-limit keys can be read back from the hash-tagged keys only, i.e.
+// in cluster mode, with ShardAddrs or UseHashTags, otherwise the iteration
+// yields an error. Keys longer than MaxKeyLength are yielded as their hash.
+func (c *redisCounter) AllActiveKeys(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		if !c.begin() {
+			yield("", errRefused)
+			return
+		}
+		defer c.end()
+		if !c.hashTags || c.keyFunc != nil {
+			yield("", errActiveKeysUnsupported)
+			return
+		}
+
+		clients, err := c.nodes(ctx)
+		if err != nil {
+			yield("", c.wrapError(ctx, "redis scan failed", err))
+			return
+		}
+
+		prefix := c.prefixKey + ":{"
+		match := escapeGlob(prefix) + "*"
+		seen := map[string]struct{}{}
+		for _, client := range clients {
+			var cursor uint64
+			for {
+				if err := ctx.Err(); err != nil {
+					yield("", err)
+					return
+				}
+				hkeys, next, err := client.Scan(ctx, cursor, match, activeKeysBatchSize).Result()
+				if err != nil {
+					yield("", c.wrapError(ctx, "redis scan failed", err))
+					return
+				}
+				for _, hkey := range hkeys {
+					end := strings.LastIndex(hkey, "}:")
+					if end < len(prefix) {
+						continue
+					}
+					key := hkey[len(prefix):end]
+					if _, ok := seen[key]; ok {
+						continue
+					}
+					seen[key] = struct{}{}
+					if !yield(key, nil) {
+						return
+					}
+				}
+				if next == 0 {
+					break
+				}
+				cursor = next
+			}
+		}
+	}
+}
+
+// nodes returns the clients of all Redis nodes holding the keys, i.e. the
+// masters in cluster mode and the shards of ShardAddrs.
+func (c *redisCounter) nodes(ctx context.Context) ([]redis.Cmdable, error) {
+	var (
+		mu      sync.Mutex
+		clients []redis.Cmdable
+	)
+	collect := func(ctx context.Context, client *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		clients = append(clients, client)
+		return nil
+	}
+	var err error
+	switch client := c.client.(type) {
+	case *redis.ClusterClient:
+		err = client.ForEachMaster(ctx, collect)
+	case *redis.Ring:
+		err = client.ForEachShard(ctx, collect)
+	default:
+		return []redis.Cmdable{c.client}, nil
+	}
+	return clients, err
+}
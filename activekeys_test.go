@@ -0,0 +1,97 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestActiveKeys(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		UseHashTags:      true,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// Counters of both windows are listed once, keys of other prefixes are not.
+	expected := []string{"10.0.0.1", "10.0.0.2", "user:43", "user:{42}"}
+	for _, key := range expected {
+		if err := limitCounter.IncrementBy(key, previousWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := limitCounter.IncrementBy(key, currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	redis.Set("httprate:admin:{10.0.0.3}:1", "1")
+	redis.Set("other", "1")
+
+	ctx := context.Background()
+	keys, err := limitCounter.ActiveKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, expected) {
+		t.Errorf("unexpected active keys %q, expected %q", keys, expected)
+	}
+
+	// Breaking out of the iteration stops the scan.
+	var n int
+	for _, err := range limitCounter.AllActiveKeys(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("unexpected %v keys iterated, expected 1", n)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := limitCounter.ActiveKeys(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v, expected context.Canceled", err)
+	}
+}
+
+func TestActiveKeysWithoutHashTags(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	// The keys are hashed, so they can't be listed.
+	if _, err := limitCounter.ActiveKeys(context.Background()); err == nil {
+		t.Error("expected error without hash-tagged keys")
+	}
+}
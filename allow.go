@@ -0,0 +1,177 @@
+package httprateredis
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// allowScript computes the sliding window rate of the current (KEYS[1]) and
+// previous (KEYS[2]) window counters, with the previous count weighted by
+// ARGV[3], and increments the current counter by ARGV[2] only if the rate stays
+// within the limit ARGV[1], atomically. It returns whether the counter was
+// incremented and the rate, including the increment if so.
+var allowScript = newScript("allow", `
+local curr = tonumber(redis.call('GET', KEYS[1])) or 0
+local prev = tonumber(redis.call('GET', KEYS[2])) or 0
+local n = tonumber(ARGV[2])
+local rate = math.floor(prev * tonumber(ARGV[3]) + curr + 0.5)
+if rate + n > tonumber(ARGV[1]) then
+	return {0, rate}
+end
+local count = redis.call('INCRBY', KEYS[1], n)
+if count == n or redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return {1, rate + n}
+`)
+
+// Allow reports whether one more request of the given rate-limit key is within
+// the limit, the same decision httprate makes, and counts the request if so.
+// It's meant for callers outside of the httprate middleware, e.g. gRPC
+// interceptors or background jobs. The decision is reported to OnDecision.
+//
+// Unlike the Get and IncrementBy calls of httprate, the rate is checked and
+// incremented atomically by a single Lua script, so concurrent requests never
+// overshoot the limit. That holds in ModeTokenBucket too, where Allow takes a
+// token, but not in ModeSlidingLog, with WindowBuckets or when served by the
+// local in-memory fallback, where the rate is read and incremented separately.
+func (c *redisCounter) Allow(ctx context.Context, key string) (allowed bool, err error) {
+	return c.AllowN(ctx, key, 1)
+}
+
+// AllowN is like Allow for a request costing n, e.g. a batch of n items. It's
+// allowed only if the rate plus n is within the limit, in which case the rate
+// is incremented by n. With tiers, see AddTier, it's AllowTiers.
+func (c *redisCounter) AllowN(ctx context.Context, key string, n int) (allowed bool, err error) {
+	if len(c.loadTiers()) > 0 {
+		allowed, _, err = c.AllowTiers(ctx, key, n)
+		return allowed, err
+	}
+	allowed, _, _, err = c.decide(ctx, key, n)
+	return allowed, err
+}
+
+// decide makes the decision of AllowN, also returning the rate (including n
+// if allowed) and the limit of the key.
+func (c *redisCounter) decide(ctx context.Context, key string, n int) (allowed bool, used, requestLimit int, err error) {
+	requestLimit, windowLength := c.limits(key)
+	if requestLimit <= 0 {
+		return false, 0, 0, errNotConfigured
+	}
+
+	switch {
+	case c.mode == ModeSlidingLog || c.windowBuckets > 2:
+		allowed, used, err = c.allowSeparately(ctx, key, n, requestLimit, windowLength)
+	case c.mode == ModeTokenBucket:
+		allowed, _, err = c.Take(ctx, key, n)
+		if err == nil {
+			used, err = c.Peek(ctx, key)
+		}
+	default:
+		allowed, used, err = c.allow(ctx, key, n, requestLimit, windowLength)
+	}
+	if err != nil {
+		return false, 0, requestLimit, err
+	}
+	c.onDecision(key, allowed, used, requestLimit)
+	return allowed, used, requestLimit, nil
+}
+
+func (c *redisCounter) allow(ctx context.Context, key string, n, requestLimit int, windowLength time.Duration) (allowed bool, used int, err error) {
+	c.stats.increments.Add(1)
+	if !c.begin() {
+		return false, 0, errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return true, 0, nil
+	}
+
+	now := c.now().UTC()
+	currentWindow, previousWindow, err := c.windows(now, windowLength)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var fallback bool
+	ctx, span := c.startSpan(ctx, spanIncrement, currentWindow)
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.allowFallback(key, n, requestLimit, now, windowLength)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				allowed, used, err = c.allowFallback(key, n, requestLimit, now, windowLength)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				allowed, used, err = true, 0, nil
+			}
+		}()
+	}
+
+	weight := float64(windowLength-now.Sub(currentWindow)) / float64(windowLength)
+	keys := []string{c.limitCounterKey(key, currentWindow), c.limitCounterKey(key, previousWindow)}
+
+	var res []interface{}
+	err = c.withRetry(ctx, false, func() (err error) {
+		res, err = c.runScriptOn(ctx, c.clientFor(key), allowScript, keys, requestLimit, n,
+			strconv.FormatFloat(weight, 'f', -1, 64), c.ttl(windowLength).Milliseconds()).Slice()
+		return err
+	})
+	if err != nil {
+		return false, 0, c.commandError(ctx, "redis allow failed", err)
+	}
+	ok, _ := res[0].(int64)
+	rate, _ := res[1].(int64)
+	return ok == 1, int(rate), nil
+}
+
+// allowFallback makes the decision of AllowN by the local in-memory fallback.
+func (c *redisCounter) allowFallback(key string, n, requestLimit int, now time.Time, windowLength time.Duration) (bool, int, error) {
+	currentWindow, previousWindow, err := c.windows(now, windowLength)
+	if err != nil {
+		return false, 0, err
+	}
+	curr, prev, err := c.fallbackGet(key, currentWindow, previousWindow)
+	if err != nil {
+		return false, 0, err
+	}
+	used := RateInt(prev, curr, currentWindow, now, windowLength)
+	if used+n > requestLimit {
+		return false, used, nil
+	}
+	if err := c.fallbackIncrementBy(key, currentWindow, n); err != nil {
+		return false, 0, err
+	}
+	return true, used + n, nil
+}
+
+// allowSeparately makes the decision of AllowN by reading the rate and then
+// incrementing it, for the modes without the atomic script.
+func (c *redisCounter) allowSeparately(ctx context.Context, key string, n, requestLimit int, windowLength time.Duration) (bool, int, error) {
+	currentWindow, _, err := c.windows(c.now(), windowLength)
+	if err != nil {
+		return false, 0, err
+	}
+	used, err := c.rate(ctx, key, windowLength)
+	if err != nil {
+		return false, 0, err
+	}
+	if used+n > requestLimit {
+		return false, used, nil
+	}
+	if err := c.IncrementByCtx(ctx, key, currentWindow, n); err != nil {
+		return false, 0, err
+	}
+	return true, used + n, nil
+}
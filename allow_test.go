@@ -0,0 +1,164 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestAllow(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	type decision struct {
+		key     string
+		allowed bool
+		used    int
+		limit   int
+	}
+	var decisions []decision
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+		OnDecision: func(key string, allowed bool, used, limit int) {
+			decisions = append(decisions, decision{key, allowed, used, limit})
+		},
+	})
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	if _, err := limitCounter.Allow(ctx, "key:allow"); err == nil {
+		t.Error("expected error when the limit is not configured")
+	}
+	limitCounter.Config(3, time.Hour)
+
+	expected := []decision{
+		{"key:allow", true, 1, 3},
+		{"key:allow", true, 2, 3},
+		{"key:allow", true, 3, 3},
+		{"key:allow", false, 3, 3},
+		{"key:allow", false, 3, 3},
+	}
+	for i, want := range expected {
+		allowed, err := limitCounter.Allow(ctx, "key:allow")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != want.allowed {
+			t.Errorf("request %v: unexpected allowed = %v, expected %v", i+1, allowed, want.allowed)
+		}
+	}
+	if len(decisions) != len(expected) {
+		t.Fatalf("unexpected %v decisions, expected %v", len(decisions), len(expected))
+	}
+	for i, d := range decisions {
+		if d != expected[i] {
+			t.Errorf("request %v: unexpected decision %+v, expected %+v", i+1, d, expected[i])
+		}
+	}
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var denied atomic.Int64
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		MaxActive:        50,
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+		OnDecision: func(key string, allowed bool, used, limit int) {
+			if !allowed {
+				denied.Add(1)
+			}
+		},
+	})
+	defer limitCounter.Close()
+
+	const limit = 20
+	limitCounter.Config(limit, time.Hour)
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := limitCounter.Allow(context.Background(), "key:concurrent")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != limit {
+		t.Errorf("unexpected %v allowed requests, expected exactly %v", allowed.Load(), limit)
+	}
+	if denied.Load() != 100-limit {
+		t.Errorf("unexpected %v denied decisions, expected %v", denied.Load(), 100-limit)
+	}
+	currentWindow := time.Now().UTC().Truncate(time.Hour)
+	curr, _, err := limitCounter.Get("key:concurrent", currentWindow, currentWindow.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != limit {
+		t.Errorf("unexpected curr = %v, expected %v", curr, limit)
+	}
+}
+
+func TestAllowN(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(10, time.Hour)
+
+	ctx := context.Background()
+	for i, tt := range []struct {
+		n       int
+		allowed bool
+	}{{4, true}, {4, true}, {4, false}, {2, true}, {1, false}} {
+		allowed, err := limitCounter.AllowN(ctx, "key:allow-n", tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != tt.allowed {
+			t.Errorf("request %v: unexpected AllowN(%v) = %v, expected %v", i+1, tt.n, allowed, tt.allowed)
+		}
+	}
+}
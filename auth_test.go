@@ -0,0 +1,252 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestAuth(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	redis.RequireAuth("secret")
+	redis.RequireUserAuth("ratelimiter", "s3cr3t")
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{name: "password only", password: "secret"},
+		{name: "acl user", username: "ratelimiter", password: "s3cr3t"},
+		{name: "no credentials", err: httprateredis.ErrAuthFailed},
+		{name: "wrong password", password: "wrong", err: httprateredis.ErrAuthFailed},
+		{name: "wrong acl user", username: "nobody", password: "s3cr3t", err: httprateredis.ErrAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				Username:         tt.username,
+				Password:         tt.password,
+				FallbackTimeout:  time.Second,
+				FallbackDisabled: true,
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("unexpected error %v, expected %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+			if err := limitCounter.Increment("key:auth", time.Now().UTC().Truncate(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNoAuthReauth(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	redis.RequireUserAuth("ratelimiter", "s3cr3t")
+
+	// The connections lose their authentication, e.g. by a Redis failover,
+	// and reply NOAUTH until they authenticate again. The commands of the Lua
+	// scripts run by peers which never authenticate.
+	var mu sync.Mutex
+	var lost bool
+	conns, authed := map[*server.Peer]bool{}, map[*server.Peer]bool{}
+	auths := 0
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		switch cmd {
+		case "AUTH", "HELLO":
+			conns[c], authed[c] = true, true
+			auths++
+		default:
+			if lost && conns[c] && !authed[c] {
+				c.WriteError("NOAUTH Authentication required.")
+				return true
+			}
+		}
+		return false
+	})
+	loseAuth := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		lost = true
+		clear(authed)
+		auths = 0
+	}
+
+	var onErrorErr error
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		Username:         "ratelimiter",
+		Password:         "s3cr3t",
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+		OnError:          func(err error) { onErrorErr = err },
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.Increment("key:noauth", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command is retried once after AUTH, and counted once.
+	loseAuth()
+	if err := limitCounter.Increment("key:noauth", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limitCounter.GetMany(context.Background(), []string{"key:noauth"}, currentWindow, previousWindow); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, err := limitCounter.Get("key:noauth", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 {
+		t.Errorf("unexpected curr = %v, expected 2", curr)
+	}
+	mu.Lock()
+	if auths == 0 {
+		t.Error("expected the connection to re-authenticate")
+	}
+	mu.Unlock()
+	if onErrorErr != nil {
+		t.Errorf("unexpected error %v", onErrorErr)
+	}
+
+	// The credentials are no longer valid.
+	redis.RequireUserAuth("ratelimiter", "rotated")
+	loseAuth()
+	if err := limitCounter.Increment("key:noauth", currentWindow); !errors.Is(err, httprateredis.ErrAuthFailed) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrAuthFailed)
+	}
+}
+
+func TestPasswordFunc(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	redis.RequireUserAuth("ratelimiter", "token-1")
+
+	var (
+		mu       sync.Mutex
+		token    = "token-1"
+		tokenErr error
+		auths    []string
+	)
+	recordAuth := func(c *server.Peer, cmd string, args ...string) bool {
+		// go-redis authenticates by HELLO, falling back to AUTH.
+		for i, arg := range args {
+			if cmd == "HELLO" && strings.EqualFold(arg, "AUTH") && i+2 < len(args) {
+				args = args[i+1 : i+3]
+				cmd = "AUTH"
+				break
+			}
+		}
+		if cmd == "AUTH" {
+			mu.Lock()
+			auths = append(auths, args[len(args)-1])
+			mu.Unlock()
+		}
+		return false
+	}
+	redis.Server().SetPreHook(recordAuth)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:     redis.Host(),
+		Port:     uint16(redisPort),
+		Username: "ratelimiter",
+		PasswordFunc: func() (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return token, tokenErr
+		},
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	if err := limitCounter.Increment("key:token", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token rotates. The open connections stay authenticated, the new ones
+	// authenticate with the new token.
+	mu.Lock()
+	token = "token-2"
+	mu.Unlock()
+	redis.RequireUserAuth("ratelimiter", "token-2")
+	if err := limitCounter.Increment("key:token", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	redis.Close() // drops the connections
+	if err := redis.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	redis.Server().SetPreHook(recordAuth)
+	if err := limitCounter.Increment("key:token", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if expected := []string{"token-1", "token-2"}; !slices.Equal(auths, expected) {
+		t.Errorf("unexpected AUTH passwords %q, expected %q", auths, expected)
+	}
+	mu.Unlock()
+
+	// A failure to fetch the token fails the dial of the new connections.
+	mu.Lock()
+	tokenErr = errors.New("token service unavailable")
+	mu.Unlock()
+	redis.Close()
+	if err := redis.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.Increment("key:token", currentWindow); !errors.Is(err, httprateredis.ErrAuthFailed) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrAuthFailed)
+	}
+}
@@ -0,0 +1,96 @@
+package httprateredis
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type breakerState int32
+
+const (
+	// Redis is healthy, all commands go to Redis.
+	breakerClosed breakerState = iota
+	// Redis is down, all commands go to the local in-memory fallback.
+	breakerOpen
+	// Redis is being probed, all commands still go to the local in-memory fallback.
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// breaker is a circuit breaker guarding Redis. It opens after failureThreshold
+// consecutive failures, then every cooldownPeriod it half-opens and probes Redis
+// from a single goroutine. It closes after halfOpenProbes successful probes in
+// a row, or re-opens on the first failed probe.
+type breaker struct {
+	state            atomic.Int32
+	failures         atomic.Int32
+	failureThreshold int32
+	cooldownPeriod   time.Duration
+	halfOpenProbes   int
+}
+
+func (b *breaker) isOpen() bool {
+	return breakerState(b.state.Load()) != breakerClosed
+}
+
+// success resets the consecutive failure count.
+func (b *breaker) success() {
+	// Avoid writing to the shared counter on every successful command.
+	if b.failures.Load() != 0 {
+		b.failures.Store(0)
+	}
+}
+
+// failure records a failed command and reports whether it opened the breaker.
+// Only one of the concurrently failing goroutines gets true.
+func (b *breaker) failure() bool {
+	if b.failures.Add(1) < b.failureThreshold {
+		return false
+	}
+	return b.state.CompareAndSwap(int32(breakerClosed), int32(breakerOpen))
+}
+
+// closeWhenHealthy blocks until probe succeeds halfOpenProbes times in a row, then
+// closes the breaker and returns true. It returns false once done is closed. It's
+// supposed to run in its own goroutine once failure reports the breaker was opened.
+func (b *breaker) closeWhenHealthy(done <-chan struct{}, probe func() error) bool {
+	timer := time.NewTimer(b.cooldownPeriod)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-done:
+			return false
+		}
+
+		b.state.Store(int32(breakerHalfOpen))
+		if b.probe(probe) {
+			b.failures.Store(0)
+			b.state.Store(int32(breakerClosed))
+			return true
+		}
+		b.state.Store(int32(breakerOpen))
+		timer.Reset(b.cooldownPeriod)
+	}
+}
+
+func (b *breaker) probe(probe func() error) bool {
+	for i := 0; i < b.halfOpenProbes; i++ {
+		if err := probe(); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package httprateredis_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  200 * time.Millisecond,
+		FailureThreshold: 3,
+		CooldownPeriod:   50 * time.Millisecond,
+		HalfOpenProbes:   2,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	if state := limitCounter.BreakerState(); state != "closed" {
+		t.Fatalf("unexpected state %q, expected closed", state)
+	}
+
+	redis.Close()
+
+	// Failures below the threshold are served by the local counter,
+	// but the breaker stays closed.
+	for i := 0; i < 2; i++ {
+		if err := limitCounter.Increment("key:breaker", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+		if limitCounter.IsFallbackActivated() {
+			t.Fatalf("failure %d: fallback should not be activated below the failure threshold", i+1)
+		}
+	}
+
+	if err := limitCounter.Increment("key:breaker", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	if state := limitCounter.BreakerState(); state != "open" {
+		t.Fatalf("unexpected state %q, expected open", state)
+	}
+
+	// The breaker stays open while Redis is down.
+	time.Sleep(200 * time.Millisecond)
+	if !limitCounter.IsFallbackActivated() {
+		t.Fatal("fallback should stay activated while redis is down")
+	}
+
+	if err := redis.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitForBreakerState(t, limitCounter, "closed", 2*time.Second)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	// Unresponsive Redis keeps the probes hanging until the read timeout,
+	// so the half-open state can be observed.
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            host,
+		Port:            port,
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  50 * time.Millisecond,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	if err := limitCounter.Increment("key:breaker", time.Now().UTC().Truncate(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if state := limitCounter.BreakerState(); state != "open" {
+		t.Fatalf("unexpected state %q, expected open", state)
+	}
+
+	waitForBreakerState(t, limitCounter, "half-open", time.Second)
+	waitForBreakerState(t, limitCounter, "open", time.Second)
+}
+
+func waitForBreakerState(t *testing.T, limitCounter interface{ BreakerState() string }, state string, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for limitCounter.BreakerState() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("breaker didn't transition to %q within %v, state %q", state, timeout, limitCounter.BreakerState())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Test that while the breaker is half-open, only the probes reach a recovering
+// Redis, while the concurrent requests keep being served by the local counter.
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var (
+		mu        sync.Mutex
+		failing   = true
+		recovered []string // commands received after the recovery
+	)
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			c.WriteError("LOADING Redis is loading the dataset in memory")
+			return true
+		}
+		recovered = append(recovered, strings.ToUpper(cmd))
+		return false
+	})
+
+	const probes = 3
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  10 * time.Millisecond,
+		HalfOpenProbes:  probes,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	if err := limitCounter.Increment("key:probes", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	if !limitCounter.IsFallbackActivated() {
+		t.Fatal("fallback should be activated")
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := limitCounter.Increment("key:probes", currentWindow); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond) // Let a few probe rounds fail.
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	waitForBreakerState(t, limitCounter, "closed", 2*time.Second)
+	close(done)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var pings int
+	for _, cmd := range recovered {
+		if cmd == "PING" {
+			pings++
+			continue
+		}
+		if cmd == "EVALSHA" || cmd == "EVAL" {
+			break
+		}
+	}
+	if pings != probes {
+		t.Errorf("unexpected %v PINGs before the breaker closed, expected %v probes: %v", pings, probes, recovered[:min(len(recovered), 10)])
+	}
+}
+
+func TestCircuitBreakerForcedFailures(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FailureThreshold: 3,
+		CooldownPeriod:   20 * time.Millisecond,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+	failures := limitCounter.InjectFailures()
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	errReset := errors.New("connection reset by peer")
+
+	// The failures below the threshold don't open the breaker, and a success
+	// resets their count.
+	for i := 0; i < 2; i++ {
+		failures.FailNext(2, errReset)
+		for j := 0; j < 3; j++ {
+			if err := limitCounter.Increment("key:breaker", currentWindow); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if state := limitCounter.BreakerState(); state != "closed" {
+			t.Fatalf("unexpected state %q, expected closed", state)
+		}
+	}
+
+	failures.FailNext(3, errReset)
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.Increment("key:breaker", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state := limitCounter.BreakerState(); state != "open" {
+		t.Fatalf("unexpected state %q, expected open", state)
+	}
+
+	// The failed probes keep it open, until one succeeds.
+	failures.FailNext(2, errReset)
+	waitForBreakerState(t, limitCounter, "closed", 2*time.Second)
+	if n := failures.Remaining(); n != 0 {
+		t.Errorf("the breaker closed with %v forced failures left, expected the probes to fail", n)
+	}
+	if n := limitCounter.Stats().FallbackActivations; n != 1 {
+		t.Errorf("unexpected %v fallback activations, expected 1", n)
+	}
+}
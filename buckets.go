@@ -0,0 +1,67 @@
+package httprateredis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// bucketLength returns the length of the buckets of WindowBuckets, or 0 if the
+// two-window approximation of httprate is used.
+func (c *redisCounter) bucketLength(windowLength time.Duration) time.Duration {
+	if c.windowBuckets <= 2 {
+		return 0
+	}
+	return windowLength / time.Duration(c.windowBuckets)
+}
+
+// incrementKey returns the Redis key of the window counter incremented by
+// IncrementBy, which is the counter of the current bucket with WindowBuckets.
+func (c *redisCounter) incrementKey(key string, currentWindow time.Time, windowLength time.Duration) string {
+	if bucketLength := c.bucketLength(windowLength); bucketLength > 0 {
+		return c.limitCounterKey(key, c.now().UTC().Truncate(bucketLength))
+	}
+	return c.limitCounterKey(key, currentWindow)
+}
+
+// bucketKeys returns the Redis keys of the bucket counters covering the window
+// ending now, from the current bucket back to the oldest one, which overlaps the
+// window only partially, and the weight of the oldest bucket.
+func (c *redisCounter) bucketKeys(key string, now time.Time, bucketLength time.Duration) (keys []string, weight float64) {
+	currentBucket := now.UTC().Truncate(bucketLength)
+	keys = make([]string, c.windowBuckets+1)
+	for i := range keys {
+		keys[i] = c.limitCounterKey(key, currentBucket.Add(-time.Duration(i)*bucketLength))
+	}
+	weight = 1 - float64(now.Sub(currentBucket))/float64(bucketLength)
+	return keys, weight
+}
+
+// getBuckets returns the rate of the bucket counters as the current window count
+// and zero previous window count, so httprate's weighted rate equals it.
+func (c *redisCounter) getBuckets(ctx context.Context, key string, bucketLength time.Duration) (curr int, prev int, err error) {
+	keys, weight := c.bucketKeys(key, c.now(), bucketLength)
+
+	var values []interface{}
+	err = c.withRetry(ctx, true, func() error {
+		return c.readKey(ctx, key, func(client redis.Cmdable) (err error) {
+			values, err = client.MGet(ctx, keys...).Result()
+			return err
+		})
+	})
+	if err != nil {
+		return 0, 0, c.commandError(ctx, "redis mget failed", err)
+	} else if len(values) != len(keys) {
+		return 0, 0, fmt.Errorf("httprateredis: redis mget returned wrong number of keys: %v, expected %v", len(values), len(keys))
+	}
+
+	last := len(values) - 1
+	rate := float64(parseCount(values[last])) * weight
+	for _, value := range values[:last] {
+		rate += float64(parseCount(value))
+	}
+	return int(math.Round(rate)), 0, nil
+}
@@ -0,0 +1,78 @@
+package httprateredis_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestWindowBuckets(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	const windowLength = time.Minute
+	previousWindow := time.Now().UTC().Truncate(windowLength).Add(-windowLength)
+	currentWindow := previousWindow.Add(windowLength)
+
+	// A burst at the end of the previous window, read in the middle of the
+	// current one: the burst is still within the last window length.
+	const burst = 60
+	tests := []struct {
+		buckets  int
+		expected int
+	}{
+		{2, burst / 2}, // The two-window approximation weights the burst by half.
+		{6, burst},
+	}
+	for _, tt := range tests {
+		now := previousWindow.Add(55 * time.Second)
+		limitCounter := httprateredis.NewCounterWithOptions(
+			httprateredis.WithHost(redis.Host()),
+			httprateredis.WithPort(uint16(redisPort)),
+			httprateredis.WithPrefix("httprate:"+strconv.Itoa(tt.buckets)),
+			httprateredis.WithFallbackDisabled(),
+			httprateredis.WithClock(func() time.Time { return now }),
+			func(cfg *httprateredis.Config) { cfg.WindowBuckets = tt.buckets },
+		)
+		defer limitCounter.Close()
+		limitCounter.Config(1000, windowLength)
+
+		if err := limitCounter.IncrementBy("key:buckets", previousWindow, burst); err != nil {
+			t.Fatal(err)
+		}
+
+		now = currentWindow.Add(30 * time.Second)
+		curr, prev, err := limitCounter.Get("key:buckets", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rate := float64(prev)*0.5 + float64(curr)
+		if int(rate) != tt.expected {
+			t.Errorf("%v buckets: unexpected rate %v, expected %v", tt.buckets, rate, tt.expected)
+		}
+
+		// The burst leaves the window once its bucket gets older than the window length.
+		now = currentWindow.Add(windowLength - 1)
+		curr, _, err = limitCounter.Get("key:buckets", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.buckets == 6 && curr != 0 {
+			t.Errorf("%v buckets: unexpected curr = %v, expected 0", tt.buckets, curr)
+		}
+	}
+
+	// Each bucket counter outlives the window.
+	for _, key := range redis.Keys() {
+		if ttl := redis.TTL(key); ttl < 2*windowLength {
+			t.Errorf("unexpected TTL %v of %v, expected at least %v", ttl, key, 2*windowLength)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Result is the current and previous window counts of a rate-limit key.
+type Result struct {
+	Key  string
+	Curr int
+	Prev int
+}
+
+// GetMany is like Get for multiple rate-limit keys at once, e.g. per-IP,
+// per-user and per-route limits of the same request, in a single MGET
+// round-trip. The results are in the order of keys, missing counters are 0.
+//
+// In cluster mode, the counters of different keys live on different slots,
+// so GetMany pipelines a MGET per key instead, still in a single round-trip
+// per Redis node.
+func (c *redisCounter) GetMany(ctx context.Context, keys []string, currentWindow, previousWindow time.Time) (results []Result, err error) {
+	if !c.plainSlidingWindow() {
+		return c.getManyByOne(ctx, keys, currentWindow, previousWindow)
+	}
+
+	c.stats.gets.Add(int64(len(keys)))
+	if !c.begin() {
+		return nil, errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		results = make([]Result, len(keys))
+		for i, key := range keys {
+			results[i].Key = key
+		}
+		return results, nil
+	}
+
+	var fallback bool
+	ctx, span := c.startSpan(ctx, spanGet, currentWindow)
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.getManyFallback(keys, currentWindow, previousWindow)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				results, err = c.getManyFallback(keys, currentWindow, previousWindow)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				results, err = make([]Result, len(keys)), nil
+				for i, key := range keys {
+					results[i].Key = key
+				}
+			}
+		}()
+	}
+
+	hkeys := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		currentWindow, previousWindow := c.windowsOf(key, currentWindow, previousWindow)
+		hkeys = append(hkeys, c.limitCounterKey(key, currentWindow), c.limitCounterKey(key, previousWindow))
+	}
+
+	values := make([]interface{}, len(hkeys))
+	for _, group := range c.groupByDB(keys) {
+		err = c.withRetry(ctx, true, func() error {
+			return c.readKey(ctx, keys[group[0]], func(client redis.Cmdable) error {
+				return c.mgetGroup(ctx, client, hkeys, group, values)
+			})
+		})
+		if err != nil {
+			return nil, c.commandError(ctx, "redis mget failed", err)
+		}
+	}
+
+	results = make([]Result, len(keys))
+	for i, key := range keys {
+		results[i] = Result{Key: key, Curr: parseCount(values[2*i]), Prev: parseCount(values[2*i+1])}
+	}
+	return results, nil
+}
+
+func (c *redisCounter) getManyFallback(keys []string, currentWindow, previousWindow time.Time) ([]Result, error) {
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		curr, prev, err := c.fallbackGet(key, currentWindow, previousWindow)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = Result{Key: key, Curr: curr, Prev: prev}
+	}
+	return results, nil
+}
+
+// getManyByOne gets the keys one by one, for the modes not backed by window counters.
+func (c *redisCounter) getManyByOne(ctx context.Context, keys []string, currentWindow, previousWindow time.Time) ([]Result, error) {
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		curr, prev, err := c.GetCtx(ctx, key, currentWindow, previousWindow)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = Result{Key: key, Curr: curr, Prev: prev}
+	}
+	return results, nil
+}
+
+// IncrementManyBy is like IncrementBy for multiple rate-limit keys at once,
+// e.g. when a request counts against several limits, pipelined in a single
+// round-trip. It's not atomic: the errors of the keys which failed are joined
+// and returned, while the other keys are incremented. With the local in-memory
+// fallback, the failed keys are incremented by the fallback instead.
+func (c *redisCounter) IncrementManyBy(ctx context.Context, keys []string, currentWindow time.Time, amount int) (err error) {
+	if c.mode != "" && c.mode != ModeSlidingWindow {
+		var errs []error
+		for _, key := range keys {
+			errs = append(errs, c.IncrementByCtx(ctx, key, currentWindow, amount))
+		}
+		return errors.Join(errs...)
+	}
+
+	c.stats.increments.Add(int64(len(keys)))
+	if !c.begin() {
+		return errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return nil
+	}
+
+	var fallback bool
+	ctx, span := c.startSpan(ctx, spanIncrement, currentWindow)
+	defer func() { endSpan(span, fallback, err) }()
+
+	failed := keys
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.incrementManyFallback(keys, currentWindow, amount)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				err = c.incrementManyFallback(failed, currentWindow, amount)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				err = nil
+			}
+		}()
+	}
+
+	hkeys := make([]string, len(keys))
+	ttls := make(map[string]int64, len(keys))
+	for i, key := range keys {
+		_, windowLength := c.limits(key)
+		currentWindow, _ := c.windowsOf(key, currentWindow, currentWindow)
+		hkeys[i] = c.incrementKey(key, currentWindow, windowLength)
+		ttls[key] = c.ttl(windowLength).Milliseconds()
+	}
+
+	cmds := make([]*redis.Cmd, len(keys))
+	var errs []error
+	for _, group := range c.groupByDB(keys) {
+		client := c.clientFor(keys[group[0]])
+		err := c.withRetry(ctx, false, func() error {
+			return c.incrementGroup(ctx, client, hkeys, ttls, keys, group, amount, cmds)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err = errors.Join(errs...)
+
+	if err == nil {
+		return nil
+	}
+
+	// The pipeline error is the first failed command error.
+	failed, errs = nil, nil
+	for i, cmd := range cmds {
+		if cmd.Err() != nil {
+			failed = append(failed, keys[i])
+			errs = append(errs, fmt.Errorf("key %q: %w", keys[i], cmd.Err()))
+		}
+	}
+	if len(errs) == 0 {
+		failed, errs = keys, []error{err}
+	}
+	return c.commandError(ctx, "redis incr failed", errors.Join(errs...))
+}
+
+func (c *redisCounter) incrementManyFallback(keys []string, currentWindow time.Time, amount int) error {
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, c.fallbackIncrementBy(key, currentWindow, amount))
+	}
+	return errors.Join(errs...)
+}
+
+// groupByDB returns the indexes of keys grouped by the database of DBForKey,
+// in the order of their first key. Without DBForKey, it's a single group.
+func (c *redisCounter) groupByDB(keys []string) [][]int {
+	if c.dbForKey == nil || c.dbs.newClient == nil {
+		group := make([]int, len(keys))
+		for i := range keys {
+			group[i] = i
+		}
+		return [][]int{group}
+	}
+	var groups [][]int
+	index := map[redis.UniversalClient]int{}
+	for i, key := range keys {
+		client := c.clientFor(key)
+		g, ok := index[client]
+		if !ok {
+			g = len(groups)
+			index[client] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// mgetGroup reads the window counters of the keys of group, two per key in
+// hkeys, into values by MGET, or by a MGET per key with hash tags.
+func (c *redisCounter) mgetGroup(ctx context.Context, client redis.Cmdable, hkeys []string, group []int, values []interface{}) error {
+	groupKeys := make([]string, 0, 2*len(group))
+	for _, i := range group {
+		groupKeys = append(groupKeys, hkeys[2*i], hkeys[2*i+1])
+	}
+	groupValues := make([]interface{}, 0, len(groupKeys))
+	if !c.hashTags {
+		var err error
+		if groupValues, err = client.MGet(ctx, groupKeys...).Result(); err != nil {
+			return err
+		}
+	} else {
+		cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i := 0; i < len(groupKeys); i += 2 {
+				pipe.MGet(ctx, groupKeys[i], groupKeys[i+1])
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			groupValues = append(groupValues, cmd.(*redis.SliceCmd).Val()...)
+		}
+	}
+	if len(groupValues) != len(groupKeys) {
+		return fmt.Errorf("httprateredis: redis mget returned wrong number of keys: %v, expected %v", len(groupValues), len(groupKeys))
+	}
+	for j, i := range group {
+		values[2*i], values[2*i+1] = groupValues[2*j], groupValues[2*j+1]
+	}
+	return nil
+}
+
+// incrementGroup increments the window counters of the keys of group by the
+// increment script, pipelined on client, into cmds.
+func (c *redisCounter) incrementGroup(ctx context.Context, client redis.UniversalClient, hkeys []string, ttls map[string]int64, keys []string, group []int, amount int, cmds []*redis.Cmd) error {
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, i := range group {
+			key := keys[i]
+			if c.useFunctions {
+				cmds[i] = pipe.FCall(ctx, functionName(incrementScript), []string{hkeys[i]}, amount, ttls[key])
+			} else {
+				cmds[i] = incrementScript.EvalSha(ctx, pipe, []string{hkeys[i]}, amount, ttls[key])
+			}
+		}
+		return nil
+	})
+	missing := func(err error) bool {
+		if c.useFunctions {
+			return isFunctionNotFound(err)
+		}
+		return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+	}
+	if !missing(err) {
+		return err
+	}
+
+	// Not cached on the Redis server (or some of the cluster nodes) yet.
+	loaded := true
+	if c.useFunctions {
+		c.logger.Debugf("httprateredis: function %s not loaded, loading", functionName(incrementScript))
+		if err := c.loadFunctions(ctx); err != nil {
+			return err
+		}
+	} else {
+		c.logger.Debugf("httprateredis: script %s not loaded, reloading", incrementScript.Hash())
+		loaded = c.loadScript(ctx, incrementScript) == nil
+	}
+	_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, i := range group {
+			key := keys[i]
+			if !missing(cmds[i].Err()) {
+				continue
+			}
+			if c.useFunctions {
+				cmds[i] = pipe.FCall(ctx, functionName(incrementScript), []string{hkeys[i]}, amount, ttls[key])
+			} else if loaded {
+				cmds[i] = incrementScript.EvalSha(ctx, pipe, []string{hkeys[i]}, amount, ttls[key])
+			} else {
+				// Let EVAL cache the script, e.g. if SCRIPT LOAD is not allowed.
+				cmds[i] = incrementScript.Eval(ctx, pipe, []string{hkeys[i]}, amount, ttls[key])
+			}
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,249 @@
+package httprateredis_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestGetMany(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	tests := []struct {
+		name string
+		cfg  *httprateredis.Config
+	}{
+		{name: "standalone", cfg: &httprateredis.Config{Host: redis.Host(), Port: uint16(redisPort), FallbackDisabled: true}},
+		{name: "cluster", cfg: &httprateredis.Config{ClusterAddrs: []string{redis.Addr()}, PrefixKey: "cluster", FallbackDisabled: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limitCounter := httprateredis.NewCounter(tt.cfg)
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			previousWindow := currentWindow.Add(-time.Minute)
+
+			keys := []string{"ip:127.0.0.1", "user:1", "route:/missing", "route:/api"}
+			counts := map[string][2]int{"ip:127.0.0.1": {3, 1}, "user:1": {0, 7}, "route:/api": {2, 0}}
+			for key, c := range counts {
+				if err := limitCounter.IncrementBy(key, currentWindow, c[0]); err != nil {
+					t.Fatal(err)
+				}
+				if err := limitCounter.IncrementBy(key, previousWindow, c[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			results, err := limitCounter.GetMany(context.Background(), keys, currentWindow, previousWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []httprateredis.Result{
+				{Key: "ip:127.0.0.1", Curr: 3, Prev: 1},
+				{Key: "user:1", Curr: 0, Prev: 7},
+				{Key: "route:/missing"},
+				{Key: "route:/api", Curr: 2, Prev: 0},
+			}
+			if !reflect.DeepEqual(results, expected) {
+				t.Errorf("unexpected results %+v, expected %+v", results, expected)
+			}
+		})
+	}
+}
+
+func BenchmarkGetMany(b *testing.B) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	keys := make([]string, 5)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key:%v", i)
+		_ = limitCounter.IncrementBy(keys[i], currentWindow, 1)
+	}
+
+	b.Run("GetMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = limitCounter.GetMany(context.Background(), keys, currentWindow, previousWindow)
+		}
+	})
+
+	// Baseline: a round-trip per rate-limit key.
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				_, _, _ = limitCounter.Get(key, currentWindow, previousWindow)
+			}
+		}
+	})
+}
+
+func TestIncrementManyBy(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	tests := []struct {
+		name string
+		cfg  *httprateredis.Config
+	}{
+		{name: "standalone", cfg: &httprateredis.Config{Host: redis.Host(), Port: uint16(redisPort), PrefixKey: "standalone", FallbackDisabled: true}},
+		{name: "cluster", cfg: &httprateredis.Config{ClusterAddrs: []string{redis.Addr()}, PrefixKey: "cluster", FallbackDisabled: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limitCounter := httprateredis.NewCounter(tt.cfg)
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			previousWindow := currentWindow.Add(-time.Minute)
+
+			keys := []string{"ip:127.0.0.1", "user:1", "route:/api"}
+
+			// The first increment loads the script.
+			for i := 0; i < 3; i++ {
+				if err := limitCounter.IncrementManyBy(context.Background(), keys, currentWindow, 2); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			results, err := limitCounter.GetMany(context.Background(), keys, currentWindow, previousWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, result := range results {
+				if result.Curr != 6 {
+					t.Errorf("key %q: unexpected curr = %v, expected 6", result.Key, result.Curr)
+				}
+			}
+			for _, key := range redis.Keys() {
+				if ttl := redis.TTL(key); ttl != 3*time.Minute {
+					t.Errorf("key %q: unexpected TTL %v", key, ttl)
+				}
+			}
+		})
+	}
+}
+
+func TestIncrementManyByErrors(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// Break the counter of one of the keys.
+	if err := limitCounter.Increment("user:1", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	broken := redis.Keys()[0]
+	redis.Del(broken)
+	if _, err := redis.Push(broken, "not a counter"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = limitCounter.IncrementManyBy(context.Background(), []string{"ip:127.0.0.1", "user:1", "route:/api"}, currentWindow, 1)
+	if err == nil || !strings.Contains(err.Error(), `key "user:1"`) || strings.Contains(err.Error(), `key "ip:127.0.0.1"`) {
+		t.Fatalf("unexpected error %v, expected error of user:1 only", err)
+	}
+
+	results, err := limitCounter.GetMany(context.Background(), []string{"ip:127.0.0.1", "route:/api"}, currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Curr != 1 {
+			t.Errorf("key %q: unexpected curr = %v, expected the other keys to be incremented", result.Key, result.Curr)
+		}
+	}
+}
+
+// BenchmarkIncrementManyBy is dominated by the Lua execution of miniredis,
+// the pipeline saves much more with the network latency of a real Redis.
+func BenchmarkIncrementManyBy(b *testing.B) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	keys := make([]string, 5)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key:%v", i)
+	}
+
+	b.Run("IncrementManyBy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = limitCounter.IncrementManyBy(context.Background(), keys, currentWindow, 1)
+		}
+	})
+
+	// Baseline: a round-trip per rate-limit key.
+	b.Run("IncrementBy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				_ = limitCounter.IncrementBy(key, currentWindow, 1)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package httprateredis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestInjectedClient(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Client:           client,
+		FallbackDisabled: true,
+	})
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:client", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, err := limitCounter.Get("key:client", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 {
+		t.Errorf("unexpected curr = %v, expected 2", curr)
+	}
+
+	// Close must not close the caller's client.
+	if err := limitCounter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("injected client should still be usable after Close(): %v", err)
+	}
+
+	// Unless the counter is told it owns the client.
+	ownedCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Client:     client,
+		OwnsClient: true,
+	})
+	if err := ownedCounter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(context.Background()).Err(); err != redis.ErrClosed {
+		t.Errorf("unexpected ping error %v, expected %v", err, redis.ErrClosed)
+	}
+}
+
+func TestNewCounterWithGoRedis(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	limitCounter := httprateredis.NewCounterWithGoRedis(client, &httprateredis.Config{
+		Host:             "unused.invalid", // Ignored in favor of the client.
+		PrefixKey:        "httprate:goredis",
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		advanceTime time.Duration
+		incrBy      int
+		prev        int
+		curr        int
+	}{
+		{name: "t=0m: init"},
+		{name: "t=0m: increment by 1", incrBy: 1, curr: 1},
+		{name: "t=0m: increment by 99", incrBy: 99, curr: 100},
+		{name: "t=1m: move clock by 1m", advanceTime: time.Minute, prev: 100},
+		{name: "t=1m: increment by 20", incrBy: 20, prev: 100, curr: 20},
+		{name: "t=3m: move clock by 2m", advanceTime: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		currentWindow = currentWindow.Add(tt.advanceTime)
+		previousWindow = previousWindow.Add(tt.advanceTime)
+
+		if tt.incrBy > 0 {
+			if err := limitCounter.IncrementBy("key", currentWindow, tt.incrBy); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		curr, prev, err := limitCounter.Get("key", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if curr != tt.curr || prev != tt.prev {
+			t.Errorf("%s: unexpected curr, prev = %v, %v, expected %v, %v", tt.name, curr, prev, tt.curr, tt.prev)
+		}
+	}
+
+	if len(mr.Keys()) == 0 {
+		t.Error("expected the counters to be stored via the given client")
+	}
+	if err := limitCounter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("client should still be usable after Close(): %v", err)
+	}
+}
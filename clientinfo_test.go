@@ -0,0 +1,99 @@
+package httprateredis_test
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestLibName(t *testing.T) {
+	tests := []struct {
+		name            string
+		setInfo         bool // whether the server supports CLIENT SETINFO
+		disableIdentity bool
+		libName         string
+	}{
+		{name: "redis 7.2", setInfo: true, libName: "go-redis(checkout-v1.4.2,"},
+		{name: "older redis", setInfo: false},
+		{name: "disabled", setInfo: true, disableIdentity: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer redis.Close()
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			var (
+				mu       sync.Mutex
+				libNames []string
+				setInfos int
+			)
+			redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+				if cmd != "CLIENT" || len(args) < 3 || !strings.EqualFold(args[0], "SETINFO") {
+					return false
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				setInfos++
+				if !tt.setInfo {
+					c.WriteError("ERR unknown subcommand 'SETINFO'")
+					return true
+				}
+				if strings.EqualFold(args[1], "LIB-NAME") {
+					libNames = append(libNames, args[2])
+				}
+				c.WriteOK()
+				return true
+			})
+
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				MaxActive:        2,
+				LibName:          "checkout v1.4.2",
+				DisableIdentity:  tt.disableIdentity,
+				FallbackDisabled: true,
+			})
+			defer limitCounter.Close()
+			limitCounter.Config(1000, time.Minute)
+
+			// Commands succeed whether the server supports CLIENT SETINFO or not.
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			for i := 0; i < 5; i++ {
+				if err := limitCounter.IncrementBy("key:info", currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Once per connection, not per command: lib-name and lib-ver of each
+			// of the up to MaxActive connections.
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case tt.disableIdentity:
+				if setInfos != 0 {
+					t.Errorf("unexpected %v CLIENT SETINFO calls, expected none", setInfos)
+				}
+			case setInfos < 2 || setInfos > 4:
+				t.Errorf("unexpected %v CLIENT SETINFO calls, expected 2 per connection", setInfos)
+			}
+			for _, libName := range libNames {
+				if !strings.HasPrefix(libName, tt.libName) {
+					t.Errorf("unexpected lib-name %q, expected prefix %q", libName, tt.libName)
+				}
+			}
+			if tt.libName != "" && len(libNames) == 0 {
+				t.Error("expected lib-name to be set")
+			}
+		})
+	}
+}
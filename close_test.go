@@ -0,0 +1,192 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestClose(t *testing.T) {
+	tests := []struct {
+		name             string
+		fallbackDisabled bool
+	}{
+		{name: "fallback enabled"},
+		{name: "fallback disabled", fallbackDisabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer redis.Close()
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				FallbackDisabled: tt.fallbackDisabled,
+			})
+
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			previousWindow := currentWindow.Add(-time.Minute)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 1000)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						if _, _, err := limitCounter.Get("key:close", currentWindow, previousWindow); err != nil {
+							errs <- err
+						}
+					}
+				}()
+			}
+
+			time.Sleep(time.Millisecond)
+			var closeWg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				closeWg.Add(1)
+				go func() {
+					defer closeWg.Done()
+					if err := limitCounter.Close(); err != nil {
+						t.Errorf("Close(): unexpected error %v", err)
+					}
+				}()
+			}
+			closeWg.Wait()
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if !errors.Is(err, httprateredis.ErrClosed) {
+					t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrClosed)
+				}
+			}
+
+			if err := limitCounter.Close(); err != nil {
+				t.Errorf("Close(): unexpected error %v on subsequent call", err)
+			}
+			if err := limitCounter.Increment("key:close", currentWindow); !errors.Is(err, httprateredis.ErrClosed) {
+				t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrClosed)
+			}
+			if limitCounter.IsFallbackActivated() {
+				t.Error("fallback should not be activated by Close()")
+			}
+		})
+	}
+}
+
+func TestCloseContext(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	// Slow down the increments.
+	started := make(chan struct{}, 10)
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if cmd == "EVALSHA" {
+			started <- struct{}{}
+			time.Sleep(200 * time.Millisecond)
+		}
+		return false
+	})
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	incrErr := make(chan error, 1)
+	go func() {
+		incrErr <- limitCounter.IncrementBy("key:drain", currentWindow, 1)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := limitCounter.CloseContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The in-flight increment completed before the client was closed.
+	select {
+	case err := <-incrErr:
+		if err != nil {
+			t.Errorf("in-flight IncrementBy() failed: %v", err)
+		}
+	default:
+		t.Fatal("CloseContext() returned before the in-flight IncrementBy()")
+	}
+	if keys := redis.Keys(); len(keys) != 1 {
+		t.Errorf("unexpected keys %v, expected the increment to be stored", keys)
+	}
+
+	// New operations are rejected.
+	if err := limitCounter.IncrementBy("key:drain", currentWindow, 1); !errors.Is(err, httprateredis.ErrClosed) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrClosed)
+	}
+	if err := limitCounter.Close(); err != nil {
+		t.Errorf("unexpected error %v closing again", err)
+	}
+}
+
+func TestCloseContextTimeout(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             host,
+		Port:             port,
+		FallbackTimeout:  5 * time.Second,
+		FallbackDisabled: true,
+	})
+	limitCounter.Config(1000, time.Minute)
+
+	incrErr := make(chan error, 1)
+	go func() {
+		incrErr <- limitCounter.IncrementBy("key:drain", time.Now().UTC().Truncate(time.Minute), 1)
+	}()
+	for limitCounter.PoolStats().ActiveConns != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limitCounter.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CloseContext() returned after %v, expected the deadline", elapsed)
+	}
+
+	// Closing the client aborts the stuck operation.
+	select {
+	case err := <-incrErr:
+		if !errors.Is(err, httprateredis.ErrClosed) {
+			t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the in-flight IncrementBy() to be aborted")
+	}
+}
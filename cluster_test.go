@@ -0,0 +1,129 @@
+package httprateredis_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestClusterMode(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+
+	prefixKey := fmt.Sprintf("httprate:test:%v", rand.Int31n(100000))
+
+	limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		ClusterAddrs:     []string{redis.Addr()},
+		PrefixKey:        prefixKey,
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:cluster", previousWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:cluster", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	curr, prev, err := limitCounter.Get("key:cluster", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 || prev != 5 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 2, 5", curr, prev)
+	}
+
+	// Both window keys must share the same hash tag.
+	keys := redis.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("unexpected keys %v, expected 2", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefixKey+":{key:cluster}:") {
+			t.Errorf("key %q is not hash-tagged", key)
+		}
+	}
+}
+
+// hashTag returns the part of the key Redis Cluster hashes to pick the slot.
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+func TestUseHashTags(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+
+	for _, useHashTags := range []bool{false, true} {
+		redis.FlushAll()
+
+		limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(redis.Server().Addr().Port),
+			PrefixKey:        "httprate:test",
+			UseHashTags:      useHashTags,
+			FallbackDisabled: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		limitCounter.Config(1000, time.Minute)
+
+		currentWindow := time.Now().UTC().Truncate(time.Minute)
+		previousWindow := currentWindow.Add(-time.Minute)
+
+		for _, key := range []string{"127.0.0.1", "user:42", "key:with:colons"} {
+			if err := limitCounter.IncrementBy(key, previousWindow, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := limitCounter.IncrementBy(key, currentWindow, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tags := map[string]int{}
+		for _, key := range redis.Keys() {
+			if !strings.HasPrefix(key, "httprate:test:") {
+				t.Errorf("key %q lost the prefix", key)
+			}
+			tags[hashTag(key)]++
+		}
+		if useHashTags {
+			// Each rate-limit key has its current and previous window on the same slot.
+			for _, key := range []string{"127.0.0.1", "user:42", "key:with:colons"} {
+				if tags[key] != 2 {
+					t.Errorf("unexpected %v window keys with hash tag %q, expected 2 (keys %v)", tags[key], key, redis.Keys())
+				}
+			}
+		} else if len(tags) != 6 {
+			t.Errorf("unexpected hash tags %v, expected 6 distinct keys without hash tags", tags)
+		}
+		limitCounter.Close()
+	}
+}
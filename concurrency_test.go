@@ -0,0 +1,151 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"golang.org/x/sync/errgroup"
+)
+
+// TestConcurrentUse mixes all the counter methods with Config, a Redis outage
+// (and so the local in-memory fallback) and Close, meant to run with -race.
+func TestConcurrentUse(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 100 * time.Millisecond,
+		FallbackMaxKeys: 50,
+		FallbackResync:  true,
+		CooldownPeriod:  10 * time.Millisecond,
+	})
+	limitCounter.Config(1000, time.Minute)
+
+	ctx := context.Background()
+	stop := make(chan struct{})
+	var g errgroup.Group
+	for i := 0; i < 50; i++ {
+		g.Go(func() error {
+			key := fmt.Sprintf("key:%v", i%10)
+			for {
+				select {
+				case <-stop:
+					return nil
+				default:
+				}
+				currentWindow := time.Now().UTC().Truncate(time.Minute)
+				previousWindow := currentWindow.Add(-time.Minute)
+				var err error
+				switch i % 5 {
+				case 0:
+					limitCounter.Config(1000+i, time.Minute)
+				case 1:
+					err = limitCounter.IncrementBy(key, currentWindow, 1)
+				case 2:
+					_, _, err = limitCounter.Get(key, currentWindow, previousWindow)
+				case 3:
+					_, err = limitCounter.GetMany(ctx, []string{key, "key:other"}, currentWindow, previousWindow)
+				case 4:
+					_, err = limitCounter.Allow(ctx, key)
+					_ = limitCounter.Stats()
+				}
+				if err != nil && !errors.Is(err, httprateredis.ErrClosed) {
+					return err
+				}
+			}
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	redis.SetError("LOADING Redis is loading the dataset in memory")
+	time.Sleep(50 * time.Millisecond)
+	redis.SetError("")
+	time.Sleep(50 * time.Millisecond)
+	if err := limitCounter.Close(); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConcurrentFallbackCounts forces a Redis failure under concurrent
+// increments, each of which must be counted once, either by Redis or by the
+// local in-memory fallback activated by the failure.
+func TestConcurrentFallbackCounts(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:           redis.Host(),
+		Port:           uint16(redisPort),
+		CooldownPeriod: time.Minute,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(100000, time.Minute)
+	failures := limitCounter.InjectFailures()
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	const workers, increments = 20, 50
+	var g errgroup.Group
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for j := 0; j < increments; j++ {
+				if i == 0 && j == increments/2 {
+					failures.FailNext(1, errors.New("connection reset by peer"))
+				}
+				if err := limitCounter.IncrementBy("key:forced", currentWindow, 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := failures.Remaining(); n != 0 {
+		t.Fatalf("%v forced failures left", n)
+	}
+	stats := limitCounter.Stats()
+	if stats.RedisErrors != 1 || stats.FallbackActivations != 1 {
+		t.Errorf("unexpected %v Redis errors and %v fallback activations, expected 1 and 1", stats.RedisErrors, stats.FallbackActivations)
+	}
+
+	// The fallback serves Get while it's activated, for the cooldown period.
+	fallbackCount, _, err := limitCounter.Get("key:forced", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisCount := 0
+	if value, err := redis.Get(limitCounter.LimitCounterKey("key:forced", currentWindow)); err == nil {
+		redisCount, _ = strconv.Atoi(value)
+	}
+	if fallbackCount == 0 {
+		t.Error("expected increments served by the fallback")
+	}
+	if total := redisCount + fallbackCount; total != workers*increments {
+		t.Errorf("unexpected %v increments in Redis and %v in the fallback, expected %v in total", redisCount, fallbackCount, workers*increments)
+	}
+}
@@ -1,42 +1,469 @@
 package httprateredis
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type Config struct {
+	// Disabled turns rate limiting off, see SetEnabled.
 	Disabled bool `toml:"disabled"` // default: false
 
 	WindowLength time.Duration `toml:"window_length"` // default: 1m
 	ClientName   string        `toml:"client_name"`   // default: ""
 	PrefixKey    string        `toml:"prefix_key"`    // default: "httprate"
 
+	// RequestLimit is the number of requests allowed per WindowLength applied by
+	// NewReloadable and Reload, so a reload can change the limit httprate set by
+	// Config. It's not used by NewCounter, which is limited by Config only.
+	RequestLimit int `toml:"request_limit"` // default: 0, the limit set by Config
+
+	// LibName is reported by CLIENT SETINFO on each new connection on Redis 7.2+,
+	// as part of the library name "go-redis(<LibName>,<Go version>)", e.g. the
+	// service name and version "checkout-v1.4.2", so the rate-limiter traffic
+	// can be attributed in CLIENT LIST and monitoring tools. The library version
+	// is the go-redis version. Older servers rejecting CLIENT SETINFO are fine,
+	// the error is ignored. Spaces are replaced by dashes, as Redis rejects them.
+	// DisableIdentity skips CLIENT SETINFO altogether.
+	LibName         string `toml:"lib_name"`         // default: ""
+	DisableIdentity bool   `toml:"disable_identity"` // default: false
+
+	// Mode is the rate-limiting algorithm: ModeSlidingWindow, the exact but more
+	// memory-intensive ModeSlidingLog, or ModeTokenBucket allowing short bursts.
+	// The local in-memory fallback always uses the sliding window.
+	Mode Mode `toml:"mode"` // default: "sliding_window"
+
+	// UseServerTime computes the windows by the Redis server clock instead of the
+	// local one, so all app servers agree on the windows regardless of their
+	// clock skew. The windows passed to IncrementBy and Get are replaced by the
+	// windows of the server clock. The server clock is the local clock plus the
+	// offset measured by the TIME command every minute from the first command
+	// on, so there's no extra round-trip per request.
+	UseServerTime bool `toml:"use_server_time"` // default: false
+
+	// WindowBuckets splits the window of ModeSlidingWindow into that many buckets
+	// of window length / WindowBuckets each, e.g. 6. Get sums the buckets of the
+	// last window length, with the oldest bucket weighted by its part within it.
+	// It's more accurate than the two-window approximation of httprate, which
+	// may be off by up to the previous window count near the window boundaries,
+	// at the cost of WindowBuckets + 1 keys per rate-limit key. Get returns the
+	// rate as the current window count and 0 as the previous one. The local
+	// in-memory fallback always uses the two windows.
+	WindowBuckets int `toml:"window_buckets"` // default: 2, the current and previous window
+
+	// WarnThreshold is the fraction of the request limit, e.g. 0.8, from which
+	// Status reports StateWarn, e.g. to tell users they're near their limit
+	// before they get blocked. Zero disables the warning state.
+	WarnThreshold float64 `toml:"warn_threshold"` // default: 0
+
+	// Token bucket of Take and ModeTokenBucket: the bucket holds up to Burst
+	// tokens and refills RefillRate tokens per second. By default, the bucket
+	// holds the request limit and refills it within the window length.
+	RefillRate float64 `toml:"refill_rate"` // default: limit / window length
+	Burst      int     `toml:"burst"`       // default: limit
+
+	// MaxInFlight is the number of concurrent requests per rate-limit key allowed
+	// by Acquire. Slots not released within InFlightTTL are reclaimed, so it must
+	// be longer than the requests take.
+	MaxInFlight int           `toml:"max_in_flight"`
+	InFlightTTL time.Duration `toml:"in_flight_ttl"` // default: 1m
+
+	// DedupTTL is how long IncrementOnce remembers a request ID, so it must
+	// cover the time within which a request may be retried.
+	DedupTTL time.Duration `toml:"dedup_ttl"` // default: 5m
+
+	// LimitFunc if supplied returns the request limit and window length of the
+	// given rate-limit key, e.g. by its API tier. Zero values fall back to the
+	// limit and window length configured by httprate via Config(). The window
+	// length determines the windows and TTL of the key counters, so it must
+	// match the windows passed to IncrementBy and Get for the key.
+	LimitFunc func(key string) (limit int, window time.Duration)
+
+	// KeyFunc if supplied returns the Redis key of the window counter of the
+	// given rate-limit key, e.g. to add a tenant namespace or to hash long keys.
+	// It's used by all operations (IncrementBy, Get, Reset, ...), so it must be
+	// deterministic and return different keys for different windows. PrefixKey
+	// and hash tags are not added: in cluster mode, the keys of all windows of a
+	// rate-limit key must share a hash tag, and ResetAll deletes only the keys
+	// starting with PrefixKey. The keys of the sliding log and token bucket modes,
+	// which are not bound to a window, are not affected.
+	KeyFunc func(key string, window time.Time) string
+
+	// MaxKeyLength caps the length of the Redis keys containing the rate-limit
+	// key, i.e. the hash-tagged keys of cluster mode and UseHashTags, e.g. for
+	// keys built from long URLs. Longer keys get the rate-limit key replaced by
+	// its SHA-256, so the prefix stays readable. The other keys contain a hash
+	// of the rate-limit key anyway. Keys built by KeyFunc are not affected.
+	MaxKeyLength int `toml:"max_key_length"` // default: 0, no limit
+
+	// KeyTTL is the expiration of each window counter, set when the counter is
+	// created in Redis. The previous window counter must survive until the end
+	// of the current window, so KeyTTL is never less than 2 * window length.
+	// Longer TTL keeps more stale counters around, costing Redis memory of about
+	// one key per rate-limit key and window length of KeyTTL.
+	KeyTTL time.Duration `toml:"key_ttl"` // default: 3 * window length
+
+	// TTLJitter spreads the TTL of each counter randomly by up to +/- TTLJitter,
+	// so the counters created in the same window don't all expire at the same
+	// instant. The jittered TTL is still never less than 2 * window length.
+	TTLJitter time.Duration `toml:"ttl_jitter"` // default: 0
+
+	// Strict makes the constructors returning an error (e.g. NewCounterWithError)
+	// reject the fields which would otherwise be silently defaulted, e.g. an empty
+	// PrefixKey sharing the "httprate" prefix with other services.
+	Strict bool `toml:"strict"` // default: false
+
+	// UseFunctions runs the Lua scripts (e.g. the atomic increment and the token
+	// bucket) as Redis Functions via FCALL instead of EVALSHA, for servers which
+	// allow FCALL but block EVAL. The function library is loaded by FUNCTION LOAD
+	// when it's missing, e.g. on the first call or after a Redis restart.
+	// Requires Redis 7+.
+	UseFunctions bool `toml:"use_functions"` // default: false
+
+	// UseUnlink makes Reset delete the counters by UNLINK instead of DEL, so
+	// Redis reclaims their memory in the background, e.g. for the large sorted
+	// sets of ModeSlidingLog. Servers which don't know UNLINK (before Redis 4)
+	// get DEL instead, which is remembered. ResetAll always prefers UNLINK.
+	UseUnlink bool `toml:"use_unlink"` // default: false
+
+	// ConnectEagerly makes the constructors ping Redis, so an unreachable host or
+	// bad credentials are reported on startup instead of on the first request:
+	// NewCounterWithError returns the error, NewCounter logs it. It also keeps an
+	// idle connection open from the start. By default, the counter is created
+	// lazily, without any network activity until the first command.
+	ConnectEagerly bool `toml:"connect_eagerly"` // default: false
+
 	// OnError lets you subscribe to all runtime Redis errors. Useful for logging/debugging.
 	OnError func(err error)
 
 	// Disable the use of the local in-memory fallback mechanism. When enabled,
-	// the system will return HTTP 428 for all requests when Redis is down.
+	// the system will return HTTP 428 for all requests when Redis is down,
+	// unless OnErrorAllow is set.
 	FallbackDisabled bool `toml:"fallback_disabled"` // default: false
 
+	// FallbackMaxKeys bounds the memory of the local in-memory fallback during
+	// long Redis outages to that many rate-limit keys, evicting the least
+	// recently used keys, which count from zero once used again. By default,
+	// the fallback holds the keys of the last two windows.
+	FallbackMaxKeys int `toml:"fallback_max_keys"` // default: 0, no limit
+
+	// FallbackResync buffers the increments served by the local in-memory
+	// fallback and flushes them to Redis in the background once it recovers,
+	// best-effort, so the limits don't reset after an outage. The increments of
+	// the windows which expired meanwhile are dropped. Up to 10000 window
+	// counters are buffered, the increments of any more are lost.
+	FallbackResync bool `toml:"fallback_resync"` // default: false
+
+	// OnErrorAllow lets all requests through (fail-open) when Redis is down and
+	// the local in-memory fallback is disabled, by reporting zero counts instead
+	// of an error. Fail-open is the typical choice when availability matters more
+	// than strict limiting. By default, errors are returned (fail-closed) and
+	// httprate responds with HTTP 428. Errors are reported via OnError either way.
+	OnErrorAllow bool `toml:"on_error_allow"` // default: false
+
 	// Timeout for each Redis command after which we fall back to a local
 	// in-memory counter. If Redis does not respond within this duration,
 	// the system will use the local counter unless it is explicitly disabled.
 	FallbackTimeout time.Duration `toml:"fallback_timeout"` // default: 100ms
 
+	// Timeouts of the underlying Redis connections. A read or write timeout
+	// fails the Redis command, which activates the local in-memory fallback.
+	DialTimeout  time.Duration `toml:"dial_timeout"`  // default: 2 * FallbackTimeout
+	ReadTimeout  time.Duration `toml:"read_timeout"`  // default: FallbackTimeout
+	WriteTimeout time.Duration `toml:"write_timeout"` // default: FallbackTimeout
+
+	// CommandTimeout bounds each Redis command as a whole, e.g. 50ms, so a slow
+	// command is abandoned and served by the local in-memory fallback sooner
+	// than FallbackTimeout and the connection timeouts would. It applies on top
+	// of the deadlines of the contexts passed to IncrementByCtx, GetCtx etc., the
+	// earlier deadline wins. Unlike those, a command timeout counts as a Redis
+	// failure towards activating the fallback. Each retry gets its own timeout.
+	// It's ignored with Client, whose commands honor only the context deadlines.
+	CommandTimeout time.Duration `toml:"command_timeout"` // default: 0, the connection timeouts only
+
+	// MaxRetries is the number of times a Redis command is retried on connection
+	// errors (e.g. after a Redis restart) before the fallback is activated. Get
+	// is retried on any connection error. IncrementBy is retried only when the
+	// command provably wasn't sent (e.g. dial errors), so it's never counted twice.
+	// Retries are delayed by exponential backoff with jitter, starting at
+	// RetryBackoff and capped at 512ms.
+	MaxRetries   int           `toml:"max_retries"`   // default: 0
+	RetryBackoff time.Duration `toml:"retry_backoff"` // default: 8ms
+
+	// Circuit breaker activating the local in-memory fallback. The fallback is
+	// activated after FailureThreshold consecutive failed Redis commands (each
+	// failed command is served by the local counter either way). Then, every
+	// CooldownPeriod, Redis is probed with PING and the fallback is deactivated
+	// after HalfOpenProbes successful probes in a row.
+	FailureThreshold int           `toml:"failure_threshold"` // default: 1
+	CooldownPeriod   time.Duration `toml:"cooldown_period"`   // default: 200ms
+	HalfOpenProbes   int           `toml:"half_open_probes"`  // default: 1
+
+	// OnFallback is called with the underlying error each time a Redis command
+	// fails and the request is served by the local in-memory fallback instead.
+	// Requests served by the fallback while it's activated don't hit Redis
+	// and are not reported. Useful for metrics or warning logs.
+	OnFallback func(err error)
+
 	// OnFallbackChange lets subscribe to local in-memory fallback changes.
 	OnFallbackChange func(activated bool)
 
-	// Client if supplied will be used and the below fields will be ignored.
+	// OnDecision is called with each decision of Allow, e.g. to track the
+	// allow/deny rates and the top offenders: used is the sliding window rate
+	// including the request if allowed. It's called synchronously after the
+	// Redis calls, so it must be cheap and not block.
+	OnDecision func(key string, allowed bool, used, limit int)
+
+	// OnPoolWait is called with the time a Redis command waited for a free
+	// connection of the pool, whenever all MaxActive connections were in use,
+	// e.g. to record an OpenTelemetry histogram and tell pool saturation from
+	// Redis latency. The waits are those counted by the go-redis pool, sampled
+	// every 100ms off the command path, so the waits of a sample are reported
+	// with their mean wait time, shortly after the commands. See also
+	// Stats.PoolWaits. It's not called in cluster mode, with ShardAddrs and
+	// with Client.
+	OnPoolWait func(wait time.Duration)
+
+	// Tracer if supplied creates the httprate-redis.increment and
+	// httprate-redis.get spans around IncrementBy and Get operations.
+	Tracer Tracer `toml:"-"`
+
+	// Logger if supplied logs Redis errors and fallback changes. Default: no-op.
+	Logger Logger `toml:"-"`
+
+	// Slog if supplied logs the same as Logger to a *slog.Logger, as structured
+	// records with the prefix, db and error attributes. Ignored if Logger is set.
+	Slog *slog.Logger `toml:"-"`
+
+	// Client if supplied will be used and the connection fields below will be
+	// ignored. The caller keeps ownership of the client: Close() will not close it,
+	// unless OwnsClient is set.
 	//
 	// NOTE: It's recommended to set short dial/read/write timeouts and disable
 	// retries on the client, so the local in-memory fallback can activate quickly.
-	Client    redis.UniversalClient `toml:"-"`
-	Host      string                `toml:"host"`
-	Port      uint16                `toml:"port"`
-	Password  string                `toml:"password"`   // optional
-	DBIndex   int                   `toml:"db_index"`   // default: 0
-	MaxIdle   int                   `toml:"max_idle"`   // default: 5
-	MaxActive int                   `toml:"max_active"` // default: 10
+	Client     redis.UniversalClient `toml:"-"`
+	OwnsClient bool                  `toml:"-"`
+
+	// ClientCacheTTL enables the client-side caching of the counters read by Get
+	// of NewCounterWithRueidis, cached up to ClientCacheTTL by rueidis and
+	// invalidated by Redis on each increment, so the reads skip the round-trip
+	// until then. The increments of other app servers are seen once their
+	// invalidation arrives. It requires Redis 6+ and a rueidis client with the
+	// cache enabled, and it's not used by the other counters.
+	ClientCacheTTL time.Duration `toml:"client_cache_ttl"` // default: 0, no caching
+
+	Host      string `toml:"host"`
+	Port      uint16 `toml:"port"`
+	Username  string `toml:"username"`   // optional, Redis 6+ ACL user
+	Password  string `toml:"password"`   // optional
+	DBIndex   int    `toml:"db_index"`   // default: 0
+	MaxIdle   int    `toml:"max_idle"`   // default: 5
+	MaxActive int    `toml:"max_active"` // default: 10
+
+	// MaxConnLifetime if positive closes the pooled connections older than it,
+	// so they are replaced by new connections on the next borrow, e.g. before
+	// a load balancer kills the long-lived ones, or a rotated PasswordFunc
+	// token expires. The connections in use are closed once they're returned
+	// to the pool. Default: 0, the connections are kept open.
+	MaxConnLifetime time.Duration `toml:"max_conn_lifetime"`
+
+	// PasswordFunc if supplied returns the password of each new connection and
+	// takes precedence over Password, e.g. to fetch the current auth token of
+	// AWS ElastiCache or another rotating credential. It's called when a
+	// connection is dialed (and when one is re-authenticated on NOAUTH), so the
+	// rotated tokens are picked up as the pool replaces its connections, see
+	// MaxConnLifetime to bound their age. An error fails the dial with
+	// ErrAuthFailed. Ignored with Client. Not supported with SentinelAddrs nor
+	// ShardAddrs: NewCounterWithError rejects it, NewCounter logs an error and
+	// uses Password.
+	PasswordFunc func() (string, error) `toml:"-"`
+
+	// DBForKey if supplied returns the logical database of the given rate-limit
+	// key, e.g. to isolate the counters of each tenant. It's used by all the
+	// operations on rate-limit keys, e.g. IncrementBy, Get, AllowN, Reset and
+	// each key of GetMany, in every Mode; ResetAll and ActiveKeys use DBIndex
+	// only, as do the replicas of ReplicaAddrs. Each database other than
+	// DBIndex gets its own connection pool of up to MaxActive connections, so
+	// connections never switch databases by SELECT. Ignored in cluster mode, with
+	// ShardAddrs and with Client.
+	DBForKey func(key string) int `toml:"-"`
+
+	// Borrowers wait for a free connection once MaxActive connections are in
+	// use, up to ReadTimeout + 1s. PoolWaitDisabled makes them fail immediately
+	// instead, so the request is served by the local in-memory fallback (or
+	// fails, if it's disabled). This bounds the latency under bursts at the cost
+	// of approximate counting while the pool is exhausted, which includes the
+	// slots held by connections being dialed.
+	PoolWaitDisabled bool `toml:"pool_wait_disabled"` // default: false
+
+	// Protocol is the RESP version negotiated with HELLO on each new connection,
+	// 2 or 3. If the server rejects HELLO 3 (e.g. Redis < 6), RESP2 is used.
+	// Ignored if Client is supplied.
+	Protocol int `toml:"protocol"` // default: 2
+
+	// Network is either "tcp" or "unix". With "unix", the client dials
+	// SocketPath instead of Host/Port.
+	Network    string `toml:"network"` // default: "tcp"
+	SocketPath string `toml:"socket_path"`
+
+	// ClusterAddrs if supplied will connect to a Redis Cluster using the given
+	// seed nodes, and Host/Port/DBIndex will be ignored. In cluster mode, keys
+	// are hash-tagged by the rate-limit key (e.g. "httprate:{key}:1700000000"),
+	// so the current and previous window counters always land on the same slot.
+	ClusterAddrs []string `toml:"cluster_addrs"`
+
+	// ShardAddrs if supplied will shard the keys across the given standalone Redis
+	// servers by consistent hashing of the rate-limit key, and Host/Port will be
+	// ignored. The keys are hash-tagged as in cluster mode, so all counters of a
+	// rate-limit key live on the same shard. Shards failing the health checks
+	// are taken out of the ring, moving their keys to the other shards.
+	ShardAddrs []string `toml:"shard_addrs"`
+
+	// ShardVirtualNodes is the number of points of each shard on the consistent
+	// hash ring of ShardAddrs. Adding or removing a shard of n moves about 1/n
+	// of the keys either way, more points spread the keys more evenly across
+	// the shards at the cost of a larger ring, rebuilt on each change.
+	ShardVirtualNodes int `toml:"shard_virtual_nodes"` // default: 160
+
+	// UseHashTags enables the hash-tagged keys of cluster mode for any client,
+	// e.g. for a Redis Cluster behind a proxy or a Client which isn't a
+	// *redis.ClusterClient. The prefix is kept, but the key format changes, so
+	// the existing counters start from zero once when this is toggled.
+	UseHashTags bool `toml:"use_hash_tags"` // default: false, always on in cluster mode
+
+	// SentinelAddrs and MasterName if supplied will resolve the current Redis
+	// master through Redis Sentinel, and Host/Port will be ignored. New connections
+	// always dial the master reported by Sentinel, so the counter follows failovers.
+	SentinelAddrs []string `toml:"sentinel_addrs"`
+	MasterName    string   `toml:"master_name"`
+
+	// ReplicaAddrs if supplied will route the reads of Get and GetMany to the
+	// given replicas of the primary (round-robin), while the increments always
+	// go to the primary. The replication is asynchronous, so the reads may be
+	// slightly stale, i.e. let a few more requests through under bursts. If a
+	// replica fails, the read is retried on the primary. Ignored in cluster mode,
+	// with ShardAddrs and with Client.
+	ReplicaAddrs []string `toml:"replica_addrs"`
+
+	// SecondaryHost and SecondaryPort if supplied will serve the requests by a
+	// secondary Redis (e.g. in another availability zone) while the primary is
+	// failing, in place of the local in-memory fallback. So the counts stay shared
+	// by all app servers during the outage, as long as they fail over to the
+	// same secondary. The local in-memory fallback is used only when both fail.
+	// The secondary uses the same options as the primary, OnError, OnFallback
+	// and OnFallbackChange are called for the both.
+	SecondaryHost string `toml:"secondary_host"`
+	SecondaryPort uint16 `toml:"secondary_port"` // default: 6379
+
+	// TLSEnabled enables TLS for the Redis connection using the default
+	// tls.Config with the server name set to Host. Ignored if TLSConfig is set.
+	TLSEnabled bool `toml:"tls_enabled"` // default: false
+
+	// TLSConfig if supplied will be used to wrap each Redis connection with TLS.
+	// If ServerName is empty, Host is used for SNI and certificate verification.
+	//
+	// For mutual TLS, set Certificates to the client certificate and RootCAs to
+	// the CA of the server. The handshake runs on every new pooled connection.
+	// A failed handshake (e.g. expired or rejected client certificate) fails the
+	// Redis command like any other connection error: NewRedisLimitCounter returns
+	// it, while at runtime it's reported via OnError and, unless FallbackDisabled
+	// is set, the local in-memory fallback is activated.
+	TLSConfig *tls.Config `toml:"-"`
+
+	// now returns the current time, see WithClock.
+	now func() time.Time
+}
+
+// setBackendDefaults sets the defaults of the options of every backend, i.e.
+// of the Redis and the Upstash counters.
+func (cfg *Config) setBackendDefaults() {
+	if cfg.PrefixKey == "" {
+		cfg.PrefixKey = "httprate"
+	}
+	if cfg.FallbackTimeout == 0 {
+		if cfg.FallbackDisabled {
+			cfg.FallbackTimeout = time.Second
+		} else {
+			// Activate local in-memory fallback fairly quickly,
+			// so we don't slow down incoming requests too much.
+			cfg.FallbackTimeout = 250 * time.Millisecond
+		}
+	}
+}
+
+// ErrInvalidConfig is returned (wrapped) by the constructors returning an error,
+// when a Config field is invalid.
+var ErrInvalidConfig = errors.New("httprateredis: invalid config")
+
+func (cfg *Config) validate() error {
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Network {
+	case "", "tcp":
+	case "unix":
+		if cfg.SocketPath == "" {
+			return fmt.Errorf("%w: socket_path is required for unix network", ErrInvalidConfig)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported network %q", ErrInvalidConfig, cfg.Network)
+	}
+	if cfg.RequestLimit < 0 {
+		return fmt.Errorf("%w: request_limit must not be negative, got %d", ErrInvalidConfig, cfg.RequestLimit)
+	}
+	if cfg.ClientCacheTTL < 0 {
+		return fmt.Errorf("%w: client_cache_ttl must not be negative, got %v", ErrInvalidConfig, cfg.ClientCacheTTL)
+	}
+	if cfg.FallbackMaxKeys < 0 {
+		return fmt.Errorf("%w: fallback_max_keys must not be negative, got %d", ErrInvalidConfig, cfg.FallbackMaxKeys)
+	}
+	if cfg.WindowBuckets < 0 {
+		return fmt.Errorf("%w: window_buckets must not be negative, got %d", ErrInvalidConfig, cfg.WindowBuckets)
+	}
+	if cfg.ShardVirtualNodes < 0 {
+		return fmt.Errorf("%w: shard_virtual_nodes must not be negative, got %d", ErrInvalidConfig, cfg.ShardVirtualNodes)
+	}
+	if cfg.MaxConnLifetime < 0 {
+		return fmt.Errorf("%w: max_conn_lifetime must not be negative, got %v", ErrInvalidConfig, cfg.MaxConnLifetime)
+	}
+	if cfg.CommandTimeout < 0 {
+		return fmt.Errorf("%w: command_timeout must not be negative, got %v", ErrInvalidConfig, cfg.CommandTimeout)
+	}
+	if cfg.TTLJitter < 0 {
+		return fmt.Errorf("%w: ttl_jitter must not be negative, got %v", ErrInvalidConfig, cfg.TTLJitter)
+	}
+	if cfg.WarnThreshold < 0 || cfg.WarnThreshold > 1 {
+		return fmt.Errorf("%w: warn_threshold must be between 0 and 1, got %v", ErrInvalidConfig, cfg.WarnThreshold)
+	}
+	switch cfg.Mode {
+	case "", ModeSlidingWindow, ModeSlidingLog, ModeTokenBucket:
+	default:
+		return fmt.Errorf("%w: unsupported mode %q", ErrInvalidConfig, cfg.Mode)
+	}
+	switch cfg.Protocol {
+	case 0, 2, 3:
+	default:
+		return fmt.Errorf("%w: unsupported protocol %d, expected 2 or 3", ErrInvalidConfig, cfg.Protocol)
+	}
+	if cfg.DBIndex < 0 {
+		return fmt.Errorf("%w: db_index must not be negative, got %d", ErrInvalidConfig, cfg.DBIndex)
+	}
+	if cfg.MaxIdle < 0 || cfg.MaxActive < 0 {
+		return fmt.Errorf("%w: max_idle and max_active must not be negative, got %d and %d", ErrInvalidConfig, cfg.MaxIdle, cfg.MaxActive)
+	}
+	if cfg.MaxKeyLength < 0 {
+		return fmt.Errorf("%w: max_key_length must not be negative, got %d", ErrInvalidConfig, cfg.MaxKeyLength)
+	}
+	if cfg.PasswordFunc != nil && (len(cfg.SentinelAddrs) > 0 || len(cfg.ShardAddrs) > 0) {
+		return fmt.Errorf("%w: PasswordFunc is not supported with sentinel_addrs nor shard_addrs", ErrInvalidConfig)
+	}
+	if cfg.Strict && cfg.PrefixKey == "" {
+		return fmt.Errorf("%w: prefix_key is required in strict mode", ErrInvalidConfig)
+	}
+	return nil
 }
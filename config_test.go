@@ -0,0 +1,80 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+// TestConfigConcurrent is meant to be run with -race.
+func TestConfigConcurrent(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	tests := []struct {
+		name string
+		down bool // served by the local in-memory fallback
+	}{
+		{name: "redis"},
+		{name: "fallback", down: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := uint16(redisPort)
+			if tt.down {
+				port = 1
+			}
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:           redis.Host(),
+				Port:           port,
+				CooldownPeriod: time.Minute,
+			})
+			defer limitCounter.Close()
+			limitCounter.Config(1000, time.Minute)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ctx.Err() == nil; i++ {
+					limitCounter.Config(1000+i%10, time.Minute)
+				}
+			}()
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for ctx.Err() == nil {
+						currentWindow := time.Now().UTC().Truncate(time.Minute)
+						previousWindow := currentWindow.Add(-time.Minute)
+						if err := limitCounter.IncrementBy("key:config", currentWindow, 1); err != nil {
+							t.Error(err)
+							return
+						}
+						if _, _, err := limitCounter.Get("key:config", currentWindow, previousWindow); err != nil {
+							t.Error(err)
+							return
+						}
+						if _, err := limitCounter.Remaining(context.Background(), "key:config"); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
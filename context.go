@@ -0,0 +1,84 @@
+package httprateredis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+var _ httprate.LimitCounter = (*ContextCounter)(nil)
+
+// ContextCounter is a view of the counter binding the Redis round-trips of
+// IncrementBy and Get to a context, see WithContext.
+type ContextCounter struct {
+	c   *redisCounter
+	ctx context.Context
+}
+
+// WithContext returns a view of c whose IncrementBy and Get are IncrementByCtx
+// and GetCtx with ctx, e.g. the request context shared by a whole handler. The
+// view is cheap, it shares c and the Redis client (and its connection pool)
+// with no state of its own. Config configures c and Close is a no-op, as the
+// view doesn't own the client.
+//
+// A ctx cancelled during a round-trip fails the call right away, a ctx
+// cancelled before fails it without a round-trip, see IncrementByCtx.
+func (c *redisCounter) WithContext(ctx context.Context) *ContextCounter {
+	return &ContextCounter{c: c, ctx: ctx}
+}
+
+// Context returns the context of the view.
+func (v *ContextCounter) Context() context.Context {
+	return v.ctx
+}
+
+func (v *ContextCounter) Config(requestLimit int, windowLength time.Duration) {
+	v.c.Config(requestLimit, windowLength)
+}
+
+func (v *ContextCounter) Increment(key string, currentWindow time.Time) error {
+	return v.c.IncrementByCtx(v.ctx, key, currentWindow, 1)
+}
+
+func (v *ContextCounter) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	return v.c.IncrementByCtx(v.ctx, key, currentWindow, amount)
+}
+
+func (v *ContextCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return v.c.GetCtx(v.ctx, key, currentWindow, previousWindow)
+}
+
+// Close is a no-op, close the counter of WithContext instead.
+func (v *ContextCounter) Close() error {
+	return nil
+}
+
+// awaitContext returns the result of the Redis round-trips of fn, or the error
+// of ctx, wrapped with msg, as soon as ctx is cancelled. go-redis interrupts a
+// round-trip at the deadline of ctx only, so a cancelled ctx would otherwise
+// wait for the reply or the read timeout. fn then keeps running in the
+// background until either arrives, so it must not share state with the caller.
+// A ctx which is never cancelled runs fn in place.
+func awaitContext[T any](ctx context.Context, msg string, fn func() (T, error)) (T, error) {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("httprateredis: %s: %w", msg, ctx.Err())
+	}
+}
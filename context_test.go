@@ -0,0 +1,202 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestContextDeadline(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             host,
+		Port:             port,
+		FallbackTimeout:  5 * time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := limitCounter.IncrementByCtx(ctx, "key:ctx", currentWindow, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("IncrementByCtx() returned after %v, expected to honor the context deadline", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	start = time.Now()
+	_, _, err = limitCounter.GetCtx(ctx, "key:ctx", currentWindow, previousWindow)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v, expected %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetCtx() returned after %v, expected to return immediately", elapsed)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             host,
+		Port:             port,
+		FallbackTimeout:  2 * time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// A ctx cancelled during the round-trip fails the call right away, rather
+	// than at the read timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := limitCounter.IncrementByCtx(ctx, "key:ctx", currentWindow, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v, expected %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("IncrementByCtx() returned after %v, expected to return once cancelled", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	if _, _, err := limitCounter.GetCtx(ctx, "key:ctx", currentWindow, previousWindow); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v, expected %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetCtx() returned after %v, expected to return once cancelled", elapsed)
+	}
+}
+
+func TestContextDeadlineFallback(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            host,
+		Port:            port,
+		FallbackTimeout: 5 * time.Second,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The local counter serves the request, but a cancelled
+	// request alone must not activate the fallback.
+	if err := limitCounter.IncrementByCtx(ctx, "key:ctx", currentWindow, 1); err != nil {
+		t.Error(err)
+	}
+	if limitCounter.IsFallbackActivated() {
+		t.Error("fallback should not be activated by a cancelled context")
+	}
+}
+
+// newBlackhole starts a TCP server which accepts connections,
+// but never responds. Useful for simulating unresponsive Redis.
+func newBlackhole(t *testing.T) (host string, port uint16) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	h, p, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(p)
+	return h, uint16(portNum)
+}
+
+func TestWithContext(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             host,
+		Port:             port,
+		FallbackTimeout:  5 * time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	view := limitCounter.WithContext(ctx)
+	view.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// The deadline of the view context cuts the Redis call in progress short.
+	start := time.Now()
+	if err := view.IncrementBy("key:ctx", currentWindow, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("IncrementBy() returned after %v, expected to honor the view context", elapsed)
+	}
+
+	// A cancelled view context fails the calls without a round-trip.
+	ctx, cancel = context.WithCancel(context.Background())
+	view = limitCounter.WithContext(ctx)
+	cancel()
+	start = time.Now()
+	if _, _, err := view.Get("key:ctx", currentWindow, previousWindow); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v, expected %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get() returned after %v, expected to return immediately", elapsed)
+	}
+
+	// Closing the view doesn't close the counter.
+	if err := view.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limitCounter.IncrementByCtx(ctx, "key:ctx", currentWindow, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
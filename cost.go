@@ -0,0 +1,24 @@
+package httprateredis
+
+import (
+	"net/http"
+
+	"github.com/go-chi/httprate"
+)
+
+// Cost is a middleware making each request consume cost units of the quota of
+// the httprate limiter that follows it, e.g. for expensive endpoints:
+//
+//	r.With(httprateredis.Cost(10), limiter).Post("/export", exportHandler)
+//
+// It's a shortcut for httprate.WithIncrement, which can also be set per request
+// from any middleware running before the limiter. httprate passes the cost to
+// IncrementBy, so a request is let through only if the whole cost fits into the
+// remaining quota.
+func Cost(cost int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(httprate.WithIncrement(r.Context(), cost)))
+		})
+	}
+}
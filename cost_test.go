@@ -0,0 +1,111 @@
+package httprateredis_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestCost(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limiter := httprate.Limit(100, time.Hour, httprate.WithLimitCounter(limitCounter))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cheap := limiter(handler)
+	expensive := httprateredis.Cost(30)(limiter(handler))
+
+	tests := []struct {
+		handler http.Handler
+		status  int
+		used    int
+	}{
+		{handler: expensive, status: http.StatusOK, used: 30},
+		{handler: cheap, status: http.StatusOK, used: 31},
+		{handler: expensive, status: http.StatusOK, used: 61},
+		{handler: expensive, status: http.StatusOK, used: 91},
+		{handler: expensive, status: http.StatusTooManyRequests, used: 91}, // The whole cost doesn't fit.
+		{handler: cheap, status: http.StatusOK, used: 92},
+	}
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != tt.status {
+			t.Errorf("request %d: unexpected status %v, expected %v", i, rec.Code, tt.status)
+		}
+		// httprate.Limit without key funcs limits all requests by the "*" key.
+		used, err := limitCounter.Peek(context.Background(), "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tt.used {
+			t.Errorf("request %d: unexpected used = %v, expected %v", i, used, tt.used)
+		}
+	}
+}
+
+func TestLargeIncrements(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Hour)
+
+	currentWindow := time.Now().UTC().Truncate(time.Hour)
+	previousWindow := currentWindow.Add(-time.Hour)
+
+	// Way over the int32 range.
+	const cost = 1 << 40
+	for i := 0; i < 1000; i++ {
+		if err := limitCounter.IncrementBy("key:large", currentWindow, cost); err != nil {
+			t.Fatal(err)
+		}
+		if err := limitCounter.IncrementBy("key:large", previousWindow, 2*cost); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	curr, prev, err := limitCounter.Get("key:large", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 1000*cost || prev != 2000*cost {
+		t.Errorf("unexpected counts curr = %v, prev = %v, expected %v and %v", curr, prev, 1000*cost, 2000*cost)
+	}
+
+	remaining, err := limitCounter.Remaining(context.Background(), "key:large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("unexpected remaining = %v, expected 0", remaining)
+	}
+}
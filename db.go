@@ -0,0 +1,60 @@
+package httprateredis
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dbClients are the clients of the logical databases of DBForKey, one pool per
+// database, so no connection ever changes its database by SELECT and leaks it
+// back into a pool. They're created on first use.
+type dbClients struct {
+	mu        sync.Mutex
+	clients   map[int]redis.UniversalClient
+	newClient func(db int) redis.UniversalClient
+}
+
+func (d *dbClients) get(db int) redis.UniversalClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	client, ok := d.clients[db]
+	if !ok {
+		if d.clients == nil {
+			d.clients = map[int]redis.UniversalClient{}
+		}
+		client = d.newClient(db)
+		d.clients[db] = client
+	}
+	return client
+}
+
+func (d *dbClients) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, client := range d.clients {
+		client.Close()
+	}
+}
+
+// clientFor returns the client of the database of the given rate-limit key.
+func (c *redisCounter) clientFor(key string) redis.UniversalClient {
+	if c.dbForKey == nil || c.dbs.newClient == nil {
+		return c.client
+	}
+	db := c.dbForKey(key)
+	if db == c.dbIndex {
+		return c.client
+	}
+	return c.dbs.get(db)
+}
+
+// readKey is like read for the database of the given rate-limit key. The
+// replicas are used for the keys of DBIndex only.
+func (c *redisCounter) readKey(ctx context.Context, key string, fn func(client redis.Cmdable) error) error {
+	if client := c.clientFor(key); client != c.client {
+		return fn(client)
+	}
+	return c.read(ctx, fn)
+}
@@ -0,0 +1,186 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestDBForKey(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:    redis.Host(),
+		Port:    uint16(redisPort),
+		DBIndex: 1,
+		DBForKey: func(key string) int {
+			if strings.HasPrefix(key, "tenant-a:") {
+				return 2
+			}
+			return 1
+		},
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// Interleave the operations of both databases on the pools.
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.IncrementBy("tenant-a:key", currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := limitCounter.IncrementBy("tenant-b:key", currentWindow, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, expected := range map[string]int{"tenant-a:key": 3, "tenant-b:key": 6} {
+		curr, _, err := limitCounter.Get(key, currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != expected {
+			t.Errorf("%v: unexpected curr = %v, expected %v", key, curr, expected)
+		}
+	}
+
+	for db, expected := range map[int]int{0: 0, 1: 1, 2: 1} {
+		if keys := redis.DB(db).Keys(); len(keys) != expected {
+			t.Errorf("unexpected keys %v in db %v, expected %v", keys, db, expected)
+		}
+	}
+
+	if err := limitCounter.Reset(context.Background(), "tenant-a:key"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := redis.DB(2).Keys(); len(keys) != 0 {
+		t.Errorf("unexpected keys %v in db 2 after Reset, expected none", keys)
+	}
+	if keys := redis.DB(1).Keys(); len(keys) != 1 {
+		t.Errorf("unexpected keys %v in db 1, expected the other tenant untouched", keys)
+	}
+}
+
+// TestDBForKeyModes runs the operations of each mode on the key of one tenant
+// and then of the other, expecting the keys in the database of each only.
+func TestDBForKeyModes(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	tests := []struct {
+		name string
+		cfg  httprateredis.Config
+	}{
+		{name: "sliding window"},
+		{name: "window buckets", cfg: httprateredis.Config{WindowBuckets: 4}},
+		{name: "sliding log", cfg: httprateredis.Config{Mode: httprateredis.ModeSlidingLog}},
+		{name: "token bucket", cfg: httprateredis.Config{Mode: httprateredis.ModeTokenBucket, RefillRate: 10, Burst: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis.FlushAll()
+			cfg := tt.cfg
+			cfg.Host = redis.Host()
+			cfg.Port = uint16(redisPort)
+			cfg.DBIndex = 1
+			cfg.DBForKey = func(key string) int {
+				if strings.HasPrefix(key, "tenant-a:") {
+					return 2
+				}
+				return 1
+			}
+			cfg.MaxInFlight = 10
+			cfg.FallbackDisabled = true
+			limitCounter := httprateredis.NewCounter(&cfg)
+			defer limitCounter.Close()
+			limitCounter.Config(1000, time.Minute)
+
+			ctx := context.Background()
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			previousWindow := currentWindow.Add(-time.Minute)
+
+			run := func(key string) {
+				t.Helper()
+				if err := limitCounter.IncrementBy(key, currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := limitCounter.AllowN(ctx, key, 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := limitCounter.IncrementOnce(ctx, key, "request", currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := limitCounter.IncrementManyBy(ctx, []string{key}, currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+				release, ok, err := limitCounter.Acquire(ctx, key)
+				if err != nil || !ok {
+					t.Fatalf("unexpected Acquire() = %v, %v", ok, err)
+				}
+				release()
+
+				curr, _, err := limitCounter.Get(key, currentWindow, previousWindow)
+				if err != nil {
+					t.Fatal(err)
+				}
+				results, err := limitCounter.GetMany(ctx, []string{key}, currentWindow, previousWindow)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if curr != 4 || results[0].Curr != 4 {
+					t.Errorf("%v: unexpected Get() curr = %v, GetMany() curr = %v, expected 4", key, curr, results[0].Curr)
+				}
+			}
+
+			run("tenant-a:key")
+			tenantA := redis.DB(2).Keys()
+			if len(tenantA) == 0 {
+				t.Error("no keys in db 2, expected the keys of tenant-a")
+			}
+			for _, db := range []int{0, 1} {
+				if keys := redis.DB(db).Keys(); len(keys) != 0 {
+					t.Errorf("unexpected keys %v of tenant-a in db %v", keys, db)
+				}
+			}
+
+			run("tenant-b:key")
+			if keys := redis.DB(2).Keys(); len(keys) != len(tenantA) {
+				t.Errorf("unexpected keys %v in db 2, expected the keys %v of tenant-a only", keys, tenantA)
+			}
+			if len(redis.DB(1).Keys()) == 0 {
+				t.Error("no keys in db 1, expected the keys of tenant-b")
+			}
+
+			// Both databases in a single call.
+			keys := []string{"tenant-a:key", "tenant-b:key"}
+			if err := limitCounter.IncrementManyBy(ctx, keys, currentWindow, 1); err != nil {
+				t.Fatal(err)
+			}
+			results, err := limitCounter.GetMany(ctx, keys, currentWindow, previousWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, result := range results {
+				if result.Curr != 5 {
+					t.Errorf("%v: unexpected GetMany() curr = %v, expected 5", result.Key, result.Curr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// decrementScript decrements the counter by ARGV[1], clamped at 0, atomically,
+// so concurrent refunds never leave a negative count to the rate math. Missing
+// counters are not created. It returns the decremented count.
+var decrementScript = newScript("decrement", `
+local count = tonumber(redis.call('GET', KEYS[1]))
+if not count then
+	return 0
+end
+return redis.call('DECRBY', KEYS[1], math.max(0, math.min(count, tonumber(ARGV[1]))))
+`)
+
+var errDecrementMode = errors.New("httprateredis: DecrementBy is supported in ModeSlidingWindow only")
+
+// DecrementBy refunds n requests of the given rate-limit key counted in the
+// current window by IncrementBy, e.g. when the request failed downstream. The
+// counter never goes below 0 and keeps its TTL. The window is the one passed to
+// IncrementBy, with WindowBuckets the current bucket is decremented instead.
+//
+// While the local in-memory fallback is serving the requests, the fallback
+// counter is decremented instead, clamped at 0 too but not atomically, and with
+// FallbackResync the refund is netted against the buffered increments. Redis
+// errors are returned, the refund is lost then.
+func (c *redisCounter) DecrementBy(ctx context.Context, key string, window time.Time, n int) (err error) {
+	if c.mode != "" && c.mode != ModeSlidingWindow {
+		return errDecrementMode
+	}
+	if n <= 0 {
+		return nil
+	}
+	window, _ = c.windowsOf(key, window, window)
+	if !c.begin() {
+		return errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return nil
+	}
+	if c.fallbackCounter != nil && c.breaker.isOpen() {
+		return c.fallbackDecrementBy(key, window, n)
+	}
+
+	_, windowLength := c.limits(key)
+	hkey := c.incrementKey(key, window, windowLength)
+
+	err = c.withRetry(ctx, false, func() error {
+		return c.runScriptOn(ctx, c.clientFor(key), decrementScript, []string{hkey}, n).Err()
+	})
+	if err != nil {
+		return c.commandError(ctx, "redis decr failed", err)
+	}
+	return nil
+}
+
+func (c *redisCounter) fallbackDecrementBy(key string, window time.Time, n int) error {
+	curr, _, err := c.fallbackGet(key, window, window)
+	if err != nil {
+		return err
+	}
+	if n = min(n, curr); n == 0 {
+		return nil
+	}
+	return c.fallbackIncrementBy(key, window, -n)
+}
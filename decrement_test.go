@@ -0,0 +1,82 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestDecrementBy(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	ctx := context.Background()
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	assertCurr := func(key string, expected int) {
+		t.Helper()
+		curr, _, err := limitCounter.Get(key, currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != expected {
+			t.Errorf("unexpected curr = %v, expected %v", curr, expected)
+		}
+	}
+
+	if err := limitCounter.IncrementBy("key:refund", currentWindow, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.DecrementBy(ctx, "key:refund", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	assertCurr("key:refund", 7)
+
+	// Concurrent refunds past zero floor the count at zero.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limitCounter.DecrementBy(ctx, "key:refund", currentWindow, 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	assertCurr("key:refund", 0)
+
+	// The refunded counter keeps its TTL, missing counters are not created.
+	if ttl := redis.TTL(redis.Keys()[0]); ttl <= 0 {
+		t.Errorf("unexpected ttl = %v, expected the TTL to be kept", ttl)
+	}
+	if err := limitCounter.DecrementBy(ctx, "key:missing", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if keys := redis.Keys(); len(keys) != 1 {
+		t.Errorf("unexpected keys %v, expected the missing counter not to be created", keys)
+	}
+
+	if err := limitCounter.IncrementBy("key:refund", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	assertCurr("key:refund", 2)
+}
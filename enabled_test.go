@@ -0,0 +1,78 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestSetEnabled(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var commands atomic.Int64
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		commands.Add(1)
+		return false
+	})
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		Disabled:         true,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	ctx := context.Background()
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	assertCounts := func(expectedCurr int) {
+		t.Helper()
+		curr, prev, err := limitCounter.Get("key:enabled", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != expectedCurr || prev != 0 {
+			t.Errorf("unexpected curr = %v, prev = %v, expected %v, 0", curr, prev, expectedCurr)
+		}
+	}
+
+	// Disabled: no Redis commands at all.
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.IncrementBy("key:enabled", currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertCounts(0)
+	if allowed, _, err := limitCounter.Take(ctx, "key:enabled", 1000); err != nil || !allowed {
+		t.Errorf("unexpected Take() = %v, %v, expected allowed", allowed, err)
+	}
+	if n := commands.Load(); n != 0 {
+		t.Errorf("unexpected %v Redis commands, expected none while disabled", n)
+	}
+
+	limitCounter.SetEnabled(true)
+	if err := limitCounter.IncrementBy("key:enabled", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(2)
+	if commands.Load() == 0 {
+		t.Error("expected Redis commands once enabled")
+	}
+
+	limitCounter.SetEnabled(false)
+	assertCounts(0)
+}
@@ -0,0 +1,131 @@
+package httprateredis
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of the environment variables read by ConfigFromEnv.
+const envPrefix = "HTTPRATE_REDIS_"
+
+// envAliases are the short names of the environment variables of the fields
+// most commonly set, which ConfigFromEnv reads in addition to the full names.
+var envAliases = map[string]string{
+	"db_index":    "DB",
+	"prefix_key":  "PREFIX",
+	"tls_enabled": "TLS",
+}
+
+// ConfigFromEnv returns the Config set by the HTTPRATE_REDIS_* environment
+// variables, e.g. for 12-factor deployments. Each field with a toml tag is read
+// from the variable named HTTPRATE_REDIS_ followed by the upper-cased tag, e.g.
+// HTTPRATE_REDIS_HOST, HTTPRATE_REDIS_PORT, HTTPRATE_REDIS_PASSWORD or
+// HTTPRATE_REDIS_FALLBACK_DISABLED. HTTPRATE_REDIS_DB, HTTPRATE_REDIS_PREFIX and
+// HTTPRATE_REDIS_TLS are the short names of DBIndex, PrefixKey and TLSEnabled;
+// setting both names of a field is an error.
+//
+// The values are parsed by the field types: durations by time.ParseDuration
+// (e.g. "500ms"), bools by strconv.ParseBool (e.g. "true" or "1"), numbers in
+// decimal and lists (e.g. HTTPRATE_REDIS_CLUSTER_ADDRS) as comma-separated
+// values. Unset or empty variables leave the fields zero, i.e. at the defaults
+// documented on Config. Invalid values and invalid configs return an error
+// wrapping ErrInvalidConfig, naming the variable.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{}
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("toml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, value, err := lookupEnv(tag)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			continue
+		}
+		if err := setEnvField(v.Field(i), value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, name, err)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// lookupEnv returns the name and value of the environment variable of the
+// field with the toml tag, by its full or short name.
+func lookupEnv(tag string) (name, value string, err error) {
+	name = envPrefix + strings.ToUpper(tag)
+	value = os.Getenv(name)
+	if alias, ok := envAliases[tag]; ok {
+		aliasName := envPrefix + alias
+		if aliasValue := os.Getenv(aliasName); aliasValue != "" {
+			if value != "" {
+				return "", "", fmt.Errorf("%w: both %s and %s are set", ErrInvalidConfig, aliasName, name)
+			}
+			return aliasName, aliasValue, nil
+		}
+	}
+	return name, value, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setEnvField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.ParseInt(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Uint16:
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var values []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %v", field.Type())
+	}
+	return nil
+}
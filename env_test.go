@@ -0,0 +1,111 @@
+package httprateredis_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected httprateredis.Config
+		err      string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "parsing",
+			env: map[string]string{
+				"HTTPRATE_REDIS_HOST":              "redis.internal",
+				"HTTPRATE_REDIS_PORT":              "6380",
+				"HTTPRATE_REDIS_DB":                "2",
+				"HTTPRATE_REDIS_PASSWORD":          "secret",
+				"HTTPRATE_REDIS_PREFIX":            "checkout",
+				"HTTPRATE_REDIS_TLS":               "true",
+				"HTTPRATE_REDIS_FALLBACK_DISABLED": "1",
+				"HTTPRATE_REDIS_FALLBACK_TIMEOUT":  "250ms",
+				"HTTPRATE_REDIS_WARN_THRESHOLD":    "0.8",
+				"HTTPRATE_REDIS_MODE":              "token_bucket",
+				"HTTPRATE_REDIS_REPLICA_ADDRS":     "replica-1:6379, replica-2:6379",
+				"HTTPRATE_REDIS_CLIENT_NAME":       "",
+			},
+			expected: httprateredis.Config{
+				Host:             "redis.internal",
+				Port:             6380,
+				DBIndex:          2,
+				Password:         "secret",
+				PrefixKey:        "checkout",
+				TLSEnabled:       true,
+				FallbackDisabled: true,
+				FallbackTimeout:  250 * time.Millisecond,
+				WarnThreshold:    0.8,
+				Mode:             httprateredis.ModeTokenBucket,
+				ReplicaAddrs:     []string{"replica-1:6379", "replica-2:6379"},
+			},
+		},
+		{
+			name:     "full names",
+			env:      map[string]string{"HTTPRATE_REDIS_DB_INDEX": "3", "HTTPRATE_REDIS_PREFIX_KEY": "api"},
+			expected: httprateredis.Config{DBIndex: 3, PrefixKey: "api"},
+		},
+		{
+			name: "both names",
+			env:  map[string]string{"HTTPRATE_REDIS_DB_INDEX": "3", "HTTPRATE_REDIS_DB": "3"},
+			err:  "HTTPRATE_REDIS_DB",
+		},
+		{
+			name: "invalid port",
+			env:  map[string]string{"HTTPRATE_REDIS_PORT": "65536"},
+			err:  "HTTPRATE_REDIS_PORT",
+		},
+		{
+			name: "invalid bool",
+			env:  map[string]string{"HTTPRATE_REDIS_TLS": "yes"},
+			err:  "HTTPRATE_REDIS_TLS",
+		},
+		{
+			name: "invalid duration",
+			env:  map[string]string{"HTTPRATE_REDIS_KEY_TTL": "10"},
+			err:  "HTTPRATE_REDIS_KEY_TTL",
+		},
+		{
+			name: "invalid integer",
+			env:  map[string]string{"HTTPRATE_REDIS_MAX_RETRIES": "three"},
+			err:  "HTTPRATE_REDIS_MAX_RETRIES",
+		},
+		{
+			name: "invalid config",
+			env:  map[string]string{"HTTPRATE_REDIS_FALLBACK_MAX_KEYS": "-1"},
+			err:  "fallback_max_keys",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := httprateredis.ConfigFromEnv()
+			if tt.err != "" {
+				if !errors.Is(err, httprateredis.ErrInvalidConfig) || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("unexpected error %v, expected %v naming %s", err, httprateredis.ErrInvalidConfig, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*cfg, tt.expected) {
+				t.Errorf("unexpected config %+v, expected %+v", *cfg, tt.expected)
+			}
+		})
+	}
+}
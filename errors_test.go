@@ -0,0 +1,163 @@
+package httprateredis_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestErrors(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  200 * time.Millisecond,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// Error reply to the command itself.
+	if err := limitCounter.Increment("key:errors", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	key := redis.Keys()[0]
+	redis.Del(key)
+	if _, err := redis.Push(key, "not a counter"); err != nil {
+		t.Fatal(err)
+	}
+	err = limitCounter.Increment("key:errors", currentWindow)
+	if err == nil || errors.Is(err, httprateredis.ErrRedisUnavailable) {
+		t.Errorf("unexpected error %v, expected WRONGTYPE error not wrapping %v", err, httprateredis.ErrRedisUnavailable)
+	}
+
+	// Redis is loading its dataset.
+	redis.SetError("LOADING Redis is loading the dataset in memory")
+	if _, _, err := limitCounter.Get("key:errors", currentWindow, previousWindow); !errors.Is(err, httprateredis.ErrRedisUnavailable) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrRedisUnavailable)
+	}
+	redis.SetError("")
+
+	// Redis is down.
+	redis.Close()
+	if err := limitCounter.Increment("key:errors", currentWindow); !errors.Is(err, httprateredis.ErrRedisUnavailable) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrRedisUnavailable)
+	}
+	if _, _, err := limitCounter.Get("key:errors", currentWindow, previousWindow); !errors.Is(err, httprateredis.ErrRedisUnavailable) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrRedisUnavailable)
+	}
+}
+
+func TestErrFallback(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var onErrorErr, onFallbackErr error
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  time.Minute,
+		OnError:         func(err error) { onErrorErr = err },
+		OnFallback:      func(err error) { onFallbackErr = err },
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	redis.Close()
+
+	// Served by the fallback, so no error is returned.
+	if err := limitCounter.Increment("key:fallback", time.Now().UTC().Truncate(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range map[string]error{"OnError": onErrorErr, "OnFallback": onFallbackErr} {
+		if !errors.Is(err, httprateredis.ErrFallback) || !errors.Is(err, httprateredis.ErrRedisUnavailable) {
+			t.Errorf("%s: unexpected error %v, expected %v and %v", name, err, httprateredis.ErrFallback, httprateredis.ErrRedisUnavailable)
+		}
+	}
+	if !limitCounter.IsFallbackActivated() {
+		t.Error("fallback should be activated")
+	}
+}
+
+func TestRedisOutOfMemory(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback bool
+		allow    bool
+		err      bool
+	}{
+		{name: "fail-closed", err: true},
+		{name: "fail-open", allow: true},
+		{name: "fallback", fallback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer redis.Close()
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			// Redis at maxmemory with the noeviction policy rejects the writes only.
+			redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+				if cmd == "EVALSHA" || cmd == "EVAL" {
+					c.WriteError("OOM command not allowed when used memory > 'maxmemory'.")
+					return true
+				}
+				return false
+			})
+
+			var onErrorErr error
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				FallbackTimeout:  200 * time.Millisecond,
+				FallbackDisabled: !tt.fallback,
+				OnErrorAllow:     tt.allow,
+				OnError:          func(err error) { onErrorErr = err },
+			})
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+
+			err = limitCounter.Increment("key:oom", time.Now().UTC().Truncate(time.Minute))
+			if tt.err {
+				if !errors.Is(err, httprateredis.ErrRedisOutOfMemory) || errors.Is(err, httprateredis.ErrRedisUnavailable) {
+					t.Errorf("unexpected error %v, expected %v only", err, httprateredis.ErrRedisOutOfMemory)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(onErrorErr, httprateredis.ErrRedisOutOfMemory) {
+				t.Errorf("OnError: unexpected error %v, expected %v", onErrorErr, httprateredis.ErrRedisOutOfMemory)
+			}
+			if tt.fallback && !errors.Is(onErrorErr, httprateredis.ErrFallback) {
+				t.Errorf("OnError: unexpected error %v, expected %v", onErrorErr, httprateredis.ErrFallback)
+			}
+		})
+	}
+}
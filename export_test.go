@@ -0,0 +1,109 @@
+package httprateredis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BreakerState exposes the circuit breaker state to tests.
+func (c *redisCounter) BreakerState() string {
+	return breakerState(c.breaker.state.Load()).String()
+}
+
+// FallbackLen exposes the number of keys of the bounded local fallback to tests.
+func (c *redisCounter) FallbackLen() int {
+	return c.fallbackCounter.(*lruCounter).Len()
+}
+
+// LimitCounterKey exposes the Redis keys of the window counters to tests.
+func (c *redisCounter) LimitCounterKey(key string, window time.Time) string {
+	return c.limitCounterKey(key, window)
+}
+
+// StateKey exposes the Redis keys of the rate-limit key states to tests.
+func (c *redisCounter) StateKey(key, kind string) string {
+	return c.stateKey(key, kind)
+}
+
+// ShardOf exposes the consistent hash of ShardAddrs to tests.
+func ShardOf(shards []string, virtualNodes int) func(key string) string {
+	return newHashRing(shards, virtualNodes).Get
+}
+
+// FailureInjector makes the Redis round-trips of a counter fail on demand, so
+// tests can exercise the fallback, retry and circuit breaker paths without a
+// real outage, see InjectFailures.
+type FailureInjector struct {
+	mu  sync.Mutex
+	n   int
+	err error
+}
+
+var _ redis.Hook = (*FailureInjector)(nil)
+
+// InjectFailures installs a FailureInjector on the client of the counter. It
+// must be called before the counter is used, as go-redis hooks can't be added
+// concurrently with the commands.
+func (c *redisCounter) InjectFailures() *FailureInjector {
+	f := &FailureInjector{}
+	c.client.AddHook(f)
+	return f
+}
+
+// FailNext makes the next n round-trips fail with err without reaching Redis.
+// A pipeline (or a transaction) is a single round-trip, as is each attempt of
+// a retried command.
+func (f *FailureInjector) FailNext(n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n, f.err = n, err
+}
+
+// Remaining returns the number of round-trips yet to fail.
+func (f *FailureInjector) Remaining() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.n
+}
+
+func (f *FailureInjector) next() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == 0 {
+		return nil
+	}
+	f.n--
+	return f.err
+}
+
+func (f *FailureInjector) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (f *FailureInjector) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := f.next(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (f *FailureInjector) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := f.next(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
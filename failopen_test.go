@@ -0,0 +1,63 @@
+package httprateredis_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestOnErrorAllow(t *testing.T) {
+	tests := []struct {
+		name         string
+		onErrorAllow bool
+		status       int
+	}{
+		{name: "fail-closed", onErrorAllow: false, status: http.StatusPreconditionRequired},
+		{name: "fail-open", onErrorAllow: true, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			var onErrorCalled bool
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				FallbackTimeout:  200 * time.Millisecond,
+				FallbackDisabled: true,
+				OnErrorAllow:     tt.onErrorAllow,
+				OnError:          func(err error) { onErrorCalled = true },
+			})
+			defer limitCounter.Close()
+
+			h := httprate.Limit(1, time.Minute, httprate.WithLimitCounter(limitCounter))(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			)
+
+			redis.Close()
+
+			// Both requests would be over the limit of 1 in case Redis was up.
+			for i := 0; i < 2; i++ {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+				if rec.Code != tt.status {
+					t.Errorf("request %d: unexpected status %v, expected %v", i, rec.Code, tt.status)
+				}
+			}
+			if tt.onErrorAllow && !onErrorCalled {
+				t.Error("onError() should be called when failing open")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// fallbackOptions are the circuit breaker and error handling options of a
+// counter, the same for the Redis and the Upstash counters.
+type fallbackOptions struct {
+	failureThreshold int32
+	cooldownPeriod   time.Duration
+	halfOpenProbes   int
+	onErrorAllow     bool
+	tracer           Tracer
+	logger           Logger
+	onError          func(err error)
+	onFallback       func(err error)
+	onFallbackChange func(activated bool)
+}
+
+// newFallbackOptions returns the options of cfg, with the defaults of
+// FailureThreshold, CooldownPeriod and HalfOpenProbes. The fallback hooks are
+// set only if the counter has a fallback.
+func newFallbackOptions(cfg *Config, fallback bool) fallbackOptions {
+	opts := fallbackOptions{
+		failureThreshold: int32(max(cfg.FailureThreshold, 1)),
+		cooldownPeriod:   cfg.CooldownPeriod,
+		halfOpenProbes:   max(cfg.HalfOpenProbes, 1),
+		onErrorAllow:     cfg.OnErrorAllow,
+		tracer:           cfg.Tracer,
+		logger:           noopLogger{},
+		onError:          func(err error) {},
+		onFallback:       func(err error) {},
+		onFallbackChange: func(activated bool) {},
+	}
+	if opts.cooldownPeriod <= 0 {
+		opts.cooldownPeriod = 200 * time.Millisecond
+	}
+	if cfg.Logger != nil {
+		opts.logger = cfg.Logger
+	} else if cfg.Slog != nil {
+		opts.logger = slogLogger{cfg.Slog.With("prefix", cfg.PrefixKey, "db", cfg.DBIndex)}
+	}
+	if cfg.OnError != nil {
+		opts.onError = cfg.OnError
+	}
+	if fallback {
+		if cfg.OnFallback != nil {
+			opts.onFallback = cfg.OnFallback
+		}
+		if cfg.OnFallbackChange != nil {
+			opts.onFallbackChange = cfg.OnFallbackChange
+		}
+	}
+	return opts
+}
+
+// fallback is the local in-memory counter serving the requests while the
+// circuit breaker guarding the backend is open, see shouldFallback.
+type fallback struct {
+	breaker         breaker
+	fallbackCounter httprate.LimitCounter // nil if the fallback is disabled
+	fallbackMu      sync.RWMutex          // guards fallbackCounter.Config
+	activations     atomic.Int64
+	opts            *fallbackOptions
+	backend         string          // named in the logs, e.g. "Redis"
+	probe           func() error    // checks the backend while the breaker is open
+	healthy         func()          // called once the breaker closes, if set
+	stop            <-chan struct{} // stops the probes, closed by Close
+}
+
+// initFallback sets up the breaker by opts, probing the backend by probe until
+// stop is closed. The fallback counter is set by the caller.
+func (f *fallback) initFallback(opts *fallbackOptions, backend string, stop <-chan struct{}, probe func() error) {
+	f.opts = opts
+	f.backend = backend
+	f.stop = stop
+	f.probe = probe
+	f.breaker.failureThreshold = opts.failureThreshold
+	f.breaker.cooldownPeriod = opts.cooldownPeriod
+	f.breaker.halfOpenProbes = opts.halfOpenProbes
+}
+
+// configFallback configures the fallback counter, if any.
+func (f *fallback) configFallback(requestLimit int, windowLength time.Duration) {
+	if f.fallbackCounter != nil {
+		// The local counter is not safe to reconfigure concurrently.
+		f.fallbackMu.Lock()
+		f.fallbackCounter.Config(requestLimit, windowLength)
+		f.fallbackMu.Unlock()
+	}
+}
+
+func (f *fallback) fallbackIncrementBy(key string, currentWindow time.Time, amount int) error {
+	f.fallbackMu.RLock()
+	defer f.fallbackMu.RUnlock()
+	return f.fallbackCounter.IncrementBy(key, currentWindow, amount)
+}
+
+func (f *fallback) fallbackGet(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	f.fallbackMu.RLock()
+	defer f.fallbackMu.RUnlock()
+	return f.fallbackCounter.Get(key, currentWindow, previousWindow)
+}
+
+// shouldFallback records the result of a backend command in the breaker and
+// reports whether the request should be served by the fallback counter.
+func (f *fallback) shouldFallback(ctx context.Context, err error) bool {
+	if err == nil {
+		f.breaker.success()
+		return false
+	}
+	// The counter was closed while the command was running.
+	if errors.Is(err, ErrClosed) {
+		return false
+	}
+	err = fmt.Errorf("%w: %w", ErrFallback, err)
+	f.opts.onError(err)
+	f.opts.onFallback(err)
+
+	// The caller gave up on the request, which doesn't mean the backend is
+	// down. Serve this request from the local counter without activating the
+	// fallback.
+	if contextError(ctx) != nil {
+		return true
+	}
+
+	// Activate the local in-memory counter fallback once the breaker opens,
+	// unless opened by some other goroutine. Until then, each failed command
+	// is still served by the local counter.
+	if f.breaker.failure() {
+		f.activations.Add(1)
+		f.opts.logger.Errorf("httprateredis: local in-memory fallback activated: %v", err)
+		f.opts.onFallbackChange(true)
+		go f.reconnect()
+	}
+
+	return true
+}
+
+func (f *fallback) reconnect() {
+	if !f.breaker.closeWhenHealthy(f.stop, f.probe) {
+		return
+	}
+	f.opts.logger.Debugf("httprateredis: local in-memory fallback deactivated, %s is healthy again", f.backend)
+	f.opts.onFallbackChange(false)
+	if f.healthy != nil {
+		f.healthy()
+	}
+}
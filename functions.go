@@ -0,0 +1,124 @@
+package httprateredis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zeebo/xxh3"
+)
+
+// scriptFunctions are the Lua scripts registered by newScript, which make up
+// the Redis Functions library of UseFunctions.
+var scriptFunctions = map[*redis.Script]*scriptFunction{}
+
+type scriptFunction struct {
+	name string
+	src  string
+}
+
+// newScript returns the Lua script run via EVALSHA, which is also registered
+// as a function named name in the Redis Functions library of UseFunctions.
+func newScript(name, src string) *redis.Script {
+	script := redis.NewScript(src)
+	scriptFunctions[script] = &scriptFunction{name: name, src: src}
+	return script
+}
+
+var (
+	functionLibraryOnce sync.Once
+	functionLibraryName string
+	functionLibraryCode string
+)
+
+// functionLibrary returns the name and code of the Redis Functions library.
+// The library and function names are suffixed by the hash of the scripts, so
+// counters of different versions never replace the functions of each other
+// (e.g. during rolling deployments), and loading it is idempotent.
+func functionLibrary() (name, code string) {
+	functionLibraryOnce.Do(func() {
+		fns := make([]*scriptFunction, 0, len(scriptFunctions))
+		for _, fn := range scriptFunctions {
+			fns = append(fns, fn)
+		}
+		sort.Slice(fns, func(i, j int) bool { return fns[i].name < fns[j].name })
+
+		h := xxh3.New()
+		for _, fn := range fns {
+			h.WriteString(fn.name)
+			h.WriteString(fn.src)
+		}
+		functionLibraryName = fmt.Sprintf("httprate_%x", h.Sum64())
+
+		var code strings.Builder
+		fmt.Fprintf(&code, "#!lua name=%s\n", functionLibraryName)
+		for _, fn := range fns {
+			fmt.Fprintf(&code, "redis.register_function('%s_%s', function(KEYS, ARGV)\n%s\nend)\n", functionLibraryName, fn.name, fn.src)
+		}
+		functionLibraryCode = code.String()
+	})
+	return functionLibraryName, functionLibraryCode
+}
+
+// functionName returns the name of the script function in the library.
+func functionName(script *redis.Script) string {
+	library, _ := functionLibrary()
+	return library + "_" + scriptFunctions[script].name
+}
+
+// loadFunctions loads the Redis Functions library, on all masters in cluster
+// mode and on all shards of ShardAddrs. Concurrent callers share the same load, so a restarted Redis (or a
+// FUNCTION FLUSH) doesn't cause a storm of loads.
+func (c *redisCounter) loadFunctions(ctx context.Context) error {
+	_, err, _ := c.functionsLoad.Do("load", func() (any, error) {
+		return nil, c.loadFunctionsOnce(ctx)
+	})
+	return err
+}
+
+func (c *redisCounter) loadFunctionsOnce(ctx context.Context) error {
+	_, code := functionLibrary()
+	load := func(ctx context.Context, client redis.Cmdable) error {
+		err := client.FunctionLoad(ctx, code).Err()
+		if err != nil && strings.Contains(err.Error(), "already exists") {
+			return nil
+		}
+		return err
+	}
+	switch client := c.client.(type) {
+	case *redis.ClusterClient:
+		return client.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return load(ctx, client)
+		})
+	case *redis.Ring:
+		return client.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+			return load(ctx, client)
+		})
+	}
+	return load(ctx, c.client)
+}
+
+// isFunctionNotFound reports whether the FCALL failed as the library is not
+// loaded, see loadFunctions.
+func isFunctionNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Function not found")
+}
+
+// fcall runs the script function via FCALL, loading the library when it's
+// missing, e.g. after a Redis restart or failover.
+func (c *redisCounter) fcall(ctx context.Context, client redis.Cmdable, script *redis.Script, keys []string, args ...any) *redis.Cmd {
+	name := functionName(script)
+	cmd := client.FCall(ctx, name, keys, args...)
+	if !isFunctionNotFound(cmd.Err()) {
+		return cmd
+	}
+	c.logger.Debugf("httprateredis: function %s not loaded, loading", name)
+	if err := c.loadFunctions(ctx); err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+	return client.FCall(ctx, name, keys, args...)
+}
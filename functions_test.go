@@ -0,0 +1,179 @@
+package httprateredis_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestUseFunctions(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	redisPort, _ := strconv.Atoi(mr.Port())
+	functions := newFunctionsFixture(t, mr)
+
+	limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Host:             mr.Host(),
+		Port:             uint16(redisPort),
+		UseFunctions:     true,
+		FallbackDisabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	ctx := context.Background()
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	assertCurr := func(key string, expected int) {
+		t.Helper()
+		curr, _, err := limitCounter.Get(key, currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != expected {
+			t.Errorf("unexpected curr = %v, expected %v", curr, expected)
+		}
+	}
+
+	if err := limitCounter.IncrementBy("key:fn", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	assertCurr("key:fn", 3)
+	if err := limitCounter.IncrementManyBy(ctx, []string{"key:fn", "key:many"}, currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	assertCurr("key:fn", 5)
+	assertCurr("key:many", 2)
+	if allowed, _, err := limitCounter.Take(ctx, "key:fn", 1); err != nil || !allowed {
+		t.Errorf("unexpected Take() = %v, %v, expected allowed", allowed, err)
+	}
+	if loads := functions.loads.Load(); loads != 1 {
+		t.Errorf("unexpected %v FUNCTION LOAD calls, expected 1", loads)
+	}
+
+	// Functions are reloaded once after a FUNCTION FLUSH, e.g. of a restart.
+	functions.flush()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limitCounter.IncrementBy("key:fn", currentWindow, 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	assertCurr("key:fn", 25)
+	if loads := functions.loads.Load(); loads < 2 || loads > 21 {
+		t.Errorf("unexpected %v FUNCTION LOAD calls, expected the library to be reloaded", loads)
+	}
+	if len(functions.libraries) != 1 {
+		t.Errorf("unexpected libraries %v, expected 1", functions.libraries)
+	}
+}
+
+// functionsFixture emulates FUNCTION LOAD and FCALL on miniredis, which doesn't
+// support Redis Functions, by running the registered functions via EVAL.
+type functionsFixture struct {
+	mu        sync.Mutex
+	libraries map[string]string
+	functions map[string]string
+	loads     atomic.Int64
+	client    *redis.Client
+}
+
+var registerFunctionRe = regexp.MustCompile(`(?s)redis\.register_function\('(\w+)', function\(KEYS, ARGV\)\n(.*?)\nend\)\n`)
+
+func newFunctionsFixture(t *testing.T, mr *miniredis.Miniredis) *functionsFixture {
+	f := &functionsFixture{
+		libraries: map[string]string{},
+		functions: map[string]string{},
+		client:    redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	t.Cleanup(func() { f.client.Close() })
+
+	mr.Server().Register("FUNCTION", func(c *server.Peer, cmd string, args []string) {
+		if len(args) < 2 || !strings.EqualFold(args[0], "LOAD") {
+			c.WriteError("ERR unsupported FUNCTION subcommand")
+			return
+		}
+		f.loads.Add(1)
+		code := args[len(args)-1]
+		name := strings.TrimPrefix(strings.SplitN(code, "\n", 2)[0], "#!lua name=")
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.libraries[name]; ok {
+			c.WriteError(fmt.Sprintf("ERR Library '%s' already exists", name))
+			return
+		}
+		f.libraries[name] = code
+		for _, m := range registerFunctionRe.FindAllStringSubmatch(code, -1) {
+			f.functions[m[1]] = m[2]
+		}
+		c.WriteBulk(name)
+	})
+	mr.Server().Register("FCALL", func(c *server.Peer, cmd string, args []string) {
+		f.mu.Lock()
+		src, ok := f.functions[args[0]]
+		f.mu.Unlock()
+		if !ok {
+			c.WriteError("ERR Function not found")
+			return
+		}
+		numKeys, _ := strconv.Atoi(args[1])
+		evalArgs := make([]any, 0, len(args)-2-numKeys)
+		for _, arg := range args[2+numKeys:] {
+			evalArgs = append(evalArgs, arg)
+		}
+		res, err := f.client.Eval(context.Background(), src, args[2:2+numKeys], evalArgs...).Result()
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		writeReply(c, res)
+	})
+	return f
+}
+
+func (f *functionsFixture) flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.libraries = map[string]string{}
+	f.functions = map[string]string{}
+}
+
+func writeReply(c *server.Peer, res any) {
+	switch v := res.(type) {
+	case int64:
+		c.WriteInt(int(v))
+	case string:
+		c.WriteBulk(v)
+	case []any:
+		c.WriteLen(len(v))
+		for _, elem := range v {
+			writeReply(c, elem)
+		}
+	default:
+		c.WriteNull()
+	}
+}
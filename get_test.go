@@ -0,0 +1,104 @@
+package httprateredis_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGetPartialWindows(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	redisPort, _ := strconv.Atoi(mr.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             mr.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:prev-only", previousWindow, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:curr-only", currentWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		curr int
+		prev int
+	}{
+		{key: "key:prev-only", curr: 0, prev: 4},
+		{key: "key:curr-only", curr: 5, prev: 0},
+		{key: "key:none", curr: 0, prev: 0},
+	}
+	for _, tt := range tests {
+		curr, prev, err := limitCounter.Get(tt.key, currentWindow, previousWindow)
+		if err != nil {
+			t.Errorf("%s: %v", tt.key, err)
+		}
+		if curr != tt.curr || prev != tt.prev {
+			t.Errorf("%s: unexpected curr = %v, prev = %v, expected %v, %v", tt.key, curr, prev, tt.curr, tt.prev)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer mr.Close()
+	redisPort, _ := strconv.Atoi(mr.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             mr.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	for i := 0; i < 100; i++ {
+		_ = limitCounter.IncrementBy(fmt.Sprintf("key:%v", i), previousWindow, 1)
+		_ = limitCounter.IncrementBy(fmt.Sprintf("key:%v", i), currentWindow, 1)
+	}
+
+	b.Run("MGET", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _, _ = limitCounter.Get(fmt.Sprintf("key:%v", i%100), currentWindow, previousWindow)
+		}
+	})
+
+	// Baseline: two separate round-trips per rate-limit check.
+	b.Run("GET+GET", func(b *testing.B) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+
+		ctx := context.Background()
+		for i := 0; i < b.N; i++ {
+			_ = client.Get(ctx, fmt.Sprintf("httprate:%v:curr", i%100)).Err()
+			_ = client.Get(ctx, fmt.Sprintf("httprate:%v:prev", i%100)).Err()
+		}
+	})
+}
@@ -7,7 +7,9 @@ toolchain go1.24.1
 require (
 	github.com/alicebob/miniredis/v2 v2.34.0
 	github.com/go-chi/httprate v0.15.0
-	github.com/redis/go-redis/v9 v9.7.3
+	github.com/redis/go-redis/v9 v9.12.1
+	github.com/redis/rueidis v1.0.69
+	github.com/zeebo/xxh3 v1.0.2
 	golang.org/x/sync v0.12.0
 )
 
@@ -17,6 +19,5 @@ require (
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/yuin/gopher-lua v1.1.1 // indirect
-	github.com/zeebo/xxh3 v1.0.2 // indirect
-	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
 )
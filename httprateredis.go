@@ -2,15 +2,74 @@ package httprateredis
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/httprate"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
+var (
+	// ErrAuthFailed is returned (wrapped) when Redis rejects the configured credentials.
+	ErrAuthFailed = errors.New("httprateredis: redis authentication failed")
+
+	// ErrRedisUnavailable is returned (wrapped) when Redis can't serve the command,
+	// e.g. on connection errors, timeouts or while Redis is loading its dataset.
+	// Error replies to the command itself (e.g. WRONGTYPE) are not wrapped.
+	ErrRedisUnavailable = errors.New("httprateredis: redis unavailable")
+
+	// ErrRedisOutOfMemory is returned (wrapped) when Redis rejects the increments
+	// by an OOM reply, i.e. it reached maxmemory with the noeviction policy. The
+	// reads still work. It's handled like any other Redis error, i.e. served by
+	// the local in-memory fallback or allowed with OnErrorAllow.
+	ErrRedisOutOfMemory = errors.New("httprateredis: redis out of memory")
+
+	// ErrFallback wraps the errors passed to OnError and OnFallback when the request
+	// was served by the local in-memory fallback. IncrementBy and Get return nil in
+	// that case, as httprate would respond with HTTP 428 otherwise.
+	ErrFallback = errors.New("httprateredis: served by local in-memory fallback")
+
+	// ErrClosed is returned (wrapped) by the counter operations after Close.
+	ErrClosed = errors.New("httprateredis: counter closed")
+
+	// ErrNoExpiry is returned by KeyTTL when the counter exists without a TTL.
+	ErrNoExpiry = errors.New("httprateredis: key has no expiry")
+
+	// ErrKeyNotFound is returned by KeyTTL when the counter doesn't exist, e.g.
+	// when there was no request of the key in the current window yet.
+	ErrKeyNotFound = errors.New("httprateredis: key not found")
+)
+
+// errRefused is the ErrClosed returned by the operations started after Close,
+// before any round-trip. The ErrClosed of the operations interrupted by Close
+// is wrapped by wrapError instead, so the two can be told apart.
+var errRefused = fmt.Errorf("%w", ErrClosed)
+
+var errNotConfigured = errors.New("httprateredis: limit counter is not configured, call Config() first")
+
+// incrementScript increments the counter and sets its TTL when the key is created,
+// atomically and in a single round-trip, so the key can never exist without a TTL.
+// Keys left without a TTL by anything else (e.g. non-atomic INCR+EXPIRE of older
+// clients) get the TTL on the next increment. It's sent via EVALSHA, falling back
+// to EVAL if Redis doesn't have the script cached (NOSCRIPT), or via FCALL with
+// UseFunctions.
+var incrementScript = newScript("increment", `
+local count = redis.call('INCRBY', KEYS[1], ARGV[1])
+if count == tonumber(ARGV[1]) or redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return count
+`)
+
 func WithRedisLimitCounter(cfg *Config) httprate.Option {
 	if cfg.Disabled {
 		return httprate.WithNoop()
@@ -19,14 +78,69 @@ func WithRedisLimitCounter(cfg *Config) httprate.Option {
 }
 
 func NewRedisLimitCounter(cfg *Config) (*redisCounter, error) {
-	c := NewCounter(cfg)
-	if err := c.client.Ping(context.Background()).Err(); err != nil {
-		return nil, fmt.Errorf("ping failed: %w", err)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	c := newCounter(cfg)
+	if err := c.Ping(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewCounterWithError is like NewCounter, but validates cfg first and, with
+// cfg.ConnectEagerly, pings Redis. Invalid fields are reported as ErrInvalidConfig.
+// Port can't be invalid, as it's unsigned and 0 means the default port.
+func NewCounterWithError(cfg *Config) (*redisCounter, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	c := newCounter(cfg)
+	if cfg != nil && cfg.ConnectEagerly {
+		if err := c.Ping(context.Background()); err != nil {
+			c.Close()
+			return nil, err
+		}
 	}
 	return c, nil
 }
 
+// NewCounterWithGoRedis is like NewCounter, but uses the given go-redis client
+// (e.g. *redis.Client, *redis.ClusterClient or *redis.Ring) shared with the
+// rest of the application. It's a shorthand for setting cfg.Client, so the
+// connection fields of cfg are ignored and Close() doesn't close the client.
+func NewCounterWithGoRedis(client redis.UniversalClient, cfg *Config) *redisCounter {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	c.Client = client
+	return NewCounter(&c)
+}
+
+// NewCounter returns a Redis-backed counter configured by cfg. The counter is
+// safe for concurrent use by multiple goroutines: all its methods may be called
+// concurrently, including Config, SetEnabled and Close, see there for how they
+// affect the operations in progress.
+//
+// NewCounter never blocks nor fails: by default, Redis is first contacted by
+// the first command, so the counter can be created before Redis is reachable.
+// With cfg.ConnectEagerly, it pings Redis and logs the error, if any, see
+// NewCounterWithError to get the error instead.
 func NewCounter(cfg *Config) *redisCounter {
+	rc := newCounter(cfg)
+	if cfg != nil && cfg.PasswordFunc != nil && cfg.Client == nil && (len(cfg.SentinelAddrs) > 0 || len(cfg.ShardAddrs) > 0) {
+		rc.logger.Errorf("httprateredis: PasswordFunc is not supported with SentinelAddrs nor ShardAddrs, using Password")
+	}
+	if cfg != nil && cfg.ConnectEagerly {
+		if err := rc.Ping(context.Background()); err != nil {
+			rc.logger.Errorf("httprateredis: connect eagerly: %v", err)
+		}
+	}
+	return rc
+}
+
+func newCounter(cfg *Config) *redisCounter {
 	if cfg == nil {
 		cfg = &Config{}
 	}
@@ -36,37 +150,104 @@ func NewCounter(cfg *Config) *redisCounter {
 	if cfg.Port < 1 {
 		cfg.Port = 6379
 	}
-	if cfg.PrefixKey == "" {
-		cfg.PrefixKey = "httprate"
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
 	}
-	if cfg.FallbackTimeout == 0 {
-		if cfg.FallbackDisabled {
-			cfg.FallbackTimeout = time.Second
-		} else {
-			// Activate local in-memory fallback fairly quickly,
-			// so we don't slow down incoming requests too much.
-			cfg.FallbackTimeout = 250 * time.Millisecond
-		}
+	if cfg.Protocol == 0 {
+		cfg.Protocol = 2
+	}
+	cfg.setBackendDefaults()
+	if cfg.ShardVirtualNodes <= 0 {
+		cfg.ShardVirtualNodes = defaultShardVirtualNodes
+	}
+	if cfg.InFlightTTL <= 0 {
+		cfg.InFlightTTL = defaultInFlightTTL
+	}
+	if cfg.DedupTTL <= 0 {
+		cfg.DedupTTL = defaultDedupTTL
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 8 * time.Millisecond
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 2 * cfg.FallbackTimeout
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = cfg.FallbackTimeout
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = cfg.FallbackTimeout
 	}
 
 	rc := &redisCounter{
-		prefixKey:  cfg.PrefixKey,
-		onError:    func(err error) {},
-		onFallback: func(activated bool) {},
+		prefixKey: cfg.PrefixKey,
+		done:      make(chan struct{}),
+		drained:   make(chan struct{}, 1),
+		counterOptions: &counterOptions{
+			keyTTL:          cfg.KeyTTL,
+			ttlJitter:       cfg.TTLJitter,
+			now:             time.Now,
+			limitFunc:       cfg.LimitFunc,
+			keyFunc:         cfg.KeyFunc,
+			dbForKey:        cfg.DBForKey,
+			dbIndex:         cfg.DBIndex,
+			dbs:             &dbClients{},
+			maxKeyLength:    cfg.MaxKeyLength,
+			windowBuckets:   cfg.WindowBuckets,
+			warnThreshold:   cfg.WarnThreshold,
+			mode:            cfg.Mode,
+			refillRate:      cfg.RefillRate,
+			burst:           cfg.Burst,
+			maxInFlight:     cfg.MaxInFlight,
+			inFlightTTL:     cfg.InFlightTTL,
+			dedupTTL:        cfg.DedupTTL,
+			useFunctions:    cfg.UseFunctions,
+			useUnlink:       cfg.UseUnlink,
+			maxRetries:      cfg.MaxRetries,
+			minRetryBackoff: cfg.RetryBackoff,
+			fallbackOptions: newFallbackOptions(cfg, !cfg.FallbackDisabled || cfg.SecondaryHost != ""),
+			onDecision:      func(key string, allowed bool, used, limit int) {},
+			onPoolWait:      func(wait time.Duration) {},
+		},
+	}
+	rc.disabled.Store(cfg.Disabled)
+	rc.initFallback(&rc.fallbackOptions, "Redis", rc.done, func() error {
+		return rc.client.Ping(context.Background()).Err()
+	})
+	if cfg.OnDecision != nil {
+		rc.onDecision = cfg.OnDecision
 	}
-	if cfg.OnError != nil {
-		rc.onError = cfg.OnError
+	if cfg.OnPoolWait != nil {
+		rc.onPoolWait = cfg.OnPoolWait
+	}
+	if cfg.now != nil {
+		rc.now = cfg.now
 	}
 	if !cfg.FallbackDisabled {
-		rc.fallbackCounter = httprate.NewLocalLimitCounter(cfg.WindowLength)
-		if cfg.OnFallbackChange != nil {
-			rc.onFallback = cfg.OnFallbackChange
+		rc.fallbackMaxKeys = cfg.FallbackMaxKeys
+		rc.resyncEnabled = cfg.FallbackResync
+		rc.fallbackCounter = newFallbackCounter(cfg.FallbackMaxKeys, cfg.WindowLength)
+		if rc.resyncEnabled {
+			rc.healthy = rc.flushResync
 		}
 	}
+	if cfg.SecondaryHost != "" {
+		// The secondary serves the requests first, with its own local fallback.
+		rc.secondary = newSecondary(cfg)
+		rc.fallbackCounter = rc.secondary
+	}
 
+	rc.hashTags = cfg.UseHashTags
 	if cfg.Client != nil {
 		rc.client = cfg.Client
+		rc.ownsClient = cfg.OwnsClient
+		switch cfg.Client.(type) {
+		case *redis.ClusterClient, *redis.Ring:
+			rc.hashTags = true
+		}
 	} else {
+		rc.ownsClient = true
+
 		maxIdle, maxActive := cfg.MaxIdle, cfg.MaxActive
 		if maxIdle < 1 {
 			maxIdle = 5
@@ -75,162 +256,798 @@ func NewCounter(cfg *Config) *redisCounter {
 			maxActive = 10
 		}
 
-		rc.client = redis.NewUniversalClient(&redis.UniversalOptions{
+		tlsConfig := cfg.TLSConfig
+		if tlsConfig == nil && cfg.TLSEnabled {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig != nil && tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = cfg.Host
+		}
+
+		opts := &redis.UniversalOptions{
 			Addrs:      []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)},
+			Username:   cfg.Username,
 			Password:   cfg.Password,
 			DB:         cfg.DBIndex,
 			ClientName: cfg.ClientName,
+			Protocol:   cfg.Protocol,
 
-			DialTimeout:  2 * cfg.FallbackTimeout,
-			ReadTimeout:  cfg.FallbackTimeout,
-			WriteTimeout: cfg.FallbackTimeout,
+			DisableIdentity: cfg.DisableIdentity,
+			IdentitySuffix:  strings.ReplaceAll(cfg.LibName, " ", "-"),
+
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
 			PoolSize:     maxActive,
-			MinIdleConns: 1,
 			MaxIdleConns: maxIdle,
 			MaxRetries:   -1, // -1 disables retries
-		})
+			TLSConfig:    tlsConfig,
+
+			// Recycle the connections older than MaxConnLifetime, if positive.
+			ConnMaxLifetime: cfg.MaxConnLifetime,
+
+			// Honor deadlines of the contexts passed to IncrementByCtx/GetCtx.
+			ContextTimeoutEnabled: true,
+		}
+		if cfg.ConnectEagerly {
+			// Keep a connection open from the start, go-redis dials it in the
+			// background. Otherwise, the pool dials on the first command.
+			opts.MinIdleConns = 1
+		}
+		if cfg.PoolWaitDisabled {
+			// The pool takes a free connection without waiting if there's one,
+			// and otherwise fails by ErrPoolTimeout once PoolTimeout elapses.
+			// Any positive timeout, as zero means the default.
+			opts.PoolTimeout = time.Nanosecond
+		}
+
+		password := func() (string, error) { return cfg.Password, nil }
+		var credentials func(ctx context.Context) (string, string, error)
+		if cfg.PasswordFunc != nil {
+			password = passwordFunc(cfg.PasswordFunc)
+			credentials = func(ctx context.Context) (string, string, error) {
+				p, err := password()
+				return cfg.Username, p, err
+			}
+		}
+
+		if len(cfg.SentinelAddrs) > 0 {
+			opts.Addrs = cfg.SentinelAddrs
+			opts.MasterName = cfg.MasterName
+			rc.client = redis.NewFailoverClient(opts.Failover())
+			rc.dbs.newClient = func(db int) redis.UniversalClient {
+				failoverOpts := opts.Failover()
+				failoverOpts.DB = db
+				return redis.NewFailoverClient(failoverOpts)
+			}
+		} else if len(cfg.ClusterAddrs) > 0 {
+			opts.Addrs = cfg.ClusterAddrs
+			clusterOpts := opts.Cluster()
+			clusterOpts.CredentialsProviderContext = credentials
+			rc.client = redis.NewClusterClient(clusterOpts)
+			rc.hashTags = true
+		} else if len(cfg.ShardAddrs) > 0 {
+			rc.client = redis.NewRing(ringOptions(opts, cfg.ShardAddrs, cfg.ShardVirtualNodes))
+			rc.hashTags = true
+		} else {
+			simpleOpts := opts.Simple()
+			simpleOpts.CredentialsProviderContext = credentials
+			if cfg.Network == "unix" {
+				simpleOpts.Network = "unix"
+				simpleOpts.Addr = cfg.SocketPath
+			}
+			rc.client = redis.NewClient(simpleOpts)
+			rc.dbs.newClient = func(db int) redis.UniversalClient {
+				dbOpts := *simpleOpts
+				dbOpts.DB = db
+				return redis.NewClient(&dbOpts)
+			}
+		}
+
+		if cfg.CommandTimeout > 0 {
+			rc.client.AddHook(commandTimeoutHook(cfg.CommandTimeout))
+		}
+		if client, ok := rc.client.(*redis.Client); ok {
+			if cfg.Password != "" || cfg.PasswordFunc != nil {
+				client.AddHook(newNoAuthHook(client, cfg.Username, password))
+			}
+			if cfg.OnPoolWait != nil {
+				go newPoolWaitReporter(client, rc.onPoolWait).run(rc.done, poolWaitInterval)
+			}
+		}
+
+		if len(cfg.ClusterAddrs) == 0 && len(cfg.ShardAddrs) == 0 {
+			for _, addr := range cfg.ReplicaAddrs {
+				replicaOpts := opts.Simple()
+				replicaOpts.CredentialsProviderContext = credentials
+				replicaOpts.Addr = addr
+				rc.replicas = append(rc.replicas, redis.NewClient(replicaOpts))
+			}
+		}
+	}
+
+	if cfg.UseServerTime {
+		clock := &serverClock{local: rc.now}
+		rc.now = clock.now
+		rc.useServerTime = true
+		clock.sync = func() { rc.syncServerTime(clock) }
 	}
 
 	return rc
 }
 
 type redisCounter struct {
-	client            redis.UniversalClient
-	windowLength      time.Duration
-	prefixKey         string
-	fallbackActivated atomic.Bool
-	fallbackCounter   httprate.LimitCounter
-	onError           func(err error)
-	onFallback        func(activated bool)
+	ownsClient    bool
+	shared        bool          // a WithPrefix view, the client is closed by the parent
+	secondary     *redisCounter // see Config.SecondaryHost
+	nextReplica   atomic.Uint32
+	limitConfig   atomic.Pointer[limitConfig] // set by Config
+	tiers         atomic.Pointer[[]*tier]     // set by AddTier
+	prefixKey     string
+	done          chan struct{} // closed by Close
+	closeOnce     sync.Once
+	closeErr      error
+	inFlight      atomic.Int64  // operations in progress, see CloseContext
+	disabled      atomic.Bool   // see SetEnabled
+	drained       chan struct{} // signaled by the last operation after close
+	noUnlink      atomic.Bool   // the server answered UNLINK by unknown command
+	functionsLoad singleflight.Group
+	scriptsLoad   singleflight.Group
+	stats         stats
+	resync        resyncBuffer
+
+	*counterOptions
+	fallback
 }
 
-var _ httprate.LimitCounter = (*redisCounter)(nil)
+// counterOptions are the client and the options of a counter set up by
+// NewCounter, shared by its WithPrefix views. They are not modified once
+// NewCounter returns.
+type counterOptions struct {
+	client          redis.UniversalClient
+	replicas        []*redis.Client // see Config.ReplicaAddrs
+	keyTTL          time.Duration
+	ttlJitter       time.Duration
+	now             func() time.Time
+	useServerTime   bool
+	limitFunc       func(key string) (limit int, window time.Duration)
+	keyFunc         func(key string, window time.Time) string
+	dbForKey        func(key string) int
+	dbIndex         int
+	dbs             *dbClients
+	maxKeyLength    int
+	windowBuckets   int
+	warnThreshold   float64
+	mode            Mode
+	refillRate      float64
+	burst           int
+	maxInFlight     int
+	inFlightTTL     time.Duration
+	dedupTTL        time.Duration
+	useFunctions    bool
+	useUnlink       bool
+	hashTags        bool
+	maxRetries      int
+	minRetryBackoff time.Duration
+	fallbackMaxKeys int
+	resyncEnabled   bool
+	onDecision      func(key string, allowed bool, used, limit int)
+	onPoolWait      func(wait time.Duration)
+
+	fallbackOptions
+}
 
+// limitConfig is the request limit and window length configured by httprate.
+type limitConfig struct {
+	requestLimit int
+	windowLength time.Duration
+}
+
+// Config sets the request limit and window length. It's safe to call Config
+// concurrently with the other methods, e.g. to reload the limits at runtime.
+// The operations in progress keep using the previous limits, the subsequent
+// ones use the new limits.
 func (c *redisCounter) Config(requestLimit int, windowLength time.Duration) {
-	c.windowLength = windowLength
-	if c.fallbackCounter != nil {
-		c.fallbackCounter.Config(requestLimit, windowLength)
+	c.limitConfig.Store(&limitConfig{requestLimit: requestLimit, windowLength: windowLength})
+	c.configFallback(requestLimit, windowLength)
+}
+
+func (c *redisCounter) fallbackIncrementBy(key string, currentWindow time.Time, amount int) error {
+	if c.resyncEnabled {
+		c.bufferResync(key, currentWindow, amount)
 	}
+	return c.fallback.fallbackIncrementBy(key, currentWindow, amount)
 }
 
 func (c *redisCounter) Increment(key string, currentWindow time.Time) error {
 	return c.IncrementBy(key, currentWindow, 1)
 }
 
-func (c *redisCounter) IncrementBy(key string, currentWindow time.Time, amount int) (err error) {
+// IncrementBy increments the counter of the current window by amount, which is
+// the cost of the request set via Cost or httprate.WithIncrement.
+func (c *redisCounter) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	return c.IncrementByCtx(context.Background(), key, currentWindow, amount)
+}
+
+// IncrementByCtx is like IncrementBy, but the Redis round-trip is bound to ctx
+// in addition to the timeouts set up on the Redis client. It returns as soon as
+// ctx is done, also when ctx is cancelled during the round-trip, which is then
+// left to finish in the background, i.e. the increment may still be counted.
+func (c *redisCounter) IncrementByCtx(ctx context.Context, key string, currentWindow time.Time, amount int) (err error) {
+	currentWindow, _ = c.windowsOf(key, currentWindow, currentWindow)
+	c.stats.increments.Add(1)
+	if !c.begin() {
+		return errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return nil
+	}
+
+	var fallback bool
+	ctx, span := c.startSpan(ctx, spanIncrement, currentWindow)
+	defer func() { endSpan(span, fallback, err) }()
+
 	if c.fallbackCounter != nil {
-		if c.fallbackActivated.Load() {
-			return c.fallbackCounter.IncrementBy(key, currentWindow, amount)
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.fallbackIncrementBy(key, currentWindow, amount)
 		}
 		defer func() {
-			if c.shouldFallback(err) {
-				err = c.fallbackCounter.IncrementBy(key, currentWindow, amount)
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				err = c.fallbackIncrementBy(key, currentWindow, amount)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				err = nil
 			}
 		}()
 	}
 
-	// Note: Timeouts are set up directly on the Redis client.
-	ctx := context.Background()
+	_, err = awaitContext(ctx, "redis incr failed", func() (struct{}, error) {
+		return struct{}{}, c.increment(ctx, key, currentWindow, amount)
+	})
+	return err
+}
 
-	hkey := c.limitCounterKey(key, currentWindow)
+// increment runs the Redis round-trips of IncrementByCtx.
+func (c *redisCounter) increment(ctx context.Context, key string, currentWindow time.Time, amount int) (err error) {
+	switch c.mode {
+	case ModeSlidingLog:
+		return c.incrementLog(ctx, key, amount)
+	case ModeTokenBucket:
+		_, _, err = c.take(ctx, key, amount, true)
+		return err
+	}
 
-	pipe := c.client.TxPipeline()
-	incrCmd := pipe.IncrBy(ctx, hkey, int64(amount))
-	expireCmd := pipe.Expire(ctx, hkey, c.windowLength*3)
+	_, windowLength := c.limits(key)
+	hkey := c.incrementKey(key, currentWindow, windowLength)
 
-	_, err = pipe.Exec(ctx)
+	err = c.withRetry(ctx, false, func() error {
+		return c.runScriptOn(ctx, c.clientFor(key), incrementScript, []string{hkey}, amount, c.ttl(windowLength).Milliseconds()).Err()
+	})
 	if err != nil {
-		return fmt.Errorf("httprateredis: redis transaction failed: %w", err)
-	}
-	if err := incrCmd.Err(); err != nil {
-		return fmt.Errorf("httprateredis: redis incr failed: %w", err)
-	}
-	if err := expireCmd.Err(); err != nil {
-		return fmt.Errorf("httprateredis: redis expire failed: %w", err)
+		return c.commandError(ctx, "redis incr failed", err)
 	}
 
 	return nil
 }
 
-func (c *redisCounter) Get(key string, currentWindow, previousWindow time.Time) (curr int, prev int, err error) {
+func (c *redisCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return c.GetCtx(context.Background(), key, currentWindow, previousWindow)
+}
+
+// GetCtx is like Get, but the Redis round-trip is bound to ctx in addition
+// to the timeouts set up on the Redis client. Like IncrementByCtx, it returns
+// as soon as ctx is done.
+func (c *redisCounter) GetCtx(ctx context.Context, key string, currentWindow, previousWindow time.Time) (curr int, prev int, err error) {
+	currentWindow, previousWindow = c.windowsOf(key, currentWindow, previousWindow)
+	c.stats.gets.Add(1)
+	if !c.begin() {
+		return 0, 0, errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return 0, 0, nil
+	}
+
+	var fallback bool
+	ctx, span := c.startSpan(ctx, spanGet, currentWindow)
+	defer func() { endSpan(span, fallback, err) }()
+
 	if c.fallbackCounter != nil {
-		if c.fallbackActivated.Load() {
-			return c.fallbackCounter.Get(key, currentWindow, previousWindow)
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.fallbackGet(key, currentWindow, previousWindow)
 		}
 		defer func() {
-			if c.shouldFallback(err) {
-				curr, prev, err = c.fallbackCounter.Get(key, currentWindow, previousWindow)
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				curr, prev, err = c.fallbackGet(key, currentWindow, previousWindow)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				curr, prev, err = 0, 0, nil
 			}
 		}()
 	}
 
-	// Note: Timeouts are set up directly on the Redis client.
-	ctx := context.Background()
+	counts, err := awaitContext(ctx, "redis mget failed", func() ([2]int, error) {
+		curr, prev, err := c.get(ctx, key, currentWindow, previousWindow)
+		return [2]int{curr, prev}, err
+	})
+	return counts[0], counts[1], err
+}
+
+// get runs the Redis round-trips of GetCtx.
+func (c *redisCounter) get(ctx context.Context, key string, currentWindow, previousWindow time.Time) (curr int, prev int, err error) {
+	switch c.mode {
+	case ModeSlidingLog:
+		return c.getLog(ctx, key)
+	case ModeTokenBucket:
+		return c.getBucket(ctx, key)
+	}
+
+	_, windowLength := c.limits(key)
+	if bucketLength := c.bucketLength(windowLength); bucketLength > 0 {
+		return c.getBuckets(ctx, key, bucketLength)
+	}
 
 	currKey := c.limitCounterKey(key, currentWindow)
 	prevKey := c.limitCounterKey(key, previousWindow)
 
-	values, err := c.client.MGet(ctx, currKey, prevKey).Result()
+	var values []interface{}
+	err = c.withRetry(ctx, true, func() (err error) {
+		return c.readKey(ctx, key, func(client redis.Cmdable) (err error) {
+			values, err = client.MGet(ctx, currKey, prevKey).Result()
+			return err
+		})
+	})
 	if err != nil {
-		return 0, 0, fmt.Errorf("httprateredis: redis mget failed: %w", err)
+		return 0, 0, c.commandError(ctx, "redis mget failed", err)
 	} else if len(values) != 2 {
 		return 0, 0, fmt.Errorf("httprateredis: redis mget returned wrong number of keys: %v, expected 2", len(values))
 	}
 
 	// MGET always returns slice with nil or "string" values, even if the values
-	// were created with the INCR command. Ignore error if we can't parse the number.
-	if values[0] != nil {
-		v, _ := values[0].(string)
-		curr, _ = strconv.Atoi(v)
+	// were created with the INCR command.
+	return parseCount(values[0]), parseCount(values[1]), nil
+}
+
+// parseCount parses the counter value returned by MGET. The counter is a 64-bit
+// integer in Redis (INCRBY fails instead of overflowing), so the value is clamped
+// to the int range. Ignore error if we can't parse the number.
+func parseCount(value interface{}) int {
+	var count int64
+	switch v := value.(type) {
+	case string:
+		count, _ = strconv.ParseInt(v, 10, 64)
+	case int64: // RESP integer
+		count = v
+	case float64: // RESP3 double
+		if v >= math.MaxInt64 {
+			return math.MaxInt
+		}
+		count = int64(v)
+	default:
+		return 0
+	}
+	if count > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(count)
+}
+
+// Reset deletes the current and previous window counters of the given
+// rate-limit key, e.g. to lift the limit after a false positive. Missing
+// counters are not an error. The local in-memory fallback is not reset. The
+// counters are deleted by DEL, or by UNLINK with UseUnlink.
+func (c *redisCounter) Reset(ctx context.Context, key string) error {
+	if !c.begin() {
+		return errRefused
+	}
+	defer c.end()
+
+	_, windowLength := c.limits(key)
+	currentWindow, previousWindow, err := c.windows(c.now(), windowLength)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{c.limitCounterKey(key, currentWindow), c.limitCounterKey(key, previousWindow)}
+	if bucketLength := c.bucketLength(windowLength); bucketLength > 0 {
+		keys, _ = c.bucketKeys(key, c.now(), bucketLength)
+	}
+	switch c.mode {
+	case ModeSlidingLog:
+		keys = []string{c.stateKey(key, "log")}
+	case ModeTokenBucket:
+		keys = []string{c.stateKey(key, "bucket")}
+	}
+
+	err = c.withRetry(ctx, true, func() error {
+		return c.deleteKeys(ctx, c.clientFor(key), c.useUnlink, false, keys)
+	})
+	if err != nil {
+		return c.wrapError(ctx, "redis del failed", err)
+	}
+	return nil
+}
+
+// resetAllBatchSize is the SCAN COUNT hint of ResetAll, and so roughly the
+// number of keys deleted by each UNLINK.
+const resetAllBatchSize = 500
+
+// ResetAll deletes all keys under the configured prefix, i.e. the rate-limit
+// state of all keys, without touching any other keys in the database. Keys are
+// found by incremental SCAN and deleted in batches by UNLINK (DEL before Redis
+// 4), so Redis is never blocked like by KEYS or FLUSHDB. Cancelling ctx stops it between batches,
+// leaving the remaining keys in place. In cluster mode, all masters are scanned.
+//
+// NOTE: The prefix is matched as "<prefix>:*", so the keys of other counters
+// with a longer prefix (e.g. "httprate:admin" for "httprate") are deleted too.
+// The local in-memory fallback is not reset.
+func (c *redisCounter) ResetAll(ctx context.Context) error {
+	if !c.begin() {
+		return errRefused
+	}
+	defer c.end()
+
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return c.resetAll(ctx, client, true)
+		})
+		if err != nil {
+			return c.wrapError(ctx, "redis reset all failed", err)
+		}
+		return nil
+	}
+	if ring, ok := c.client.(*redis.Ring); ok {
+		err := ring.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+			return c.resetAll(ctx, client, false)
+		})
+		if err != nil {
+			return c.wrapError(ctx, "redis reset all failed", err)
+		}
+		return nil
+	}
+	if err := c.resetAll(ctx, c.client, false); err != nil {
+		return c.wrapError(ctx, "redis reset all failed", err)
+	}
+	return nil
+}
+
+// resetAll scans and unlinks the keys of a single Redis node. Keys of different
+// cluster slots can't be unlinked by a single command, so with perKey each key
+// is unlinked separately, still in a single round-trip per batch.
+func (c *redisCounter) resetAll(ctx context.Context, client redis.Cmdable, perKey bool) error {
+	match := escapeGlob(c.prefixKey) + ":*"
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, next, err := client.Scan(ctx, cursor, match, resetAllBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := c.deleteKeys(ctx, client, true, perKey, keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// deleteKeys deletes the keys by UNLINK if unlink is set, reclaiming their
+// memory in the background, or by DEL otherwise. Servers which don't know UNLINK
+// (before Redis 4) get DEL, and this is remembered. With perKey, each key is
+// deleted separately, still in a single round-trip.
+func (c *redisCounter) deleteKeys(ctx context.Context, client redis.Cmdable, unlink, perKey bool, keys []string) error {
+	del := func(unlink bool) error {
+		cmd := client.Del
+		if unlink {
+			cmd = client.Unlink
+		}
+		if !perKey {
+			return cmd(ctx, keys...).Err()
+		}
+		_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				if unlink {
+					pipe.Unlink(ctx, key)
+				} else {
+					pipe.Del(ctx, key)
+				}
+			}
+			return nil
+		})
+		return err
+	}
+	if !unlink || c.noUnlink.Load() {
+		return del(false)
 	}
-	if values[1] != nil {
-		v, _ := values[1].(string)
-		prev, _ = strconv.Atoi(v)
+	err := del(true)
+	if err != nil && strings.HasPrefix(err.Error(), "ERR unknown command") {
+		c.logger.Debugf("httprateredis: UNLINK not supported, using DEL: %v", err)
+		c.noUnlink.Store(true)
+		return del(false)
 	}
+	return err
+}
 
-	return curr, prev, nil
+// escapeGlob escapes the glob-style pattern characters of SCAN MATCH.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Ping checks the Redis connection, e.g. for readiness probes. It respects
+// the client timeouts and never activates or deactivates the fallback.
+func (c *redisCounter) Ping(ctx context.Context) error {
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return c.wrapError(ctx, "ping failed", err)
+	}
+	return nil
 }
 
 func (c *redisCounter) IsFallbackActivated() bool {
-	return c.fallbackActivated.Load()
+	return c.breaker.isOpen()
 }
 
+// SetEnabled turns rate limiting on or off at runtime, e.g. by a feature flag
+// during an incident. While disabled, the counter doesn't talk to Redis at all:
+// increments are dropped and reads report zero usage, so all requests are
+// allowed. It's safe to call concurrently with live traffic. The initial state
+// is set by Config.Disabled, unless the counter was created by
+// WithRedisLimitCounter, which skips the counter entirely when disabled.
+func (c *redisCounter) SetEnabled(enabled bool) {
+	c.disabled.Store(!enabled)
+}
+
+// Close closes the Redis client, unless it was supplied via Config.Client
+// without Config.OwnsClient. It's safe to call Close multiple times, only the
+// first call closes the client. Operations running concurrently with Close
+// either complete or return ErrClosed.
 func (c *redisCounter) Close() error {
-	return c.client.Close()
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.closeClient()
+	})
+	return c.closeErr
 }
 
-func (c *redisCounter) shouldFallback(err error) bool {
-	if err == nil {
-		return false
+// CloseContext is like Close, but waits for the in-flight operations to finish
+// before closing the client, e.g. to flush the final increments on shutdown.
+// New operations return ErrClosed right away. If ctx is done first, the client
+// is closed anyway and the context error is returned.
+func (c *redisCounter) CloseContext(ctx context.Context) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.drain(ctx)
+		c.closeClient()
+	})
+	if err != nil {
+		return err
 	}
-	c.onError(err)
+	return c.closeErr
+}
 
-	// Activate the local in-memory counter fallback, unless activated by some other goroutine.
-	alreadyActivated := c.fallbackActivated.Swap(true)
-	if !alreadyActivated {
-		c.onFallback(true)
-		go c.reconnect()
+func (c *redisCounter) closeClient() {
+	if c.secondary != nil {
+		c.secondary.Close()
+	}
+	if c.shared {
+		return
+	}
+	if c.ownsClient {
+		c.closeErr = c.client.Close()
 	}
+	for _, replica := range c.replicas {
+		replica.Close()
+	}
+	c.dbs.close()
+}
 
+// read runs the read-only fn on the next replica, or on the primary if there
+// are no replicas or the replica fails.
+func (c *redisCounter) read(ctx context.Context, fn func(client redis.Cmdable) error) error {
+	if len(c.replicas) == 0 {
+		return fn(c.client)
+	}
+	replica := c.replicas[int(c.nextReplica.Add(1)-1)%len(c.replicas)]
+	err := fn(replica)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	c.logger.Debugf("httprateredis: replica %s read failed, reading from the primary: %v", replica.Options().Addr, err)
+	return fn(c.client)
+}
+
+// begin registers an in-flight operation, unless the counter is closed. Each
+// successful begin must be followed by end.
+func (c *redisCounter) begin() bool {
+	c.inFlight.Add(1)
+	if c.isClosed() {
+		c.end()
+		return false
+	}
 	return true
 }
 
-func (c *redisCounter) reconnect() {
-	// Try to re-connect to redis every 200ms.
-	for {
-		time.Sleep(200 * time.Millisecond)
+func (c *redisCounter) end() {
+	if c.inFlight.Add(-1) == 0 && c.isClosed() {
+		select {
+		case c.drained <- struct{}{}:
+		default:
+		}
+	}
+}
 
-		err := c.client.Ping(context.Background()).Err()
-		if err == nil {
-			c.fallbackActivated.Store(false)
-			if c.onFallback != nil {
-				c.onFallback(false)
-			}
-			return
+// drain waits for the in-flight operations to finish, once the counter is closed.
+func (c *redisCounter) drain(ctx context.Context) error {
+	for c.inFlight.Load() > 0 {
+		select {
+		case <-c.drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *redisCounter) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// limits returns the request limit and window length of the given rate-limit
+// key, see Config.LimitFunc.
+func (c *redisCounter) limits(key string) (requestLimit int, windowLength time.Duration) {
+	if cfg := c.limitConfig.Load(); cfg != nil {
+		requestLimit, windowLength = cfg.requestLimit, cfg.windowLength
+	}
+	if c.limitFunc != nil {
+		limit, window := c.limitFunc(key)
+		if limit > 0 {
+			requestLimit = limit
 		}
+		if window > 0 {
+			windowLength = window
+		}
+	}
+	return requestLimit, windowLength
+}
+
+// ttl returns the TTL of the window counters, see Config.KeyTTL and TTLJitter.
+func (c *redisCounter) ttl(windowLength time.Duration) time.Duration {
+	ttl := 3 * windowLength
+	if c.keyTTL != 0 {
+		ttl = max(c.keyTTL, 2*windowLength)
+	}
+	if c.ttlJitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(2*c.ttlJitter)+1)) - c.ttlJitter
+		ttl = max(ttl, 2*windowLength)
 	}
+	return ttl
 }
 
-func (c *redisCounter) limitCounterKey(key string, window time.Time) string {
-	return fmt.Sprintf("%s:%d", c.prefixKey, httprate.LimitCounterKey(key, window))
+// windows returns the current and previous windows at now, the same way httprate computes them.
+func (c *redisCounter) windows(now time.Time, windowLength time.Duration) (currentWindow, previousWindow time.Time, err error) {
+	if windowLength <= 0 {
+		return time.Time{}, time.Time{}, errNotConfigured
+	}
+	currentWindow = now.UTC().Truncate(windowLength)
+	previousWindow = currentWindow.Add(-windowLength)
+	return currentWindow, previousWindow, nil
+}
+
+// commandError wraps and reports the error of a failed IncrementBy or Get command.
+func (c *redisCounter) commandError(ctx context.Context, msg string, err error) error {
+	err = c.wrapError(ctx, msg, err)
+	c.stats.redisErrors.Add(1)
+	c.logger.Errorf("%v", err)
+	return err
+}
+
+func (c *redisCounter) wrapError(ctx context.Context, msg string, err error) error {
+	return wrapCommandError(ctx, c.isClosed(), msg, err)
+}
+
+// wrapCommandError wraps the error of a failed command of a counter with msg
+// and the sentinel error of its cause, e.g. ErrRedisUnavailable.
+func wrapCommandError(ctx context.Context, closed bool, msg string, err error) error {
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return fmt.Errorf("httprateredis: %s: %w: %w", msg, ctxErr, err)
+	}
+	if closed || errors.Is(err, redis.ErrClosed) {
+		return fmt.Errorf("httprateredis: %s: %w: %w", msg, ErrClosed, err)
+	}
+	if errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrRedisUnavailable) {
+		// Already classified, e.g. by the Upstash counter.
+		return fmt.Errorf("httprateredis: %s: %w", msg, err)
+	}
+	if isAuthError(err) {
+		return fmt.Errorf("httprateredis: %s: %w: %w", msg, ErrAuthFailed, err)
+	}
+	if isUnavailableError(err) {
+		return fmt.Errorf("httprateredis: %s: %w: %w", msg, ErrRedisUnavailable, err)
+	}
+	if isOutOfMemoryError(err) {
+		return fmt.Errorf("httprateredis: %s: %w: %w", msg, ErrRedisOutOfMemory, err)
+	}
+	return fmt.Errorf("httprateredis: %s: %w", msg, err)
+}
+
+// contextError returns the context error, including the case when the deadline
+// has passed and the network timeout fired before the context itself was done.
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// isAuthError reports whether err is a Redis reply rejecting the credentials,
+// either from AUTH/HELLO on a new connection or from a command on an
+// unauthenticated connection.
+func isAuthError(err error) bool {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return false
+	}
+	msg := redisErr.Error()
+	return strings.HasPrefix(msg, "WRONGPASS") ||
+		strings.HasPrefix(msg, "NOAUTH") ||
+		strings.HasPrefix(msg, "ERR invalid password") ||
+		strings.HasPrefix(msg, "ERR AUTH")
+}
+
+// isOutOfMemoryError reports whether err is the OOM reply of Redis at maxmemory.
+func isOutOfMemoryError(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "OOM")
+}
+
+// isUnavailableError reports whether err means Redis can't serve commands: any
+// connection error, or an error reply of a Redis node that's not ready yet.
+func isUnavailableError(err error) bool {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return true
+	}
+	msg := redisErr.Error()
+	return strings.HasPrefix(msg, "LOADING") ||
+		strings.HasPrefix(msg, "MASTERDOWN") ||
+		strings.HasPrefix(msg, "CLUSTERDOWN") ||
+		strings.HasPrefix(msg, "TRYAGAIN")
 }
@@ -1,136 +1,136 @@
 package httprateredis_test
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
-	"sync"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	httprateredis "github.com/go-chi/httprate-redis"
 	"golang.org/x/sync/errgroup"
 )
 
+// TestRedisCounter runs against miniredis, advancing its clock (and so the key
+// expiry) along with the windows, see TestRedisCounterIntegration for real Redis.
 func TestRedisCounter(t *testing.T) {
-	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
-		Host:             "localhost",
-		Port:             6379,
-		MaxIdle:          0,
-		MaxActive:        2,
-		DBIndex:          0,
-		ClientName:       "httprateredis_test",
-		PrefixKey:        fmt.Sprintf("httprate:test:%v", rand.Int31n(100000)), // Unique Redis key for each test
-		FallbackTimeout:  time.Second,
-		FallbackDisabled: true,
-	})
-	defer limitCounter.Close()
-
-	limitCounter.Config(1000, time.Minute)
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
 
 	currentWindow := time.Now().UTC().Truncate(time.Minute)
 	previousWindow := currentWindow.Add(-time.Minute)
 
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return currentWindow.Add(time.Second) }),
+	)
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
 	type test struct {
 		name        string        // In each test do the following:
 		advanceTime time.Duration // 1. advance time
 		incrBy      int           // 2. increase counter
+		reset       bool          //    or reset it
 		prev        int           // 3. check previous window counter
 		curr        int           //    and current window counter
+		keys        int           //    and the number of Redis keys
 	}
 
 	tests := []test{
 		{
 			name: "t=0m: init",
-			prev: 0,
-			curr: 0,
 		},
 		{
 			name:   "t=0m: increment by 1",
 			incrBy: 1,
-			prev:   0,
 			curr:   1,
+			keys:   1,
 		},
 		{
 			name:   "t=0m: increment by 99",
 			incrBy: 99,
-			prev:   0,
 			curr:   100,
+			keys:   1,
 		},
 		{
 			name:        "t=1m: move clock by 1m",
 			advanceTime: time.Minute,
 			prev:        100,
-			curr:        0,
+			keys:        1,
 		},
 		{
 			name:   "t=1m: increment by 20",
 			incrBy: 20,
 			prev:   100,
 			curr:   20,
-		},
-		{
-			name:   "t=1m: increment by 20",
-			incrBy: 20,
-			prev:   100,
-			curr:   40,
+			keys:   2,
 		},
 		{
 			name:        "t=2m: move clock by 1m",
 			advanceTime: time.Minute,
-			prev:        40,
-			curr:        0,
+			prev:        20,
+			keys:        2,
 		},
 		{
-			name:   "t=2m: incr++",
-			incrBy: 1,
-			prev:   40,
-			curr:   1,
+			name:   "t=2m: increment by 30",
+			incrBy: 30,
+			prev:   20,
+			curr:   30,
+			keys:   3,
 		},
 		{
-			name:   "t=2m: incr+=9",
-			incrBy: 9,
-			prev:   40,
-			curr:   10,
+			name:        "t=3m: move clock by 1m, the t=0m counters expire",
+			advanceTime: time.Minute,
+			prev:        30,
+			keys:        2,
 		},
 		{
-			name:   "t=2m: incr+=20",
-			incrBy: 20,
-			prev:   40,
-			curr:   30,
+			name:  "t=3m: reset",
+			reset: true,
+			keys:  1,
 		},
 		{
-			name:        "t=4m: move clock by 2m",
-			advanceTime: 2 * time.Minute,
-			prev:        0,
-			curr:        0,
+			name:        "t=6m: move clock by 3m, all counters expire",
+			advanceTime: 3 * time.Minute,
 		},
 	}
 
-	concurrentRequests := 1000
+	const concurrentRequests = 100
 
 	for _, tt := range tests {
 		if tt.advanceTime > 0 {
 			currentWindow = currentWindow.Add(tt.advanceTime)
 			previousWindow = previousWindow.Add(tt.advanceTime)
+			redis.FastForward(tt.advanceTime)
 		}
 
-		if tt.incrBy > 0 {
-			var g errgroup.Group
-			for i := 0; i < concurrentRequests; i++ {
-				i := i
-				g.Go(func() error {
-					key := fmt.Sprintf("key:%v", i)
+		var g errgroup.Group
+		for i := 0; i < concurrentRequests; i++ {
+			g.Go(func() error {
+				key := fmt.Sprintf("key:%v", i)
+				switch {
+				case tt.incrBy > 0:
 					return limitCounter.IncrementBy(key, currentWindow, tt.incrBy)
-				})
-			}
-			if err := g.Wait(); err != nil {
-				t.Errorf("%s: %v", tt.name, err)
-			}
+				case tt.reset:
+					return limitCounter.Reset(context.Background(), key)
+				}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
 		}
 
-		var g errgroup.Group
 		for i := 0; i < concurrentRequests; i++ {
-			i := i
 			g.Go(func() error {
 				key := fmt.Sprintf("key:%v", i)
 				curr, prev, err := limitCounter.Get(key, currentWindow, previousWindow)
@@ -149,50 +149,9 @@ func TestRedisCounter(t *testing.T) {
 		if err := g.Wait(); err != nil {
 			t.Errorf("%s: %v", tt.name, err)
 		}
-	}
-}
-
-func BenchmarkLocalCounter(b *testing.B) {
-	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
-		Host:             "localhost",
-		Port:             6379,
-		DBIndex:          0,
-		ClientName:       "httprateredis_test",
-		PrefixKey:        fmt.Sprintf("httprate:test:%v", rand.Int31n(100000)), // Unique key for each test
-		MaxActive:        10,
-		MaxIdle:          0,
-		FallbackDisabled: true,
-		FallbackTimeout:  5 * time.Second,
-	})
-	defer limitCounter.Close()
-
-	limitCounter.Config(1000, time.Minute)
-
-	currentWindow := time.Now().UTC().Truncate(time.Minute)
-	previousWindow := currentWindow.Add(-time.Minute)
-
-	concurrentRequests := 100
-
-	b.ResetTimer()
-
-	for i := 0; i < b.N; i++ {
-		for i := range []int{0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 0, 1, 0} {
-			// Simulate time.
-			currentWindow.Add(time.Duration(i) * time.Minute)
-			previousWindow.Add(time.Duration(i) * time.Minute)
-
-			wg := sync.WaitGroup{}
-			wg.Add(concurrentRequests)
-			for i := 0; i < concurrentRequests; i++ {
-				// Simulate concurrent requests with different rate-limit keys.
-				go func(i int) {
-					defer wg.Done()
 
-					_, _, _ = limitCounter.Get(fmt.Sprintf("key:%v", i), currentWindow, previousWindow)
-					_ = limitCounter.IncrementBy(fmt.Sprintf("key:%v", i), currentWindow, rand.Intn(20))
-				}(i)
-			}
-			wg.Wait()
+		if keys := len(redis.Keys()); keys != tt.keys*concurrentRequests {
+			t.Errorf("%s: unexpected %v Redis keys, expected %v", tt.name, keys, tt.keys*concurrentRequests)
 		}
 	}
 }
@@ -0,0 +1,110 @@
+package httprateredis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/xxh3"
+)
+
+// keyBufferSize is the size of the stack buffers the Redis keys are built in,
+// enough for the default prefix and hash-tagged keys of typical rate-limit keys
+// (e.g. IP addresses), so that building a key allocates only the key itself.
+// Longer keys still work, they're just built on the heap.
+const keyBufferSize = 128
+
+// limitCounterKey returns the Redis key of the given rate-limit key and window,
+// unless overridden by Config.KeyFunc.
+//
+// With hash tags enabled, the key is wrapped in {} so that all windows of the same
+// rate-limit key hash to the same Redis Cluster slot. In that case, neither the
+// IncrementBy script (INCRBY+PEXPIRE) nor the Get command (MGET of the current
+// and previous window) ever spans multiple slots.
+//
+// Windows starting within a second (e.g. 200ms windows) get the milliseconds
+// suffix, as the windows of the same second would share the key otherwise.
+//
+// The keys are built without fmt, as this runs for every request, but they must
+// stay the same as "%s:%d.%03d" and "%s:{%s}:%d.%03d" of the stored counters.
+func (c *redisCounter) limitCounterKey(key string, window time.Time) string {
+	if c.keyFunc != nil {
+		return c.keyFunc(key, window)
+	}
+	var buf [keyBufferSize]byte
+	if c.hashTags {
+		return c.taggedKey(key, appendWindow(buf[:0], window))
+	}
+	return string(appendPlainKey(buf[:0], c.prefixKey, key, window))
+}
+
+// appendPlainKey appends the Redis key "<prefix>:<hash>" of the rate-limit key
+// and window without hash tags to b, with the milliseconds suffix of
+// limitCounterKey.
+func appendPlainKey(b []byte, prefixKey, key string, window time.Time) []byte {
+	b = append(b, prefixKey...)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, limitCounterHash(key, window), 10)
+	return appendMillis(b, window)
+}
+
+// taggedKey returns the hash-tagged Redis key "<prefix>:{<key>}:<suffix>". If
+// it's longer than MaxKeyLength, the rate-limit key is replaced by its SHA-256
+// (hex-encoded, truncated to 128 bits), keeping the prefix and suffix readable.
+func (c *redisCounter) taggedKey(key string, suffix []byte) string {
+	hkey := c.prefixKey + ":{" + key + "}:" + string(suffix)
+	if c.maxKeyLength > 0 && len(hkey) > c.maxKeyLength {
+		sum := sha256.Sum256([]byte(key))
+		hkey = c.prefixKey + ":{" + hex.EncodeToString(sum[:16]) + "}:" + string(suffix)
+	}
+	return hkey
+}
+
+// stateKey returns the Redis key of the given rate-limit key state which is not
+// bound to a window, e.g. the sorted set of the sliding log mode.
+func (c *redisCounter) stateKey(key, kind string) string {
+	var buf [keyBufferSize]byte
+	if c.hashTags {
+		return c.taggedKey(key, append(buf[:0], kind...))
+	}
+	b := append(buf[:0], c.prefixKey...)
+	b = append(b, ':')
+	b = append(b, kind...)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, xxh3.HashString(key), 10)
+	return string(b)
+}
+
+// limitCounterHash returns httprate.LimitCounterKey(key, window), i.e. the XXH3
+// of the key followed by the window's Unix time, hashed in a stack buffer
+// instead of by the streaming hasher and fmt.
+func limitCounterHash(key string, window time.Time) uint64 {
+	var buf [keyBufferSize]byte
+	b := append(buf[:0], key...)
+	b = strconv.AppendInt(b, window.Unix(), 10)
+	return xxh3.Hash(b)
+}
+
+// appendWindow appends the window's Unix time and milliseconds suffix, if any.
+func appendWindow(b []byte, window time.Time) []byte {
+	b = strconv.AppendInt(b, window.Unix(), 10)
+	return appendMillis(b, window)
+}
+
+// appendMillis appends the ".%03d" milliseconds suffix of windows starting
+// within a second.
+func appendMillis(b []byte, window time.Time) []byte {
+	ms := window.Nanosecond() / int(time.Millisecond)
+	if ms == 0 {
+		return b
+	}
+	b = append(b, '.')
+	if ms < 100 {
+		b = append(b, '0')
+	}
+	if ms < 10 {
+		b = append(b, '0')
+	}
+	return strconv.AppendInt(b, int64(ms), 10)
+}
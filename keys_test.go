@@ -0,0 +1,243 @@
+package httprateredis_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/zeebo/xxh3"
+)
+
+func TestKeyFunc(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	keyFunc := func(key string, window time.Time) string {
+		sum := sha256.Sum256([]byte(key))
+		return fmt.Sprintf("tenant-1:%s:%d", hex.EncodeToString(sum[:8]), window.Unix())
+	}
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		KeyFunc:          keyFunc,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	key := "https://example.com/a/very/long/path?with=query&string=1"
+	if err := limitCounter.IncrementBy(key, previousWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy(key, currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	curr, prev, err := limitCounter.Get(key, currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 || prev != 5 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 2, 5", curr, prev)
+	}
+
+	for _, window := range []time.Time{currentWindow, previousWindow} {
+		if _, err := redis.Get(keyFunc(key, window)); err != nil {
+			t.Errorf("expected key %q: %v", keyFunc(key, window), err)
+		}
+	}
+
+	if err := limitCounter.Reset(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if keys := redis.Keys(); len(keys) != 0 {
+		t.Errorf("unexpected keys %v after Reset(), expected none", keys)
+	}
+}
+
+func TestMaxKeyLength(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		PrefixKey:        "httprate",
+		UseHashTags:      true,
+		MaxKeyLength:     80,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	shortKey := "127.0.0.1"
+	longKey := "/search?q=" + strings.Repeat("x", 500)
+	for _, key := range []string{shortKey, longKey, longKey} {
+		if err := limitCounter.IncrementBy(key, currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(longKey))
+	expected := []string{
+		fmt.Sprintf("httprate:{%s}:%d", shortKey, currentWindow.Unix()),
+		fmt.Sprintf("httprate:{%s}:%d", hex.EncodeToString(sum[:16]), currentWindow.Unix()),
+	}
+	for _, key := range expected {
+		if len(key) > 80 {
+			t.Errorf("key %q is longer than MaxKeyLength", key)
+		}
+		if _, err := redis.Get(key); err != nil {
+			t.Errorf("expected key %q: %v (keys %v)", key, err, redis.Keys())
+		}
+	}
+	if keys := redis.Keys(); len(keys) != 2 {
+		t.Errorf("unexpected keys %v, expected 2", keys)
+	}
+
+	// The hashed key is stable across Get and Reset.
+	curr, _, err := limitCounter.Get(longKey, currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 {
+		t.Errorf("unexpected curr = %v, expected 2", curr)
+	}
+	if err := limitCounter.Reset(context.Background(), longKey); err != nil {
+		t.Fatal(err)
+	}
+	if keys := redis.Keys(); len(keys) != 1 {
+		t.Errorf("unexpected keys %v after Reset(), expected 1", keys)
+	}
+}
+
+// TestKeyBuild checks that the Redis keys stay the same as the fmt-formatted
+// ones of the counters stored by earlier versions.
+func TestKeyBuild(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	window := time.Now().UTC().Truncate(time.Minute)
+	windows := []time.Time{window, window.Add(5 * time.Millisecond), window.Add(50 * time.Millisecond), window.Add(200 * time.Millisecond), time.Unix(0, 0)}
+	keys := []string{"", "127.0.0.1", "user:{42}", strings.Repeat("x", 500)}
+
+	for _, hashTags := range []bool{false, true} {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(redisPort),
+			PrefixKey:        "prefix",
+			UseHashTags:      hashTags,
+			FallbackDisabled: true,
+		})
+		defer limitCounter.Close()
+
+		for _, key := range keys {
+			for _, window := range windows {
+				var expected string
+				ms := window.Nanosecond() / int(time.Millisecond)
+				switch {
+				case hashTags && ms != 0:
+					expected = fmt.Sprintf("prefix:{%s}:%d.%03d", key, window.Unix(), ms)
+				case hashTags:
+					expected = fmt.Sprintf("prefix:{%s}:%d", key, window.Unix())
+				case ms != 0:
+					expected = fmt.Sprintf("prefix:%d.%03d", httprate.LimitCounterKey(key, window), ms)
+				default:
+					expected = fmt.Sprintf("prefix:%d", httprate.LimitCounterKey(key, window))
+				}
+				if got := limitCounter.LimitCounterKey(key, window); got != expected {
+					t.Errorf("hash tags %v: unexpected key %q, expected %q", hashTags, got, expected)
+				}
+			}
+
+			expected := fmt.Sprintf("prefix:log:%d", xxh3.HashString(key))
+			if hashTags {
+				expected = fmt.Sprintf("prefix:{%s}:log", key)
+			}
+			if got := limitCounter.StateKey(key, "log"); got != expected {
+				t.Errorf("hash tags %v: unexpected state key %q, expected %q", hashTags, got, expected)
+			}
+		}
+	}
+}
+
+func TestKeyBuildAllocs(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	window := time.Now().UTC().Truncate(time.Minute)
+	for _, hashTags := range []bool{false, true} {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(redisPort),
+			UseHashTags:      hashTags,
+			FallbackDisabled: true,
+		})
+		defer limitCounter.Close()
+
+		// The key string itself is the only allocation.
+		allocs := testing.AllocsPerRun(100, func() {
+			limitCounter.LimitCounterKey("127.0.0.1", window)
+			limitCounter.LimitCounterKey("127.0.0.1", window.Add(200*time.Millisecond))
+		})
+		if allocs > 2 {
+			t.Errorf("hash tags %v: unexpected %v allocations per two keys, expected at most 2", hashTags, allocs)
+		}
+	}
+}
+
+func BenchmarkKeyBuild(b *testing.B) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	window := time.Now().UTC().Truncate(time.Minute)
+	for _, hashTags := range []bool{false, true} {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(redisPort),
+			UseHashTags:      hashTags,
+			FallbackDisabled: true,
+		})
+		defer limitCounter.Close()
+
+		b.Run(fmt.Sprintf("hashTags=%v", hashTags), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				limitCounter.LimitCounterKey("127.0.0.1", window)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package httprateredis
+
+import "github.com/go-chi/httprate"
+
+// LimitCounter is httprate.LimitCounter plus Close. It's implemented by the
+// Redis counter returned by NewCounter and by the in-memory NewInMemoryCounter,
+// so code depending on it can be unit tested without Redis.
+type LimitCounter interface {
+	httprate.LimitCounter
+	Close() error
+}
+
+var _ LimitCounter = (*redisCounter)(nil)
+
+// NewLocalCounter is NewInMemoryCounter(nil), as a LimitCounter.
+//
+// Deprecated: Use NewInMemoryCounter.
+func NewLocalCounter() LimitCounter {
+	return NewInMemoryCounter(nil)
+}
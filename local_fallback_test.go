@@ -1,9 +1,12 @@
 package httprateredis_test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"net"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -92,3 +95,133 @@ func TestLocalFallback(t *testing.T) {
 	}
 
 }
+
+// Test that the local in-memory counter keeps counting during a Redis outage,
+// and that the counter switches back to Redis once it recovers.
+func TestLocalFallbackCounting(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	fallbackChanges := make(chan bool, 2)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		ClientName:       "httprateredis_test",
+		PrefixKey:        fmt.Sprintf("httprate:test:%v", rand.Int31n(100000)), // Unique Redis key for each test
+		FallbackTimeout:  200 * time.Millisecond,
+		OnFallbackChange: func(activated bool) { fallbackChanges <- activated },
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if err := limitCounter.Increment("key:fallback", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	redis.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.Increment("key:fallback", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if activated := <-fallbackChanges; !activated {
+		t.Fatal("fallback should be activated after we simulate redis failure")
+	}
+
+	curr, _, err := limitCounter.Get("key:fallback", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 {
+		t.Errorf("unexpected fallback curr = %v, expected 3", curr)
+	}
+
+	if err := redis.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case activated := <-fallbackChanges:
+		if activated {
+			t.Fatal("fallback should be deactivated after redis recovers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fallback wasn't deactivated after redis recovered")
+	}
+
+	curr, _, err = limitCounter.Get("key:fallback", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 {
+		t.Errorf("unexpected redis curr = %v, expected 2", curr)
+	}
+}
+
+func TestOnFallback(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var mu sync.Mutex
+	var fallbackErrs []error
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  200 * time.Millisecond,
+		FailureThreshold: 3,
+		CooldownPeriod:   time.Minute,
+		OnFallback: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fallbackErrs = append(fallbackErrs, err)
+		},
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	if err := limitCounter.Increment("key:fallback", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	redis.Close()
+
+	// Three failed Redis commands open the breaker, the rest
+	// is served by the fallback without hitting Redis.
+	for i := 0; i < 5; i++ {
+		if err := limitCounter.Increment("key:fallback", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(fallbackErrs) != 3 {
+		t.Fatalf("onFallback() called %d times, expected 3", len(fallbackErrs))
+	}
+	for _, err := range fallbackErrs {
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			t.Errorf("unexpected error %v, expected underlying *net.OpError", err)
+		}
+	}
+}
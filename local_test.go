@@ -0,0 +1,52 @@
+package httprateredis_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+// newLimitedHandler is how a consumer would wire the counter, depending only
+// on the LimitCounter interface.
+func newLimitedHandler(limitCounter httprateredis.LimitCounter) http.Handler {
+	limiter := httprate.Limit(2, time.Minute, httprate.WithLimitCounter(limitCounter))
+	return limiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+func TestLimitCounterInterface(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	redisPort, _ := strconv.Atoi(mr.Port())
+
+	counters := map[string]httprateredis.LimitCounter{
+		"redis": httprateredis.NewCounter(&httprateredis.Config{
+			Host:             mr.Host(),
+			Port:             uint16(redisPort),
+			FallbackDisabled: true,
+		}),
+		"local": httprateredis.NewLocalCounter(),
+	}
+	for name, limitCounter := range counters {
+		t.Run(name, func(t *testing.T) {
+			defer limitCounter.Close()
+
+			handler := newLimitedHandler(limitCounter)
+			for i, status := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+				if rec.Code != status {
+					t.Errorf("request %d: unexpected status %v, expected %v", i, rec.Code, status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package httprateredis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Logger logs counter events. Successful operations are never logged.
+type Logger interface {
+	// Errorf logs failed Redis commands and the local in-memory fallback activation.
+	Errorf(format string, args ...any)
+	// Debugf logs the fallback deactivation and Lua script reloads.
+	Debugf(format string, args ...any)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Errorf(format string, args ...any) {}
+func (noopLogger) Debugf(format string, args ...any) {}
+
+// slogLogger is the Logger of Config.Slog. The first error among the args is
+// also logged as the "error" attribute.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) Errorf(format string, args ...any) { l.log(slog.LevelError, format, args) }
+func (l slogLogger) Debugf(format string, args ...any) { l.log(slog.LevelDebug, format, args) }
+
+func (l slogLogger) log(level slog.Level, format string, args []any) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	var attrs []slog.Attr
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			attrs = append(attrs, slog.Any("error", err))
+			break
+		}
+	}
+	l.logger.LogAttrs(ctx, level, fmt.Sprintf(format, args...), attrs...)
+}
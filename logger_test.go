@@ -0,0 +1,192 @@
+package httprateredis_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestLogger(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	logger := &testLogger{}
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  50 * time.Millisecond,
+		Logger:          logger,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// The first increment loads the script, successful operations are not logged.
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.Increment("key:logger", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := limitCounter.Get("key:logger", currentWindow, previousWindow); err != nil {
+		t.Fatal(err)
+	}
+	if lines := logger.get(); len(lines) != 1 || !strings.HasPrefix(lines[0], "DEBUG httprateredis: script") {
+		t.Fatalf("unexpected log output %q, expected the script load only", lines)
+	}
+
+	logger.reset()
+	redis.Close()
+
+	if err := limitCounter.Increment("key:logger", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	lines := logger.get()
+	if len(lines) != 2 {
+		t.Fatalf("unexpected log output %q, expected 2 lines", lines)
+	}
+	if !strings.HasPrefix(lines[0], "ERROR httprateredis: redis incr failed") {
+		t.Errorf("unexpected log line %q, expected the Redis error", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "ERROR httprateredis: local in-memory fallback activated") {
+		t.Errorf("unexpected log line %q, expected the fallback activation", lines[1])
+	}
+
+	logger.reset()
+	if err := redis.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for limitCounter.IsFallbackActivated() {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("fallback should be deactivated after Redis restart")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lines := logger.get(); len(lines) != 1 || !strings.HasPrefix(lines[0], "DEBUG httprateredis: local in-memory fallback deactivated") {
+		t.Errorf("unexpected log output %q, expected the fallback deactivation", lines)
+	}
+}
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Errorf(format string, args ...any) {
+	l.log("ERROR " + fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Debugf(format string, args ...any) {
+	l.log("DEBUG " + fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) log(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, line)
+}
+
+func (l *testLogger) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func (l *testLogger) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = nil
+}
+
+func TestSlog(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var buf syncBuffer
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		PrefixKey:       "httprate:slog",
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  time.Hour,
+		Slog:            slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.Increment("key:slog", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	redis.Close()
+	if err := limitCounter.Increment("key:slog", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid slog record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	// The script load, the failed increment and the fallback activation.
+	if len(records) != 3 {
+		t.Fatalf("unexpected slog records %v, expected 3", records)
+	}
+	if records[0]["level"] != "DEBUG" || !strings.HasPrefix(records[0]["msg"].(string), "httprateredis: script") {
+		t.Errorf("unexpected record %v, expected the script load", records[0])
+	}
+	for _, record := range records {
+		if record["prefix"] != "httprate:slog" || record["db"] != float64(0) {
+			t.Errorf("unexpected record %v, expected the prefix and db attributes", record)
+		}
+	}
+	for _, record := range records[1:] {
+		if record["level"] != "ERROR" || record["error"] == nil || record["error"] == "" {
+			t.Errorf("unexpected record %v, expected an error with the error attribute", record)
+		}
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
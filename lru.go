@@ -0,0 +1,125 @@
+package httprateredis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// newFallbackCounter returns the local in-memory fallback counter, bounded to
+// maxKeys rate-limit keys if maxKeys > 0.
+func newFallbackCounter(maxKeys int, windowLength time.Duration) httprate.LimitCounter {
+	if maxKeys > 0 {
+		return newLRUCounter(maxKeys)
+	}
+	return httprate.NewLocalLimitCounter(windowLength)
+}
+
+// lruCounter is a sliding window counter holding the counts of up to maxKeys
+// rate-limit keys, evicting the least recently used key when full. Evicted keys
+// count from zero on the next access.
+type lruCounter struct {
+	mu      sync.Mutex
+	maxKeys int
+	keys    map[string]*list.Element
+	lru     list.List // of *lruEntry, the most recently used first
+}
+
+// lruEntry holds the counts of the last two windows of a rate-limit key.
+type lruEntry struct {
+	key     string
+	windows [2]lruWindow // the latest first
+}
+
+type lruWindow struct {
+	window time.Time
+	count  int
+}
+
+// add adds amount to the count of window. The slots are matched by window, so
+// an increment of the previous window landing after one of the current window,
+// e.g. racing at the window boundary, doesn't drop the current count. Only a
+// window newer than the latest shifts the slots, and windows older than both
+// slots are not counted.
+func (e *lruEntry) add(window time.Time, amount int) {
+	switch {
+	case e.windows[0].window.Equal(window):
+		e.windows[0].count += amount
+	case e.windows[1].window.Equal(window):
+		e.windows[1].count += amount
+	case window.After(e.windows[0].window):
+		e.windows[1] = e.windows[0]
+		e.windows[0] = lruWindow{window: window, count: amount}
+	case window.After(e.windows[1].window):
+		e.windows[1] = lruWindow{window: window, count: amount}
+	}
+}
+
+// counts returns the counts of currentWindow and previousWindow.
+func (e *lruEntry) counts(currentWindow, previousWindow time.Time) (curr, prev int) {
+	for _, w := range e.windows {
+		switch {
+		case w.window.Equal(currentWindow):
+			curr = w.count
+		case w.window.Equal(previousWindow):
+			prev = w.count
+		}
+	}
+	return curr, prev
+}
+
+func newLRUCounter(maxKeys int) *lruCounter {
+	return &lruCounter{
+		maxKeys: maxKeys,
+		keys:    make(map[string]*list.Element, maxKeys),
+	}
+}
+
+func (c *lruCounter) Config(requestLimit int, windowLength time.Duration) {}
+
+func (c *lruCounter) Increment(key string, currentWindow time.Time) error {
+	return c.IncrementBy(key, currentWindow, 1)
+}
+
+func (c *lruCounter) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.keys[key]
+	if !ok {
+		if c.lru.Len() >= c.maxKeys {
+			oldest := c.lru.Back()
+			delete(c.keys, oldest.Value.(*lruEntry).key)
+			c.lru.Remove(oldest)
+		}
+		elem = c.lru.PushFront(&lruEntry{key: key})
+		c.keys[key] = elem
+	} else {
+		c.lru.MoveToFront(elem)
+	}
+
+	elem.Value.(*lruEntry).add(currentWindow, amount)
+	return nil
+}
+
+func (c *lruCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.keys[key]
+	if !ok {
+		return 0, 0, nil
+	}
+	c.lru.MoveToFront(elem)
+	curr, prev := elem.Value.(*lruEntry).counts(currentWindow, previousWindow)
+	return curr, prev, nil
+}
+
+// Len returns the number of rate-limit keys held.
+func (c *lruCounter) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,126 @@
+package httprateredis_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestFallbackMaxKeys(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisHost, redisPort := redis.Host(), redis.Port()
+	redis.Close() // Redis is down, all requests are served by the fallback.
+	port, _ := strconv.Atoi(redisPort)
+
+	const maxKeys = 10
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redisHost,
+		Port:            uint16(port),
+		FallbackMaxKeys: maxKeys,
+		FallbackTimeout: 50 * time.Millisecond,
+		CooldownPeriod:  time.Hour,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:first", previousWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:first", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	if curr, prev, _ := limitCounter.Get("key:first", currentWindow, previousWindow); curr != 3 || prev != 2 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 3, 2", curr, prev)
+	}
+
+	// Overflow the bound concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("key:%d:%d", i, j)
+				if err := limitCounter.IncrementBy(key, currentWindow, 1); err != nil {
+					t.Error(err)
+				}
+				if _, _, err := limitCounter.Get(key, currentWindow, previousWindow); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := limitCounter.FallbackLen(); n != maxKeys {
+		t.Errorf("unexpected %v keys in the fallback, expected %v", n, maxKeys)
+	}
+	if curr, prev, _ := limitCounter.Get("key:first", currentWindow, previousWindow); curr != 0 || prev != 0 {
+		t.Errorf("unexpected curr = %v, prev = %v of the evicted key, expected 0, 0", curr, prev)
+	}
+
+	// The most recently used keys are kept.
+	for i := 0; i < maxKeys; i++ {
+		if err := limitCounter.IncrementBy(fmt.Sprintf("key:recent:%d", i), currentWindow, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < maxKeys; i++ {
+		if curr, _, _ := limitCounter.Get(fmt.Sprintf("key:recent:%d", i), currentWindow, previousWindow); curr != i {
+			t.Errorf("unexpected curr = %v of a recent key, expected %v", curr, i)
+		}
+	}
+}
+
+func TestFallbackMaxKeysOutOfOrder(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisHost, redisPort := redis.Host(), redis.Port()
+	redis.Close() // Redis is down, all requests are served by the fallback.
+	port, _ := strconv.Atoi(redisPort)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redisHost,
+		Port:            uint16(port),
+		FallbackMaxKeys: 10,
+		FallbackTimeout: 50 * time.Millisecond,
+		CooldownPeriod:  time.Hour,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// An increment of the previous window lands after one of the current
+	// window, then an increment of a window older than both.
+	for _, inc := range []struct {
+		window time.Time
+		amount int
+	}{
+		{currentWindow, 5},
+		{previousWindow, 1},
+		{currentWindow, 1},
+		{previousWindow.Add(-time.Minute), 7},
+	} {
+		if err := limitCounter.IncrementBy("key", inc.window, inc.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if curr, prev, _ := limitCounter.Get("key", currentWindow, previousWindow); curr != 6 || prev != 1 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 6, 1", curr, prev)
+	}
+}
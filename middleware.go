@@ -0,0 +1,99 @@
+package httprateredis
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// Limit returns a net/http middleware like httprate.Limit, limiting requests by
+// the rate-limit key returned by keyFunc (e.g. httprate.KeyByIP), which checks
+// and counts each request by AllowN instead of the separate Get and IncrementBy
+// calls of httprate, so concurrent requests never overshoot the limit. The
+// limit and window length are the ones set by Config (or by LimitFunc), or the
+// tiers of AddTier if any, like AllowN.
+//
+// It sets the X-RateLimit-* headers of httprate, and responds with HTTP 429 when
+// the limit is exceeded or with HTTP 428 on errors, the same as httprate. The
+// Retry-After header of HTTP 429 is RetryAfter of the key (or of the exceeded
+// tier), in whole seconds rounded up, at least 1.
+func (c *redisCounter) Limit(keyFunc httprate.KeyFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := keyFunc(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusPreconditionRequired)
+				return
+			}
+
+			d, err := c.decideRequest(r.Context(), key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusPreconditionRequired)
+				return
+			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(d.limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(0, d.limit-d.used)))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(d.resetAt.Unix(), 10))
+			if !d.allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(c.retryAfterSeconds(r.Context(), key, d.tier))) // RFC 6585
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestDecision is the decision of Limit on a request.
+type requestDecision struct {
+	allowed bool
+	used    int
+	limit   int
+	resetAt time.Time
+	tier    *tier // the exceeded tier, or the one with the least headroom
+}
+
+// decideRequest makes the decision of Limit by the tiers of AddTier, if any,
+// like AllowN.
+func (c *redisCounter) decideRequest(ctx context.Context, key string) (requestDecision, error) {
+	tiers := c.loadTiers()
+	if len(tiers) == 0 {
+		allowed, used, requestLimit, err := c.decide(ctx, key, 1)
+		if err != nil {
+			return requestDecision{}, err
+		}
+		return requestDecision{allowed: allowed, used: used, limit: requestLimit, resetAt: c.ResetAt(key)}, nil
+	}
+
+	if !c.plainSlidingWindow() {
+		return requestDecision{}, errTiersMode
+	}
+	allowed, t, used, err := c.decideTiers(ctx, key, 1, tiers)
+	if err != nil {
+		return requestDecision{}, err
+	}
+	resetAt := c.now().UTC().Truncate(t.Window).Add(t.Window)
+	return requestDecision{allowed: allowed, used: used, limit: t.Limit, resetAt: resetAt, tier: t}, nil
+}
+
+// retryAfterSeconds returns RetryAfter of the key, or of its tier if any, for
+// the Retry-After header, rounded up to whole seconds and at least 1, as the
+// request was just limited. If RetryAfter fails, it's the window length.
+func (c *redisCounter) retryAfterSeconds(ctx context.Context, key string, t *tier) int {
+	var (
+		retryAfter time.Duration
+		err        error
+	)
+	if t != nil {
+		if retryAfter, err = c.tierRetryAfter(ctx, key, t); err != nil {
+			retryAfter = t.Window
+		}
+	} else if retryAfter, err = c.RetryAfter(ctx, key); err != nil {
+		_, retryAfter = c.limits(key)
+	}
+	return max(1, int(math.Ceil(retryAfter.Seconds())))
+}
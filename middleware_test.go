@@ -0,0 +1,223 @@
+package httprateredis_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestLimitMiddleware(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		MaxActive:        50,
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	const limit = 50
+	limitCounter.Config(limit, time.Hour)
+
+	ts := httptest.NewServer(limitCounter.Limit(httprate.Key("key:middleware"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer ts.Close()
+
+	var (
+		wg                 sync.WaitGroup
+		ok, limited, other atomic.Int64
+	)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(ts.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			switch resp.StatusCode {
+			case http.StatusOK:
+				ok.Add(1)
+			case http.StatusTooManyRequests:
+				limited.Add(1)
+				if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+					t.Errorf("unexpected X-RateLimit-Remaining %q, expected 0", resp.Header.Get("X-RateLimit-Remaining"))
+				}
+			default:
+				other.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ok.Load() != limit || limited.Load() != 200-limit || other.Load() != 0 {
+		t.Errorf("unexpected %v OK, %v limited and %v other responses, expected %v OK", ok.Load(), limited.Load(), other.Load(), limit)
+	}
+	used, err := limitCounter.Peek(context.Background(), "key:middleware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used > limit {
+		t.Errorf("unexpected rate %v overshooting the limit %v", used, limit)
+	}
+}
+
+func TestLimitMiddlewareRetryAfter(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	// Half way into the window, the previous window count is weighted by 0.5.
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	now := currentWindow.Add(30 * time.Second)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+	limitCounter.Config(10, time.Minute)
+	if err := limitCounter.IncrementBy("key:retry-after", currentWindow.Add(-time.Minute), 16); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(limitCounter.Limit(httprate.Key("key:retry-after"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer ts.Close()
+
+	var resp *http.Response
+	for i := 0; i < 10; i++ {
+		if resp, err = http.Get(ts.URL); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			break
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %v, expected %v", resp.StatusCode, http.StatusTooManyRequests)
+	}
+
+	// The previous window count decays well before the window ends.
+	retryAfter, err := limitCounter.RetryAfter(context.Background(), "key:retry-after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds()))))
+	if header := resp.Header.Get("Retry-After"); header != expected || header == "60" {
+		t.Errorf("unexpected Retry-After %q, expected %q of RetryAfter %v", header, expected, retryAfter)
+	}
+
+	// An exhausted current window is limited well into the next one, a
+	// fraction of a second is rounded up.
+	now = currentWindow.Add(time.Minute - 500*time.Millisecond)
+	if err := limitCounter.Reset(context.Background(), "key:retry-after"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:retry-after", currentWindow, 10); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = http.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %v, expected %v", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if header := resp.Header.Get("Retry-After"); header != "7" {
+		t.Errorf("unexpected Retry-After %q, expected %q", header, "7")
+	}
+}
+
+func TestLimitMiddlewareTiers(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	windowStart := time.Now().UTC().Truncate(time.Minute)
+	now := windowStart.Add(10 * time.Second)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	// No Config, the tiers only.
+	limitCounter.AddTier(3, time.Second)
+	limitCounter.AddTier(5, time.Minute)
+
+	ts := httptest.NewServer(limitCounter.Limit(httprate.Key("key:tiers"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer ts.Close()
+
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		requests   int
+		limit      string
+		retryAfter string
+	}{
+		{name: "per second", requests: 3, limit: "3", retryAfter: "2"},
+		{name: "per minute", advance: 2 * time.Second, requests: 2, limit: "5", retryAfter: "60"},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		for i := 0; i < tt.requests; i++ {
+			if resp := get(); resp.StatusCode != http.StatusOK {
+				t.Fatalf("%v: unexpected status %v of request %v, expected %v", tt.name, resp.StatusCode, i+1, http.StatusOK)
+			}
+		}
+		resp := get()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("%v: unexpected status %v, expected %v", tt.name, resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != tt.limit {
+			t.Errorf("%v: unexpected X-RateLimit-Limit %q, expected %q of the exceeded tier", tt.name, limit, tt.limit)
+		}
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != tt.retryAfter {
+			t.Errorf("%v: unexpected Retry-After %q, expected %q", tt.name, retryAfter, tt.retryAfter)
+		}
+	}
+}
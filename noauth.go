@@ -0,0 +1,131 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// noAuthHook re-authenticates the connections which lost their authentication,
+// e.g. after a failover or an ACL reload, and which reply NOAUTH to all the
+// commands from then on. go-redis authenticates the connections only when it
+// opens them, and keeps them in the pool on NOAUTH, as it's an error reply.
+//
+// On NOAUTH, the command is sent once more in a pipeline after AUTH with the
+// configured credentials, fetched again by Config.PasswordFunc if supplied,
+// which go-redis sends on a single connection, likely the one which replied
+// NOAUTH. The command was not run on NOAUTH, so it's safe to resend a
+// non-idempotent INCRBY. It's installed on the clients created by NewCounter
+// with a password, i.e. not in cluster mode nor with ShardAddrs, where the
+// pipeline may not reach the same node. It must be added before the other
+// hooks, so it doesn't hold a pool slot of poolWaitHook while resending.
+type noAuthHook struct {
+	client   *redis.Client
+	username string
+	password func() (string, error)
+}
+
+var _ redis.Hook = (*noAuthHook)(nil)
+
+// errReauth wraps the AUTH error of a failed re-authentication.
+var errReauth = errors.New("redis re-authentication failed")
+
+func newNoAuthHook(client *redis.Client, username string, password func() (string, error)) *noAuthHook {
+	return &noAuthHook{client: client, username: username, password: password}
+}
+
+func (h *noAuthHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *noAuthHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if !isNoAuthError(err) {
+			return err
+		}
+		return h.reauth(ctx, []redis.Cmder{cmd}, func(ctx context.Context, cmds []redis.Cmder) error {
+			_, err := h.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, cmd := range cmds {
+					_ = pipe.Process(ctx, cmd)
+				}
+				return nil
+			})
+			return err
+		})
+	}
+}
+
+func (h *noAuthHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			if !isNoAuthError(cmd.Err()) {
+				return err
+			}
+		}
+		if len(cmds) == 0 {
+			return err
+		}
+		return h.reauth(ctx, cmds, next)
+	}
+}
+
+// reauth sends AUTH followed by the commands which failed by NOAUTH in a single
+// pipeline, failing them with ErrAuthFailed if AUTH fails.
+func (h *noAuthHook) reauth(ctx context.Context, cmds []redis.Cmder, pipeline redis.ProcessPipelineHook) error {
+	password, err := h.password()
+	if err != nil {
+		for _, cmd := range cmds {
+			cmd.SetErr(err)
+		}
+		return err
+	}
+	args := []any{"auth", password}
+	if h.username != "" {
+		args = []any{"auth", h.username, password}
+	}
+	auth := redis.NewStatusCmd(ctx, args...)
+
+	err = pipeline(ctx, append([]redis.Cmder{auth}, cmds...))
+	if authErr := auth.Err(); authErr != nil {
+		err = fmt.Errorf("%w: %w: %w", ErrAuthFailed, errReauth, authErr)
+		for _, cmd := range cmds {
+			cmd.SetErr(err)
+		}
+		return err
+	}
+	if err != nil {
+		// The first error of the commands, not of AUTH.
+		for _, cmd := range cmds {
+			if cmd.Err() != nil {
+				return cmd.Err()
+			}
+		}
+	}
+	return err
+}
+
+// isNoAuthError reports whether err is the NOAUTH reply of a connection which
+// is not authenticated.
+func isNoAuthError(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "NOAUTH")
+}
+
+// passwordFunc wraps the errors of Config.PasswordFunc with ErrAuthFailed.
+func passwordFunc(fn func() (string, error)) func() (string, error) {
+	return func() (string, error) {
+		password, err := fn()
+		if err != nil {
+			return "", fmt.Errorf("%w: PasswordFunc: %w", ErrAuthFailed, err)
+		}
+		return password, nil
+	}
+}
@@ -0,0 +1,53 @@
+package httprateredis
+
+import (
+	"context"
+	"time"
+)
+
+// defaultDedupTTL covers the retries of clients with exponential backoff.
+const defaultDedupTTL = 5 * time.Minute
+
+// IncrementOnce is like IncrementByCtx, but counts the given request ID only
+// once within DedupTTL, so retries of the same logical request (e.g. with an
+// idempotency key) don't count twice. The first call sets a marker of the
+// request ID by SET NX, so of concurrent calls with the same ID only one
+// increments. If the increment fails, the marker is deleted again, so that
+// a retry is counted.
+//
+// Without Redis (e.g. while the local in-memory fallback is activated), the
+// increment is handled like by IncrementByCtx, but not deduplicated.
+func (c *redisCounter) IncrementOnce(ctx context.Context, key, requestID string, currentWindow time.Time, amount int) error {
+	if !c.begin() {
+		return errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return nil
+	}
+	if c.breaker.isOpen() {
+		return c.IncrementByCtx(ctx, key, currentWindow, amount)
+	}
+
+	markerKey := c.stateKey(key, "once:"+requestID)
+
+	var first bool
+	err := c.withRetry(ctx, false, func() (err error) {
+		first, err = c.clientFor(key).SetNX(ctx, markerKey, 1, c.dedupTTL).Result()
+		return err
+	})
+	if err != nil {
+		c.logger.Debugf("httprateredis: redis set nx failed, incrementing without deduplication: %v", err)
+		return c.IncrementByCtx(ctx, key, currentWindow, amount)
+	}
+	if !first {
+		return nil
+	}
+
+	if err := c.IncrementByCtx(ctx, key, currentWindow, amount); err != nil {
+		// Best effort, the marker expires after DedupTTL anyway.
+		c.clientFor(key).Del(context.WithoutCancel(ctx), markerKey)
+		return err
+	}
+	return nil
+}
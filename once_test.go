@@ -0,0 +1,114 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestIncrementOnce(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		DedupTTL:         time.Minute,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	ctx := context.Background()
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// Concurrent retries of the same request.
+	var g errgroup.Group
+	for i := 0; i < 50; i++ {
+		g.Go(func() error {
+			return limitCounter.IncrementOnce(ctx, "key:once", "request-1", currentWindow, 3)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	curr, _, err := limitCounter.Get("key:once", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 {
+		t.Errorf("unexpected curr = %v, expected a single increment by 3", curr)
+	}
+
+	// Other request IDs count.
+	if err := limitCounter.IncrementOnce(ctx, "key:once", "request-2", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, _ = limitCounter.Get("key:once", currentWindow, previousWindow)
+	if curr != 4 {
+		t.Errorf("unexpected curr = %v, expected 4", curr)
+	}
+
+	// The request ID is forgotten after DedupTTL.
+	redis.FastForward(time.Minute)
+	if err := limitCounter.IncrementOnce(ctx, "key:once", "request-1", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, _ = limitCounter.Get("key:once", currentWindow, previousWindow)
+	if curr != 7 {
+		t.Errorf("unexpected curr = %v, expected 7", curr)
+	}
+}
+
+func TestIncrementOnceFailure(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	ctx := context.Background()
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// A failed increment must not mark the request as counted.
+	if err := limitCounter.IncrementBy("key:fail", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	counterKey := redis.Keys()[0]
+	redis.Set(counterKey, "not a number")
+	if err := limitCounter.IncrementOnce(ctx, "key:fail", "request-1", currentWindow, 1); err == nil {
+		t.Fatal("expected error incrementing a non-integer counter")
+	}
+	redis.Del(counterKey)
+	if err := limitCounter.IncrementOnce(ctx, "key:fail", "request-1", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, err := limitCounter.Get("key:fail", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 1 {
+		t.Errorf("unexpected curr = %v, expected the retry to be counted", curr)
+	}
+}
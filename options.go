@@ -0,0 +1,160 @@
+package httprateredis
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Option sets a Config field. Options are applied in order, so later options
+// override earlier ones.
+type Option func(cfg *Config)
+
+// NewCounterWithOptions is like NewCounter, but configured by options instead of
+// a Config struct. Without options, it connects to 127.0.0.1:6379.
+func NewCounterWithOptions(opts ...Option) *redisCounter {
+	cfg := &Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return NewCounter(cfg)
+}
+
+func WithHost(host string) Option {
+	return func(cfg *Config) { cfg.Host = host }
+}
+
+func WithPort(port uint16) Option {
+	return func(cfg *Config) { cfg.Port = port }
+}
+
+func WithAuth(username, password string) Option {
+	return func(cfg *Config) {
+		cfg.Username = username
+		cfg.Password = password
+	}
+}
+
+// WithPasswordFunc sets the function returning the password of each new
+// connection, see Config.PasswordFunc.
+func WithPasswordFunc(fn func() (string, error)) Option {
+	return func(cfg *Config) { cfg.PasswordFunc = fn }
+}
+
+// WithMaxConnLifetime sets the age of the pooled connections after which they
+// are replaced, see Config.MaxConnLifetime.
+func WithMaxConnLifetime(d time.Duration) Option {
+	return func(cfg *Config) { cfg.MaxConnLifetime = d }
+}
+
+func WithDB(index int) Option {
+	return func(cfg *Config) { cfg.DBIndex = index }
+}
+
+func WithPrefix(prefix string) Option {
+	return func(cfg *Config) { cfg.PrefixKey = prefix }
+}
+
+func WithClientName(name string) Option {
+	return func(cfg *Config) { cfg.ClientName = name }
+}
+
+func WithWindowLength(windowLength time.Duration) Option {
+	return func(cfg *Config) { cfg.WindowLength = windowLength }
+}
+
+func WithMode(mode Mode) Option {
+	return func(cfg *Config) { cfg.Mode = mode }
+}
+
+func WithWarnThreshold(threshold float64) Option {
+	return func(cfg *Config) { cfg.WarnThreshold = threshold }
+}
+
+func WithTokenBucket(refillRate float64, burst int) Option {
+	return func(cfg *Config) {
+		cfg.RefillRate = refillRate
+		cfg.Burst = burst
+	}
+}
+
+func WithMaxInFlight(maxInFlight int, ttl time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.MaxInFlight = maxInFlight
+		cfg.InFlightTTL = ttl
+	}
+}
+
+func WithLimitFunc(limitFunc func(key string) (limit int, window time.Duration)) Option {
+	return func(cfg *Config) { cfg.LimitFunc = limitFunc }
+}
+
+func WithKeyFunc(keyFunc func(key string, window time.Time) string) Option {
+	return func(cfg *Config) { cfg.KeyFunc = keyFunc }
+}
+
+func WithPool(maxIdle, maxActive int) Option {
+	return func(cfg *Config) {
+		cfg.MaxIdle = maxIdle
+		cfg.MaxActive = maxActive
+	}
+}
+
+// WithTLS enables TLS. A nil tlsConfig uses the default tls.Config.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *Config) {
+		cfg.TLSEnabled = true
+		cfg.TLSConfig = tlsConfig
+	}
+}
+
+// WithClient uses the given client instead of connecting to Host/Port.
+// See Config.Client and Config.OwnsClient.
+func WithClient(client redis.UniversalClient, ownsClient bool) Option {
+	return func(cfg *Config) {
+		cfg.Client = client
+		cfg.OwnsClient = ownsClient
+	}
+}
+
+func WithFallbackDisabled() Option {
+	return func(cfg *Config) { cfg.FallbackDisabled = true }
+}
+
+func WithFallbackTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) { cfg.FallbackTimeout = timeout }
+}
+
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) { cfg.CommandTimeout = timeout }
+}
+
+func WithOnError(onError func(err error)) Option {
+	return func(cfg *Config) { cfg.OnError = onError }
+}
+
+func WithOnErrorAllow() Option {
+	return func(cfg *Config) { cfg.OnErrorAllow = true }
+}
+
+func WithLogger(logger Logger) Option {
+	return func(cfg *Config) { cfg.Logger = logger }
+}
+
+func WithSlog(logger *slog.Logger) Option {
+	return func(cfg *Config) { cfg.Slog = logger }
+}
+
+func WithTracer(tracer Tracer) Option {
+	return func(cfg *Config) { cfg.Tracer = tracer }
+}
+
+// WithClock sets the clock used to compute the current window in the methods
+// which don't take windows as arguments, e.g. Remaining, Peek and Reset, and
+// the current bucket of WindowBuckets. It's meant for deterministic tests.
+// Default: time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(cfg *Config) { cfg.now = now }
+}
@@ -0,0 +1,93 @@
+package httprateredis_test
+
+import (
+	"crypto/tls"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOptions(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "redis.example.com"}
+	client := redis.NewClient(&redis.Options{})
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		opts     []httprateredis.Option
+		expected httprateredis.Config
+	}{
+		{name: "WithHost", opts: []httprateredis.Option{httprateredis.WithHost("redis")}, expected: httprateredis.Config{Host: "redis"}},
+		{name: "WithPort", opts: []httprateredis.Option{httprateredis.WithPort(6380)}, expected: httprateredis.Config{Port: 6380}},
+		{name: "WithAuth", opts: []httprateredis.Option{httprateredis.WithAuth("user", "pass")}, expected: httprateredis.Config{Username: "user", Password: "pass"}},
+		{name: "WithDB", opts: []httprateredis.Option{httprateredis.WithDB(3)}, expected: httprateredis.Config{DBIndex: 3}},
+		{name: "WithPrefix", opts: []httprateredis.Option{httprateredis.WithPrefix("api")}, expected: httprateredis.Config{PrefixKey: "api"}},
+		{name: "WithClientName", opts: []httprateredis.Option{httprateredis.WithClientName("api")}, expected: httprateredis.Config{ClientName: "api"}},
+		{name: "WithWindowLength", opts: []httprateredis.Option{httprateredis.WithWindowLength(time.Hour)}, expected: httprateredis.Config{WindowLength: time.Hour}},
+		{name: "WithPool", opts: []httprateredis.Option{httprateredis.WithPool(2, 20)}, expected: httprateredis.Config{MaxIdle: 2, MaxActive: 20}},
+		{name: "WithTLS", opts: []httprateredis.Option{httprateredis.WithTLS(tlsConfig)}, expected: httprateredis.Config{TLSEnabled: true, TLSConfig: tlsConfig}},
+		{name: "WithClient", opts: []httprateredis.Option{httprateredis.WithClient(client, true)}, expected: httprateredis.Config{Client: client, OwnsClient: true}},
+		{name: "WithFallbackDisabled", opts: []httprateredis.Option{httprateredis.WithFallbackDisabled()}, expected: httprateredis.Config{FallbackDisabled: true}},
+		{name: "WithFallbackTimeout", opts: []httprateredis.Option{httprateredis.WithFallbackTimeout(time.Second)}, expected: httprateredis.Config{FallbackTimeout: time.Second}},
+		{name: "WithCommandTimeout", opts: []httprateredis.Option{httprateredis.WithCommandTimeout(50 * time.Millisecond)}, expected: httprateredis.Config{CommandTimeout: 50 * time.Millisecond}},
+		{name: "WithMaxConnLifetime", opts: []httprateredis.Option{httprateredis.WithMaxConnLifetime(time.Hour)}, expected: httprateredis.Config{MaxConnLifetime: time.Hour}},
+		{name: "WithOnErrorAllow", opts: []httprateredis.Option{httprateredis.WithOnErrorAllow()}, expected: httprateredis.Config{OnErrorAllow: true}},
+		{
+			name:     "later options override earlier ones",
+			opts:     []httprateredis.Option{httprateredis.WithHost("a"), httprateredis.WithPort(1), httprateredis.WithHost("b")},
+			expected: httprateredis.Config{Host: "b", Port: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg httprateredis.Config
+			for _, opt := range tt.opts {
+				opt(&cfg)
+			}
+			if !reflect.DeepEqual(cfg, tt.expected) {
+				t.Errorf("unexpected config %+v, expected %+v", cfg, tt.expected)
+			}
+		})
+	}
+
+	// Func and interface fields can't be compared with DeepEqual.
+	var cfg httprateredis.Config
+	httprateredis.WithOnError(func(err error) {})(&cfg)
+	httprateredis.WithLogger(&testLogger{})(&cfg)
+	httprateredis.WithTracer(&testTracer{})(&cfg)
+	if cfg.OnError == nil || cfg.Logger == nil || cfg.Tracer == nil {
+		t.Errorf("unexpected config %+v, expected OnError, Logger and Tracer to be set", cfg)
+	}
+}
+
+func TestNewCounterWithOptions(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithPrefix("options"),
+		httprateredis.WithFallbackDisabled(),
+	)
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	if err := limitCounter.Increment("key:options", time.Now().UTC().Truncate(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if keys := redis.Keys(); len(keys) != 1 || !strings.HasPrefix(keys[0], "options:") {
+		t.Errorf("unexpected keys %v, expected a single key prefixed by options:", keys)
+	}
+}
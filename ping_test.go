@@ -0,0 +1,39 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestPing(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 200 * time.Millisecond,
+	})
+	defer limitCounter.Close()
+
+	if err := limitCounter.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	redis.Close()
+
+	if err := limitCounter.Ping(context.Background()); err == nil {
+		t.Error("expected error when Redis is down")
+	}
+	if limitCounter.IsFallbackActivated() {
+		t.Error("Ping() should not activate the fallback")
+	}
+}
@@ -0,0 +1,56 @@
+package httprateredis
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// poolWaitInterval is how often the pool stats are sampled for OnPoolWait.
+const poolWaitInterval = 100 * time.Millisecond
+
+// poolWaitReporter reports the waits for a free connection counted by the
+// go-redis pool to OnPoolWait. It samples the pool stats on a ticker, off the
+// command path, and reports the waits the pool counted since the previous
+// sample, so the wait time of the waits of a sample is their mean. It runs for
+// the clients created by NewCounter with a single pool, i.e. not in cluster
+// mode nor with ShardAddrs, if OnPoolWait is set.
+type poolWaitReporter struct {
+	client     *redis.Client
+	onPoolWait func(wait time.Duration)
+	waits      uint32 // WaitCount of the pool already reported
+	waitTime   int64  // WaitDurationNs of the pool already reported
+}
+
+func newPoolWaitReporter(client *redis.Client, onPoolWait func(wait time.Duration)) *poolWaitReporter {
+	return &poolWaitReporter{client: client, onPoolWait: onPoolWait}
+}
+
+// run reports the waits every interval until done is closed, then reports the
+// last ones.
+func (r *poolWaitReporter) run(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.report()
+		case <-done:
+			r.report()
+			return
+		}
+	}
+}
+
+// report calls onPoolWait for each wait of the pool not reported yet.
+func (r *poolWaitReporter) report() {
+	s := r.client.PoolStats()
+	if s.WaitCount <= r.waits {
+		return
+	}
+	waits, waitTime := s.WaitCount-r.waits, max(0, s.WaitDurationNs-r.waitTime)
+	r.waits, r.waitTime = s.WaitCount, max(r.waitTime, s.WaitDurationNs)
+	for i := uint32(0); i < waits; i++ {
+		r.onPoolWait(time.Duration(waitTime / int64(waits)))
+	}
+}
@@ -0,0 +1,42 @@
+package httprateredis
+
+import "context"
+
+// WithPrefix returns a counter using the PrefixKey prefix instead, which shares
+// the Redis client (and its connection pool) and the options of c, e.g. to
+// separate the keys of several subsystems without opening a pool for each.
+//
+// The returned counter has its own limits set by Config and AddTier, starting
+// with the limits of c, and its own local in-memory fallback and stats. Closing
+// it doesn't close the shared client, only closing c does, after which the
+// returned counter fails with ErrClosed too.
+// KeyFunc, if set, still builds the keys without any prefix.
+func (c *redisCounter) WithPrefix(prefix string) *redisCounter {
+	v := &redisCounter{
+		shared:         true,
+		prefixKey:      prefix,
+		done:           make(chan struct{}),
+		drained:        make(chan struct{}, 1),
+		counterOptions: c.counterOptions,
+	}
+	v.disabled.Store(c.disabled.Load())
+	v.initFallback(&v.fallbackOptions, "Redis", v.done, func() error {
+		return v.client.Ping(context.Background()).Err()
+	})
+	if c.secondary != nil {
+		v.secondary = c.secondary.WithPrefix(prefix)
+		v.fallbackCounter = v.secondary
+	} else if c.fallbackCounter != nil {
+		v.fallbackCounter = newFallbackCounter(c.fallbackMaxKeys, 0)
+	}
+	if v.resyncEnabled {
+		v.healthy = v.flushResync
+	}
+	if cfg := c.limitConfig.Load(); cfg != nil {
+		v.Config(cfg.requestLimit, cfg.windowLength)
+	}
+	for _, t := range c.loadTiers() {
+		v.AddTier(t.Limit, t.Window)
+	}
+	return v
+}
@@ -0,0 +1,82 @@
+package httprateredis_test
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestWithPrefix(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	redisPort, _ := strconv.Atoi(mr.Port())
+
+	base := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             mr.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer base.Close()
+	base.Config(1000, time.Minute)
+
+	api, auth := base.WithPrefix("api"), base.WithPrefix("auth")
+	auth.Config(10, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := api.IncrementBy("key", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.IncrementBy("key", currentWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		counter  httprateredis.LimitCounter
+		expected int
+	}{{base, 0}, {api, 3}, {auth, 5}}
+	for _, tt := range tests {
+		curr, _, err := tt.counter.Get("key", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != tt.expected {
+			t.Errorf("unexpected curr = %v, expected %v", curr, tt.expected)
+		}
+	}
+
+	keys := mr.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0][:4] != "api:" || keys[1][:5] != "auth:" {
+		t.Errorf("unexpected keys %v, expected one per prefix", keys)
+	}
+	if total := base.PoolStats().TotalConns; api.PoolStats().TotalConns != total {
+		t.Errorf("expected the views to share the connection pool of the base counter")
+	}
+
+	// Closing a view doesn't close the shared client.
+	if err := api.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.IncrementBy("key", currentWindow, 1); err == nil {
+		t.Error("expected an error from the closed view")
+	}
+	if err := auth.IncrementBy("key", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the base counter does.
+	if err := base.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.IncrementBy("key", currentWindow, 1); err == nil {
+		t.Error("expected an error once the base counter is closed")
+	}
+}
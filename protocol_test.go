@@ -0,0 +1,69 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestProtocol(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	for _, protocol := range []int{0, 2, 3} {
+		t.Run(strconv.Itoa(protocol), func(t *testing.T) {
+			redis.FlushAll()
+
+			limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				Protocol:         protocol,
+				FallbackDisabled: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer limitCounter.Close()
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			previousWindow := currentWindow.Add(-time.Minute)
+
+			if err := limitCounter.IncrementBy("key:protocol", previousWindow, 5); err != nil {
+				t.Fatal(err)
+			}
+			if err := limitCounter.IncrementBy("key:protocol", currentWindow, 2); err != nil {
+				t.Fatal(err)
+			}
+			curr, prev, err := limitCounter.Get("key:protocol", currentWindow, previousWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if curr != 2 || prev != 5 {
+				t.Errorf("unexpected curr = %v, prev = %v, expected 2, 5", curr, prev)
+			}
+			// The token bucket script replies with an array.
+			allowed, _, err := limitCounter.Take(context.Background(), "key:protocol", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !allowed {
+				t.Error("expected the token bucket to allow the request")
+			}
+		})
+	}
+
+	_, err = httprateredis.NewCounterWithError(&httprateredis.Config{Protocol: 4})
+	if !errors.Is(err, httprateredis.ErrInvalidConfig) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrInvalidConfig)
+	}
+}
@@ -0,0 +1,194 @@
+package httprateredis
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Remaining returns the remaining quota of the given rate-limit key, i.e. the
+// configured request limit minus the sliding window rate, the same number
+// httprate reports in the X-RateLimit-Remaining header. It never returns less
+// than 0. It returns an error if Config() wasn't called yet.
+func (c *redisCounter) Remaining(ctx context.Context, key string) (int, error) {
+	requestLimit, windowLength := c.limits(key)
+	if requestLimit <= 0 {
+		return 0, errNotConfigured
+	}
+	rate, err := c.rate(ctx, key, windowLength)
+	if err != nil {
+		return 0, err
+	}
+	return max(0, requestLimit-rate), nil
+}
+
+// State is the state of a rate-limit key reported by Status.
+type State int
+
+const (
+	// StateOK means the key is within the limit and below WarnThreshold.
+	StateOK State = iota
+	// StateWarn means the key is within the limit, but at or above WarnThreshold.
+	StateWarn
+	// StateBlocked means the key used up the limit, the next request is limited.
+	StateBlocked
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOK:
+		return "ok"
+	case StateWarn:
+		return "warn"
+	case StateBlocked:
+		return "blocked"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Status returns the sliding window rate and the request limit of the given
+// rate-limit key, and its state: StateBlocked if the rate reached the limit,
+// i.e. httprate limits the next request, StateWarn if it reached WarnThreshold
+// of the limit, StateOK otherwise. It returns an error if Config() wasn't
+// called yet.
+func (c *redisCounter) Status(ctx context.Context, key string) (used, limit int, state State, err error) {
+	limit, windowLength := c.limits(key)
+	if limit <= 0 {
+		return 0, 0, StateOK, errNotConfigured
+	}
+	used, err = c.rate(ctx, key, windowLength)
+	if err != nil {
+		return 0, limit, StateOK, err
+	}
+	switch {
+	case used >= limit:
+		state = StateBlocked
+	case c.warnThreshold > 0 && float64(used) >= c.warnThreshold*float64(limit):
+		state = StateWarn
+	}
+	return used, limit, state, nil
+}
+
+// Peek returns the sliding window rate of the given rate-limit key, i.e. the
+// used quota, without incrementing it. It's the counterpart of Remaining.
+func (c *redisCounter) Peek(ctx context.Context, key string) (used int, err error) {
+	_, windowLength := c.limits(key)
+	return c.rate(ctx, key, windowLength)
+}
+
+// ResetAt returns the end of the current window of the given rate-limit key,
+// the same time httprate reports in the X-RateLimit-Reset header. It returns
+// the zero time if Config() wasn't called yet.
+func (c *redisCounter) ResetAt(key string) time.Time {
+	_, windowLength := c.limits(key)
+	currentWindow, _, err := c.windows(c.now(), windowLength)
+	if err != nil {
+		return time.Time{}
+	}
+	return currentWindow.Add(windowLength)
+}
+
+// KeyTTL returns the TTL of the counter the next IncrementBy of the given
+// rate-limit key increments, i.e. the current window (or bucket) counter, or
+// the state key in ModeSlidingLog and ModeTokenBucket. It returns ErrKeyNotFound
+// if the counter doesn't exist and ErrNoExpiry if it exists without a TTL.
+func (c *redisCounter) KeyTTL(ctx context.Context, key string) (time.Duration, error) {
+	if !c.begin() {
+		return 0, errRefused
+	}
+	defer c.end()
+
+	_, windowLength := c.limits(key)
+	currentWindow, _, err := c.windows(c.now(), windowLength)
+	if err != nil {
+		return 0, err
+	}
+	hkey := c.incrementKey(key, currentWindow, windowLength)
+	switch c.mode {
+	case ModeSlidingLog:
+		hkey = c.stateKey(key, "log")
+	case ModeTokenBucket:
+		hkey = c.stateKey(key, "bucket")
+	}
+
+	var ttl time.Duration
+	err = c.withRetry(ctx, true, func() (err error) {
+		ttl, err = c.clientFor(key).PTTL(ctx, hkey).Result()
+		return err
+	})
+	if err != nil {
+		return 0, c.wrapError(ctx, "redis pttl failed", err)
+	}
+	// go-redis returns the -1 and -2 replies as is, not in milliseconds.
+	switch ttl {
+	case -1:
+		return 0, ErrNoExpiry
+	case -2:
+		return 0, ErrKeyNotFound
+	}
+	return ttl, nil
+}
+
+// RetryAfter returns the time until the given rate-limit key is allowed one more
+// request, or 0 if it's allowed now, e.g. for the Retry-After header.
+//
+// The sliding window rate only drops as the previous window count weight decays,
+// so RetryAfter approximates when the rate gets under the limit, assuming no
+// other requests arrive meanwhile. It's exact in ModeSlidingWindow only; in the
+// other modes, it's the time until the current window counts as the previous one.
+func (c *redisCounter) RetryAfter(ctx context.Context, key string) (time.Duration, error) {
+	requestLimit, windowLength := c.limits(key)
+	if requestLimit <= 0 {
+		return 0, errNotConfigured
+	}
+	now := c.now().UTC()
+	currentWindow, previousWindow, err := c.windows(now, windowLength)
+	if err != nil {
+		return 0, err
+	}
+
+	curr, prev, err := c.GetCtx(ctx, key, currentWindow, previousWindow)
+	if err != nil {
+		return 0, err
+	}
+	return retryAfter(curr, prev, requestLimit, currentWindow, now, windowLength), nil
+}
+
+// retryAfter returns the time from now until the rate of the given window
+// counts drops enough to allow one more request, see RetryAfter.
+func retryAfter(curr, prev, requestLimit int, currentWindow, now time.Time, windowLength time.Duration) time.Duration {
+	// The rate must drop to limit-1 to allow one more request.
+	target := float64(requestLimit - 1)
+	var at time.Time
+	if float64(curr) <= target {
+		// Within the current window: prev*(window-diff)/window + curr <= target.
+		if prev == 0 {
+			return 0
+		}
+		diff := float64(windowLength) * (1 - (target-float64(curr))/float64(prev))
+		at = currentWindow.Add(time.Duration(diff))
+	} else {
+		// Within the next window, where the current count gets weighted: curr*(window-diff)/window <= target.
+		diff := float64(windowLength) * (1 - target/float64(curr))
+		at = currentWindow.Add(windowLength + time.Duration(diff))
+	}
+	return max(0, at.Sub(now))
+}
+
+// rate returns the sliding window rate of the given rate-limit key:
+// the previous window count weighted by the remaining part of the
+// current window, plus the current window count.
+func (c *redisCounter) rate(ctx context.Context, key string, windowLength time.Duration) (int, error) {
+	now := c.now().UTC()
+	currentWindow, previousWindow, err := c.windows(now, windowLength)
+	if err != nil {
+		return 0, err
+	}
+
+	curr, prev, err := c.GetCtx(ctx, key, currentWindow, previousWindow)
+	if err != nil {
+		return 0, err
+	}
+
+	return RateInt(prev, curr, currentWindow, now, windowLength), nil
+}
@@ -0,0 +1,594 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestRemaining(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	if _, err := limitCounter.Remaining(ctx, "key:remaining"); err == nil {
+		t.Error("expected error when the limit is not configured")
+	}
+
+	const limit = 100
+	windowLength := time.Second
+	limitCounter.Config(limit, windowLength)
+
+	// Start right after a window boundary, so the test doesn't cross the next one.
+	time.Sleep(time.Until(time.Now().Truncate(windowLength).Add(windowLength + 50*time.Millisecond)))
+
+	currentWindow := time.Now().UTC().Truncate(windowLength)
+	previousWindow := currentWindow.Add(-windowLength)
+
+	if err := limitCounter.IncrementBy("key:remaining", previousWindow, 80); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:remaining", currentWindow, 10); err != nil {
+		t.Fatal(err)
+	}
+	assertRemaining(t, limitCounter, "key:remaining", limit, 10, 80, currentWindow, windowLength)
+
+	// Cross the window boundary, the current window count becomes the weighted previous one.
+	time.Sleep(time.Until(currentWindow.Add(windowLength + 200*time.Millisecond)))
+	assertRemaining(t, limitCounter, "key:remaining", limit, 0, 10, currentWindow.Add(windowLength), windowLength)
+
+	// Remaining never goes below 0.
+	if err := limitCounter.IncrementBy("key:remaining", currentWindow.Add(windowLength), 500); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := limitCounter.Remaining(ctx, "key:remaining")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("unexpected remaining = %v, expected 0", remaining)
+	}
+}
+
+// assertRemaining checks Remaining() against the weighted sliding window rate
+// calculated before and after the call.
+func assertRemaining(t *testing.T, limitCounter interface {
+	Remaining(ctx context.Context, key string) (int, error)
+}, key string, limit, curr, prev int, currentWindow time.Time, windowLength time.Duration) {
+	t.Helper()
+
+	remainingAt := func(now time.Time) int {
+		weight := float64(windowLength-now.Sub(currentWindow)) / float64(windowLength)
+		return max(0, limit-int(math.Round(float64(prev)*weight+float64(curr))))
+	}
+
+	before := remainingAt(time.Now())
+	remaining, err := limitCounter.Remaining(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := remainingAt(time.Now())
+
+	// The previous window weight only decreases over time.
+	if remaining < before || remaining > after {
+		t.Errorf("unexpected remaining = %v, expected between %v and %v", remaining, before, after)
+	}
+	if after == limit-curr-prev || before == limit-curr {
+		t.Errorf("expected the previous window count to be weighted, got remaining between %v and %v", before, after)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	if _, err := limitCounter.Peek(ctx, "key:peek"); err == nil {
+		t.Error("expected error when the window is not configured")
+	}
+
+	limitCounter.Config(100, time.Hour)
+
+	currentWindow := time.Now().UTC().Truncate(time.Hour)
+	previousWindow := currentWindow.Add(-time.Hour)
+
+	if err := limitCounter.IncrementBy("key:peek", currentWindow, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		used, err := limitCounter.Peek(ctx, "key:peek")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != 7 {
+			t.Errorf("unexpected used = %v, expected 7", used)
+		}
+	}
+
+	curr, prev, err := limitCounter.Get("key:peek", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 7 || prev != 0 {
+		t.Errorf("unexpected counts curr = %v, prev = %v, expected Peek() to leave them unchanged", curr, prev)
+	}
+
+	// Peek must not create the counters of unknown keys.
+	keys := len(redis.Keys())
+	if used, err := limitCounter.Peek(ctx, "key:unknown"); err != nil || used != 0 {
+		t.Errorf("unexpected Peek() = %v, %v, expected 0", used, err)
+	}
+	if len(redis.Keys()) != keys {
+		t.Errorf("unexpected keys %v, expected Peek() not to create any", redis.Keys())
+	}
+}
+
+func TestPeekWithClock(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	limitCounter.Config(100, time.Minute)
+
+	currentWindow := now.Truncate(time.Minute)
+	if err := limitCounter.IncrementBy("key:clock", currentWindow, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		now       time.Time
+		used      int
+		remaining int
+	}{
+		{now: now, used: 60, remaining: 40},
+		{now: currentWindow.Add(time.Minute), used: 60, remaining: 40},                  // The previous window is fully weighted at the boundary.
+		{now: currentWindow.Add(time.Minute + 15*time.Second), used: 45, remaining: 55}, // 60 * 3/4
+		{now: currentWindow.Add(2*time.Minute - time.Second), used: 1, remaining: 99},   // 60 * 1/60
+		{now: currentWindow.Add(2 * time.Minute), used: 0, remaining: 100},              // Out of the sliding window.
+	}
+	for _, tt := range tests {
+		now = tt.now
+
+		used, err := limitCounter.Peek(ctx, "key:clock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tt.used {
+			t.Errorf("%v: unexpected used = %v, expected %v", tt.now, used, tt.used)
+		}
+		remaining, err := limitCounter.Remaining(ctx, "key:clock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining != tt.remaining {
+			t.Errorf("%v: unexpected remaining = %v, expected %v", tt.now, remaining, tt.remaining)
+		}
+	}
+}
+
+func TestSubSecondWindow(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	windowLength := 200 * time.Millisecond
+	limitCounter.Config(100, windowLength)
+
+	// Five windows within the same second must not share counters.
+	for i := 0; i < 5; i++ {
+		window := now.Add(time.Duration(i) * windowLength)
+		if err := limitCounter.IncrementBy("key:subsecond", window, 10*(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := redis.Keys()
+	if len(keys) != 5 {
+		t.Fatalf("unexpected keys %v, expected 5", keys)
+	}
+	for _, key := range keys {
+		if ttl := redis.TTL(key); ttl != 3*windowLength {
+			t.Errorf("key %q: unexpected TTL %v, expected %v", key, ttl, 3*windowLength)
+		}
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		now  time.Time
+		used int
+	}{
+		{now: now.Add(50 * time.Millisecond), used: 10},              // First window, no previous one.
+		{now: now.Add(250 * time.Millisecond), used: 28},             // round(10 * 150/200) + 20
+		{now: now.Add(900 * time.Millisecond), used: 70},             // 40 * 100/200 + 50
+		{now: now.Add(time.Second + 100*time.Millisecond), used: 25}, // Next second, 50 * 100/200
+		{now: now.Add(time.Second + 200*time.Millisecond), used: 0},
+	}
+	for _, tt := range tests {
+		now = tt.now
+
+		used, err := limitCounter.Peek(ctx, "key:subsecond")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tt.used {
+			t.Errorf("%v: unexpected used = %v, expected %v", tt.now.Format(time.StampMilli), used, tt.used)
+		}
+	}
+}
+
+func TestLimitFunc(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	now := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+		httprateredis.WithLimitFunc(func(key string) (int, time.Duration) {
+			switch key {
+			case "tier:free":
+				return 10, 0 // Global window.
+			case "tier:pro":
+				return 1000, time.Hour
+			}
+			return 0, 0
+		}),
+	)
+	defer limitCounter.Close()
+
+	limitCounter.Config(100, time.Minute)
+
+	tests := []struct {
+		key          string
+		windowLength time.Duration
+		remaining    int
+	}{
+		{key: "tier:free", windowLength: time.Minute, remaining: 5},
+		{key: "tier:pro", windowLength: time.Hour, remaining: 995},
+		{key: "tier:unknown", windowLength: time.Minute, remaining: 95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if err := limitCounter.IncrementBy(tt.key, now.Truncate(tt.windowLength), 5); err != nil {
+				t.Fatal(err)
+			}
+			remaining, err := limitCounter.Remaining(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remaining != tt.remaining {
+				t.Errorf("unexpected remaining = %v, expected %v", remaining, tt.remaining)
+			}
+		})
+	}
+
+	// The hourly window counter must survive until the end of the next hour.
+	var hourly int
+	for _, key := range redis.Keys() {
+		if redis.TTL(key) == 3*time.Hour {
+			hourly++
+		}
+	}
+	if hourly != 1 {
+		t.Errorf("unexpected number of keys with 3h TTL %v, expected 1", hourly)
+	}
+}
+
+func TestResetAt(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	now := time.Date(2024, 1, 1, 12, 0, 15, 0, time.UTC)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	if resetAt := limitCounter.ResetAt("key:reset"); !resetAt.IsZero() {
+		t.Errorf("unexpected ResetAt() = %v, expected zero time when not configured", resetAt)
+	}
+
+	limitCounter.Config(10, time.Minute)
+
+	currentWindow := now.Truncate(time.Minute)
+	nextWindow := currentWindow.Add(time.Minute)
+	for _, at := range []time.Time{now, currentWindow, nextWindow.Add(-time.Nanosecond)} {
+		now = at
+		if resetAt := limitCounter.ResetAt("key:reset"); !resetAt.Equal(nextWindow) {
+			t.Errorf("%v: unexpected ResetAt() = %v, expected %v", at, resetAt, nextWindow)
+		}
+	}
+	now = nextWindow
+	if resetAt := limitCounter.ResetAt("key:reset"); !resetAt.Equal(nextWindow.Add(time.Minute)) {
+		t.Errorf("unexpected ResetAt() = %v at the window boundary, expected %v", resetAt, nextWindow.Add(time.Minute))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var now time.Time
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	limitCounter.Config(11, time.Minute)
+
+	tests := []struct {
+		name       string
+		key        string
+		prev, curr int
+		at         time.Duration
+		retryAfter time.Duration
+	}{
+		{name: "under the limit", key: "key:under", prev: 0, curr: 5, at: 30 * time.Second, retryAfter: 0},
+		{name: "previous window decays", key: "key:prev", prev: 20, curr: 0, at: 15 * time.Second, retryAfter: 15 * time.Second}, // 20 * 30/60 = 10
+		{name: "previous window decayed", key: "key:prev", prev: 20, curr: 0, at: 45 * time.Second, retryAfter: 0},
+		{name: "both windows", key: "key:both", prev: 15, curr: 5, at: 0, retryAfter: 40 * time.Second},                  // 15 * 20/60 + 5 = 10
+		{name: "current window", key: "key:curr", prev: 0, curr: 20, at: 30 * time.Second, retryAfter: 60 * time.Second}, // 20 * 30/60 = 10 in the next window
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentWindow := start.Add(time.Minute)
+			now = currentWindow.Add(tt.at)
+
+			if err := limitCounter.Reset(context.Background(), tt.key); err != nil {
+				t.Fatal(err)
+			}
+			if err := limitCounter.IncrementBy(tt.key, currentWindow.Add(-time.Minute), tt.prev); err != nil {
+				t.Fatal(err)
+			}
+			if err := limitCounter.IncrementBy(tt.key, currentWindow, tt.curr); err != nil {
+				t.Fatal(err)
+			}
+
+			retryAfter, err := limitCounter.RetryAfter(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if retryAfter != tt.retryAfter {
+				t.Errorf("unexpected RetryAfter() = %v, expected %v", retryAfter, tt.retryAfter)
+			}
+
+			// The rate is under the limit by then.
+			now = now.Add(retryAfter)
+			remaining, err := limitCounter.Remaining(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remaining < 1 {
+				t.Errorf("unexpected remaining = %v after RetryAfter(), expected at least 1", remaining)
+			}
+		})
+	}
+}
+
+func TestWindowBoundary(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(59*time.Second + 999*time.Millisecond)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	limitCounter.Config(100, time.Minute)
+
+	// Increment at t=59.999s the way httprate does, in a non-UTC location.
+	// Truncation is absolute, so the location doesn't change the window.
+	local := now.In(time.FixedZone("UTC+05:30", 5*60*60+30*60))
+	if err := limitCounter.IncrementBy("key:boundary", local.Truncate(time.Minute), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read at t=60.001s: the just-ended window is the previous window now.
+	now = start.Add(time.Minute + time.Millisecond)
+	currentWindow := now.UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+	curr, prev, err := limitCounter.Get("key:boundary", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 0 || prev != 7 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 0, 7", curr, prev)
+	}
+
+	// Peek computes the windows from the clock the same way.
+	used, err := limitCounter.Peek(context.Background(), "key:boundary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 7 {
+		t.Errorf("unexpected used = %v, expected 7", used)
+	}
+}
+
+func TestKeyTTLOfCurrentWindow(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	windowLength := time.Minute
+	limitCounter.Config(100, windowLength)
+
+	ctx := context.Background()
+	if _, err := limitCounter.KeyTTL(ctx, "key:ttl"); !errors.Is(err, httprateredis.ErrKeyNotFound) {
+		t.Errorf("unexpected error %v, expected ErrKeyNotFound", err)
+	}
+
+	currentWindow := time.Now().UTC().Truncate(windowLength)
+	if err := limitCounter.IncrementBy("key:ttl", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The counter outlives its window, it's read as the previous window next.
+	ttl, err := limitCounter.KeyTTL(ctx, "key:ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 3 * windowLength; ttl <= expected-time.Second || ttl > expected {
+		t.Errorf("unexpected ttl = %v, expected close to %v", ttl, expected)
+	}
+
+	// A key left without a TTL, e.g. by a non-atomic INCR of another client.
+	for _, key := range redis.Keys() {
+		value, _ := redis.Get(key)
+		redis.Set(key, value)
+	}
+	if _, err := limitCounter.KeyTTL(ctx, "key:ttl"); !errors.Is(err, httprateredis.ErrNoExpiry) {
+		t.Errorf("unexpected error %v, expected ErrNoExpiry", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	// Half-way through the window, the previous window count weighs 0.5.
+	currentWindow := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	previousWindow := currentWindow.Add(-time.Minute)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithWarnThreshold(0.8),
+		httprateredis.WithClock(func() time.Time { return currentWindow.Add(30 * time.Second) }),
+	)
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	if _, _, _, err := limitCounter.Status(ctx, "key:status"); err == nil {
+		t.Error("expected error when the limit is not configured")
+	}
+	limitCounter.Config(10, time.Minute)
+
+	if err := limitCounter.IncrementBy("key:status", previousWindow, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		incrBy int
+		used   int
+		state  httprateredis.State
+	}{
+		{incrBy: 0, used: 2, state: httprateredis.StateOK},
+		{incrBy: 5, used: 7, state: httprateredis.StateOK},
+		{incrBy: 1, used: 8, state: httprateredis.StateWarn},
+		{incrBy: 1, used: 9, state: httprateredis.StateWarn},
+		{incrBy: 1, used: 10, state: httprateredis.StateBlocked},
+		{incrBy: 5, used: 15, state: httprateredis.StateBlocked},
+	}
+	for _, tt := range tests {
+		if tt.incrBy > 0 {
+			if err := limitCounter.IncrementBy("key:status", currentWindow, tt.incrBy); err != nil {
+				t.Fatal(err)
+			}
+		}
+		used, limit, state, err := limitCounter.Status(ctx, "key:status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tt.used || limit != 10 || state != tt.state {
+			t.Errorf("unexpected Status() = %v, %v, %v, expected %v, 10, %v", used, limit, state, tt.used, tt.state)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package httprateredis
+
+import (
+	"math"
+	"time"
+)
+
+// Rate returns the sliding window rate httprate compares with the request
+// limit: the previous window count prev weighted by the part of the current
+// window, starting at windowStart, which is yet to elapse at now, plus the
+// current window count curr, i.e.
+//
+//	prev*(windowLength-now.Sub(windowStart))/windowLength + curr
+//
+// The weight is 1 at windowStart and decays linearly to 0 at the end of the
+// window. It's clamped to [0, 1], so a now before windowStart counts prev in
+// full and a now past the window counts curr only. The rate is not rounded,
+// e.g. for displaying the usage, see RateInt for the rate httprate limits by.
+// It doesn't talk to Redis, the counts are e.g. those returned by Get.
+func Rate(prev, curr int, windowStart time.Time, now time.Time, windowLength time.Duration) float64 {
+	if windowLength <= 0 {
+		return float64(curr)
+	}
+	weight := float64(windowLength-now.Sub(windowStart)) / float64(windowLength)
+	weight = min(max(weight, 0), 1)
+	return float64(prev)*weight + float64(curr)
+}
+
+// RateInt returns Rate rounded to the nearest integer, halves away from zero,
+// the same way as httprate before comparing it with the request limit. E.g.
+// a previous window count of 3 weighted by 0.5 plus a current count of 2 is
+// 3.5, rounded to 4. Rates beyond math.MaxInt saturate at math.MaxInt.
+func RateInt(prev, curr int, windowStart time.Time, now time.Time, windowLength time.Duration) int {
+	rate := Rate(prev, curr, windowStart, now, windowLength)
+	if rate >= math.MaxInt {
+		return math.MaxInt
+	}
+	return int(math.Round(rate))
+}
@@ -0,0 +1,56 @@
+package httprateredis_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestRate(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	windowLength := time.Minute
+
+	tests := []struct {
+		name       string
+		prev, curr int
+		elapsed    time.Duration
+		rate       float64
+		rateInt    int
+	}{
+		{name: "window start", prev: 10, curr: 0, elapsed: 0, rate: 10, rateInt: 10},
+		{name: "quarter", prev: 10, curr: 2, elapsed: 15 * time.Second, rate: 9.5, rateInt: 10},
+		{name: "half", prev: 10, curr: 2, elapsed: 30 * time.Second, rate: 7, rateInt: 7},
+		{name: "half rounded up", prev: 3, curr: 2, elapsed: 30 * time.Second, rate: 3.5, rateInt: 4},
+		{name: "three quarters", prev: 10, curr: 2, elapsed: 45 * time.Second, rate: 4.5, rateInt: 5},
+		{name: "rounded down", prev: 10, curr: 0, elapsed: 40 * time.Second, rate: 10.0 / 3, rateInt: 3},
+		{name: "window end", prev: 10, curr: 2, elapsed: time.Minute, rate: 2, rateInt: 2},
+		{name: "no previous", prev: 0, curr: 7, elapsed: 20 * time.Second, rate: 7, rateInt: 7},
+		{name: "before the window", prev: 10, curr: 2, elapsed: -time.Second, rate: 12, rateInt: 12},
+		{name: "past the window", prev: 10, curr: 2, elapsed: 2 * time.Minute, rate: 2, rateInt: 2},
+		{name: "saturated", prev: 0, curr: math.MaxInt, elapsed: 0, rate: math.MaxInt, rateInt: math.MaxInt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := windowStart.Add(tt.elapsed)
+			if rate := httprateredis.Rate(tt.prev, tt.curr, windowStart, now, windowLength); math.Abs(rate-tt.rate) > 1e-9 {
+				t.Errorf("unexpected Rate() = %v, expected %v", rate, tt.rate)
+			}
+			if rate := httprateredis.RateInt(tt.prev, tt.curr, windowStart, now, windowLength); rate != tt.rateInt {
+				t.Errorf("unexpected RateInt() = %v, expected %v", rate, tt.rateInt)
+			}
+		})
+	}
+
+	// The rate decays monotonically across the window, from prev+curr to curr.
+	last := math.Inf(1)
+	for elapsed := time.Duration(0); elapsed <= windowLength; elapsed += time.Second {
+		rate := httprateredis.Rate(100, 5, windowStart, windowStart.Add(elapsed), windowLength)
+		if rate > last || rate < 5 || rate > 105 {
+			t.Fatalf("%v into the window: unexpected Rate() = %v after %v", elapsed, rate, last)
+		}
+		last = rate
+	}
+}
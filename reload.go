@@ -0,0 +1,230 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Store = (*Reloadable)(nil)
+
+// Reloadable is a counter whose Config can be replaced at runtime, e.g. on
+// SIGHUP, see Reload and Watch. It's used like the counter returned by
+// NewCounter, e.g. with httprate.WithLimitCounter.
+type Reloadable struct {
+	counter atomic.Pointer[redisCounter]
+
+	mu     sync.Mutex // serializes Reload, Config and Close
+	cfg    Config     // as given, before the defaults
+	limits *limitConfig
+	closed bool
+}
+
+// NewReloadable returns a Reloadable counter configured by cfg, like
+// NewCounterWithError, limited to RequestLimit per WindowLength if set.
+func NewReloadable(cfg *Config) (*Reloadable, error) {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	counter, err := NewCounterWithError(cloneConfig(&c))
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloadable{cfg: c}
+	if c.RequestLimit > 0 {
+		counter.Config(c.RequestLimit, windowLengthOf(&c))
+		r.limits = counter.limitConfig.Load()
+	}
+	r.counter.Store(counter)
+	return r, nil
+}
+
+// Counter returns the current counter, e.g. to call the methods Reloadable
+// doesn't forward. It may be replaced, and then closed, by the next Reload.
+func (r *Reloadable) Counter() *redisCounter {
+	return r.counter.Load()
+}
+
+// Reload applies cfg to the counter. If cfg differs from the current Config in
+// WindowLength, RequestLimit and Disabled only, the counter is kept and
+// reconfigured by Config and SetEnabled. Otherwise, e.g. if the address, the
+// credentials, the TLS, pool or timeout settings or PrefixKey changed, a new
+// counter is created and configured with the same limits, replaces the current
+// one, which is then closed by CloseContext with ctx once its in-flight
+// operations finish.
+//
+// The request limit is RequestLimit if set, otherwise the limit of the last
+// Config call, e.g. by httprate, which applies to the counters created by the
+// following reloads too. The function fields (e.g. LimitFunc, OnError and the
+// other hooks), Logger and Tracer are not compared, as functions can't be, so
+// the counter is kept when only they differ, with its own.
+//
+// Each operation uses either the previous or the new counter, never a half
+// applied config. The error of closing the previous counter, e.g. if ctx is
+// done first, is returned after the new counter is in place. An invalid cfg
+// returns an error wrapping ErrInvalidConfig and the counter is left unchanged.
+func (r *Reloadable) Reload(ctx context.Context, cfg *Config) error {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	current := r.counter.Load()
+
+	limits := r.limits
+	if c.RequestLimit > 0 {
+		limits = &limitConfig{requestLimit: c.RequestLimit, windowLength: windowLengthOf(&c)}
+	} else if limits != nil && c.WindowLength != r.cfg.WindowLength {
+		limits = &limitConfig{requestLimit: limits.requestLimit, windowLength: windowLengthOf(&c)}
+	}
+
+	if inPlace(&r.cfg, &c) {
+		if limits != r.limits {
+			current.Config(limits.requestLimit, limits.windowLength)
+			r.limits = current.limitConfig.Load()
+		}
+		current.SetEnabled(!c.Disabled)
+		r.cfg = c
+		return nil
+	}
+
+	counter, err := NewCounterWithError(cloneConfig(&c))
+	if err != nil {
+		return err
+	}
+	if limits != nil {
+		counter.Config(limits.requestLimit, limits.windowLength)
+		r.limits = counter.limitConfig.Load()
+	}
+	r.cfg = c
+	r.counter.Store(counter)
+	return current.CloseContext(ctx)
+}
+
+// Watch reloads the counter with each Config received on ch until ch is
+// closed, e.g. from a SIGHUP handler re-reading the config file. The reload
+// errors are logged by the Logger of the counter, which is kept on error. The
+// previous counters are given up to a minute to finish their operations.
+func (r *Reloadable) Watch(ch <-chan *Config) {
+	for cfg := range ch {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := r.Reload(ctx, cfg)
+		cancel()
+		if err != nil {
+			r.counter.Load().logger.Errorf("httprateredis: reload: %v", err)
+		}
+	}
+}
+
+func (r *Reloadable) Config(requestLimit int, windowLength time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counter := r.counter.Load()
+	counter.Config(requestLimit, windowLength)
+	r.limits = counter.limitConfig.Load()
+}
+
+func (r *Reloadable) Increment(key string, currentWindow time.Time) error {
+	return r.IncrementBy(key, currentWindow, 1)
+}
+
+func (r *Reloadable) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	return r.IncrementByCtx(context.Background(), key, currentWindow, amount)
+}
+
+// IncrementByCtx is IncrementByCtx of the current counter.
+func (r *Reloadable) IncrementByCtx(ctx context.Context, key string, currentWindow time.Time, amount int) error {
+	for {
+		counter := r.counter.Load()
+		err := counter.IncrementByCtx(ctx, key, currentWindow, amount)
+		if !r.replaced(counter, err) {
+			return err
+		}
+	}
+}
+
+func (r *Reloadable) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return r.GetCtx(context.Background(), key, currentWindow, previousWindow)
+}
+
+// GetCtx is GetCtx of the current counter.
+func (r *Reloadable) GetCtx(ctx context.Context, key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	for {
+		counter := r.counter.Load()
+		curr, prev, err := counter.GetCtx(ctx, key, currentWindow, previousWindow)
+		if !r.replaced(counter, err) {
+			return curr, prev, err
+		}
+	}
+}
+
+// Reset is Reset of the current counter.
+func (r *Reloadable) Reset(ctx context.Context, key string) error {
+	for {
+		counter := r.counter.Load()
+		err := counter.Reset(ctx, key)
+		if !r.replaced(counter, err) {
+			return err
+		}
+	}
+}
+
+// Close closes the current counter, see redisCounter.Close. Reload returns
+// ErrClosed afterwards.
+func (r *Reloadable) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return r.counter.Load().Close()
+}
+
+// replaced reports whether the operation on counter was refused as it was
+// closed by Reload after being replaced, so it should be retried on the new
+// counter. Only errRefused is retried, returned before any round-trip, so the
+// retried increments are not counted twice. The operations interrupted by
+// Close return their ErrClosed as is.
+func (r *Reloadable) replaced(counter *redisCounter, err error) bool {
+	return errors.Is(err, errRefused) && r.counter.Load() != counter
+}
+
+// inPlace reports whether the configs differ in WindowLength, RequestLimit
+// and Disabled only, which are applied to a running counter without a new
+// client, ignoring the fields which can't be compared, see Reload.
+func inPlace(prev, next *Config) bool {
+	a, b := *prev, *next
+	for _, c := range []*Config{&a, &b} {
+		c.WindowLength, c.RequestLimit, c.Disabled = 0, 0, false
+		c.LimitFunc, c.KeyFunc, c.DBForKey, c.PasswordFunc = nil, nil, nil, nil
+		c.OnError, c.OnFallback, c.OnFallbackChange = nil, nil, nil
+		c.OnDecision, c.OnPoolWait = nil, nil
+		c.Logger, c.Tracer, c.now = nil, nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// windowLengthOf returns the WindowLength of cfg, or its default.
+func windowLengthOf(cfg *Config) time.Duration {
+	if cfg.WindowLength <= 0 {
+		return time.Minute
+	}
+	return cfg.WindowLength
+}
+
+// cloneConfig returns a copy of cfg for NewCounter, which sets the defaults
+// on the Config it's given.
+func cloneConfig(cfg *Config) *Config {
+	c := *cfg
+	return &c
+}
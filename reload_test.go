@@ -0,0 +1,214 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestReloadable(t *testing.T) {
+	redis1, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis1.Close()
+	redis2, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis2.Close()
+
+	configFor := func(redis *miniredis.Miniredis) *httprateredis.Config {
+		port, _ := strconv.Atoi(redis.Port())
+		return &httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(port),
+			FallbackDisabled: true,
+		}
+	}
+
+	limitCounter, err := httprateredis.NewReloadable(configFor(redis1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+	if err := limitCounter.IncrementBy("key:reload", currentWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the limits are applied to the running counter.
+	counter := limitCounter.Counter()
+	cfg := configFor(redis1)
+	cfg.WindowLength = time.Hour
+	if err := limitCounter.Reload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if limitCounter.Counter() != counter {
+		t.Error("the counter should be kept when only the limits change")
+	}
+	if curr, _, err := limitCounter.Get("key:reload", currentWindow, previousWindow); err != nil || curr != 5 {
+		t.Errorf("unexpected count %v, err %v, expected 5", curr, err)
+	}
+
+	// Invalid configs are rejected, keeping the counter.
+	cfg = configFor(redis2)
+	cfg.FallbackMaxKeys = -1
+	if err := limitCounter.Reload(context.Background(), cfg); !errors.Is(err, httprateredis.ErrInvalidConfig) {
+		t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrInvalidConfig)
+	}
+	if limitCounter.Counter() != counter {
+		t.Error("the counter should be kept on an invalid config")
+	}
+
+	// The configs pushed through the channel switch Redis under live traffic.
+	ch := make(chan *httprateredis.Config)
+	watched := make(chan struct{})
+	go func() {
+		limitCounter.Watch(ch)
+		close(watched)
+	}()
+
+	var (
+		wg         sync.WaitGroup
+		stop       = make(chan struct{})
+		increments atomic.Int64
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := limitCounter.Increment("key:live", currentWindow); err != nil {
+					t.Errorf("Increment() during reload: %v", err)
+					return
+				}
+				increments.Add(1)
+				if _, _, err := limitCounter.Get("key:live", currentWindow, previousWindow); err != nil {
+					t.Errorf("Get() during reload: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if i%2 == 0 {
+			ch <- configFor(redis2)
+		} else {
+			ch <- configFor(redis1)
+		}
+	}
+	ch <- configFor(redis2)
+	close(ch)
+	<-watched
+	close(stop)
+	wg.Wait()
+
+	if limitCounter.Counter() == counter {
+		t.Error("the counter should be replaced when the address changes")
+	}
+	if _, _, err := counter.Get("key:reload", currentWindow, previousWindow); !errors.Is(err, httprateredis.ErrClosed) {
+		t.Errorf("unexpected error %v on the replaced counter, expected %v", err, httprateredis.ErrClosed)
+	}
+
+	// Each increment went to either Redis, once.
+	var total int64
+	for _, redis := range []*miniredis.Miniredis{redis1, redis2} {
+		for _, key := range redis.Keys() {
+			if n, err := redis.Get(key); err == nil {
+				count, _ := strconv.Atoi(n)
+				total += int64(count)
+			}
+		}
+	}
+	if expected := increments.Load() + 5; total != expected {
+		t.Errorf("unexpected %v increments in Redis, expected %v", total, expected)
+	}
+
+	// The new counter serves the keys of the new Redis.
+	if err := limitCounter.IncrementBy("key:reload", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	if curr, _, err := limitCounter.Get("key:reload", currentWindow, previousWindow); err != nil || curr != 2 {
+		t.Errorf("unexpected count %v, err %v, expected 2 in the new Redis", curr, err)
+	}
+
+	limitCounter.Close()
+	if err := limitCounter.Reload(context.Background(), configFor(redis1)); !errors.Is(err, httprateredis.ErrClosed) {
+		t.Errorf("unexpected error %v after Close, expected %v", err, httprateredis.ErrClosed)
+	}
+}
+
+func TestReloadableInPlace(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	port, _ := strconv.Atoi(redis.Port())
+
+	configFor := func(requestLimit int, windowLength time.Duration) *httprateredis.Config {
+		return &httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(port),
+			FallbackDisabled: true,
+			RequestLimit:     requestLimit,
+			WindowLength:     windowLength,
+			// The hooks can't be compared, they don't replace the counter.
+			OnError:   func(err error) {},
+			LimitFunc: func(key string) (int, time.Duration) { return 0, 0 },
+		}
+	}
+
+	limitCounter, err := httprateredis.NewReloadable(configFor(10, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+	counter := limitCounter.Counter()
+
+	ctx := context.Background()
+	if _, limit, _, err := counter.Status(ctx, "key"); err != nil || limit != 10 {
+		t.Errorf("unexpected limit %v, err %v, expected 10 of RequestLimit", limit, err)
+	}
+
+	// The limit and the window change in place.
+	if err := limitCounter.Reload(ctx, configFor(20, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if limitCounter.Counter() != counter {
+		t.Error("the counter should be kept when only the limits change")
+	}
+	if _, limit, _, err := counter.Status(ctx, "key"); err != nil || limit != 20 {
+		t.Errorf("unexpected limit %v, err %v, expected 20 after the reload", limit, err)
+	}
+
+	// A new counter keeps the reloaded limit.
+	cfg := configFor(0, time.Hour)
+	cfg.PrefixKey = "other"
+	if err := limitCounter.Reload(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if limitCounter.Counter() == counter {
+		t.Error("the counter should be replaced when PrefixKey changes")
+	}
+	if _, limit, _, err := limitCounter.Counter().Status(ctx, "key"); err != nil || limit != 20 {
+		t.Errorf("unexpected limit %v, err %v, expected 20 carried to the new counter", limit, err)
+	}
+}
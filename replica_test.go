@@ -0,0 +1,105 @@
+package httprateredis_test
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestReplicaAddrs(t *testing.T) {
+	primary, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+	replica, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	primaryCmds, replicaCmds := countCommands(primary), countCommands(replica)
+
+	redisPort, _ := strconv.Atoi(primary.Port())
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             primary.Host(),
+		Port:             uint16(redisPort),
+		ReplicaAddrs:     []string{replica.Addr()},
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:replica", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := primaryCmds.get("EVALSHA") + primaryCmds.get("EVAL"); n == 0 {
+		t.Error("expected the increment on the primary")
+	}
+	if n := replicaCmds.get("EVALSHA") + replicaCmds.get("EVAL"); n != 0 {
+		t.Errorf("unexpected %v increments on the replica", n)
+	}
+
+	// Simulate the replication.
+	for _, key := range primary.Keys() {
+		value, _ := primary.Get(key)
+		replica.Set(key, value)
+	}
+	curr, _, err := limitCounter.Get("key:replica", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 {
+		t.Errorf("unexpected curr = %v, expected 3", curr)
+	}
+	if n := replicaCmds.get("MGET"); n != 1 {
+		t.Errorf("unexpected %v MGET on the replica, expected 1", n)
+	}
+	if n := primaryCmds.get("MGET"); n != 0 {
+		t.Errorf("unexpected %v MGET on the primary, expected 0", n)
+	}
+
+	// Reads fall back to the primary while the replica is down.
+	replica.Close()
+	curr, _, err = limitCounter.Get("key:replica", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 {
+		t.Errorf("unexpected curr = %v, expected 3", curr)
+	}
+	if n := primaryCmds.get("MGET"); n != 1 {
+		t.Errorf("unexpected %v MGET on the primary, expected 1", n)
+	}
+}
+
+type commandCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func countCommands(mr *miniredis.Miniredis) *commandCounts {
+	c := &commandCounts{counts: map[string]int{}}
+	mr.Server().SetPreHook(func(peer *server.Peer, cmd string, args ...string) bool {
+		c.mu.Lock()
+		c.counts[strings.ToUpper(cmd)]++
+		c.mu.Unlock()
+		return false
+	})
+	return c
+}
+
+func (c *commandCounts) get(cmd string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[cmd]
+}
@@ -0,0 +1,236 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestReset(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	if err := limitCounter.Reset(ctx, "key:reset"); err == nil {
+		t.Error("expected error when the counter is not configured")
+	}
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// Missing keys are not an error.
+	if err := limitCounter.Reset(ctx, "key:reset"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := limitCounter.IncrementBy("key:reset", currentWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:reset", previousWindow, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:other", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := limitCounter.Reset(ctx, "key:reset"); err != nil {
+		t.Fatal(err)
+	}
+
+	curr, prev, err := limitCounter.Get("key:reset", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 0 || prev != 0 {
+		t.Errorf("unexpected counts curr = %v, prev = %v, expected 0 after reset", curr, prev)
+	}
+
+	// Other rate-limit keys are not affected.
+	curr, _, err = limitCounter.Get("key:other", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 {
+		t.Errorf("unexpected curr = %v, expected 3", curr)
+	}
+}
+
+func TestResetAll(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	configs := map[string]*httprateredis.Config{
+		"single": {
+			Host: redis.Host(),
+			Port: uint16(redisPort),
+		},
+		"cluster": {
+			ClusterAddrs: []string{redis.Addr()},
+		},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			redis.FlushAll()
+
+			// Glob characters in the prefix are matched literally.
+			cfg.PrefixKey = "httprate[test]"
+			cfg.FallbackDisabled = true
+			limitCounter := httprateredis.NewCounter(cfg)
+			defer limitCounter.Close()
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			previousWindow := currentWindow.Add(-time.Minute)
+
+			// NOTE: Miniredis SCAN cursor is an offset into the matching keys, which
+			// skips keys deleted between batches, unlike Redis. So stay in one batch.
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key:%d", i)
+				if err := limitCounter.IncrementBy(key, currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := limitCounter.IncrementBy(key, previousWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			unrelated := []string{"httprate:other", "httpratet:other", "httprate[test]", "session:1"}
+			for _, key := range unrelated {
+				redis.Set(key, "1")
+			}
+
+			if err := limitCounter.ResetAll(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			keys := redis.Keys()
+			sort.Strings(unrelated)
+			if fmt.Sprint(keys) != fmt.Sprint(unrelated) {
+				t.Errorf("unexpected keys %v after ResetAll, expected %v", keys, unrelated)
+			}
+		})
+	}
+}
+
+func TestResetAllCanceled(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	if err := limitCounter.IncrementBy("key", time.Now().UTC().Truncate(time.Minute), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limitCounter.ResetAll(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v, expected %v", err, context.Canceled)
+	}
+	if keys := redis.Keys(); len(keys) != 1 {
+		t.Errorf("unexpected keys %v, expected the counter to survive", keys)
+	}
+}
+
+func TestResetUseUnlink(t *testing.T) {
+	tests := []struct {
+		name      string
+		useUnlink bool
+		noUnlink  bool // the server doesn't know UNLINK
+		unlinks   int
+		dels      int
+	}{
+		{name: "DEL by default", dels: 2},
+		{name: "UNLINK", useUnlink: true, unlinks: 2},
+		{name: "DEL before Redis 4", useUnlink: true, noUnlink: true, unlinks: 1, dels: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer redis.Close()
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			var mu sync.Mutex
+			counts := map[string]int{}
+			redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				counts[cmd]++
+				if cmd == "UNLINK" && tt.noUnlink {
+					c.WriteError("ERR unknown command 'UNLINK'")
+					return true
+				}
+				return false
+			})
+
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				UseUnlink:        tt.useUnlink,
+				FallbackDisabled: true,
+			})
+			defer limitCounter.Close()
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			ctx := context.Background()
+
+			// The fallback to DEL is remembered, UNLINK isn't tried twice.
+			for i := 0; i < 2; i++ {
+				if err := limitCounter.IncrementBy("key:unlink", currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := limitCounter.Reset(ctx, "key:unlink"); err != nil {
+					t.Fatal(err)
+				}
+				if keys := redis.Keys(); len(keys) != 0 {
+					t.Errorf("unexpected keys %v after reset", keys)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if counts["UNLINK"] != tt.unlinks || counts["DEL"] != tt.dels {
+				t.Errorf("unexpected %v UNLINK and %v DEL, expected %v and %v", counts["UNLINK"], counts["DEL"], tt.unlinks, tt.dels)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package httprateredis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// resyncMaxKeys bounds the memory of the buffered fallback increments.
+	resyncMaxKeys = 10000
+	// resyncTimeout bounds the flush, which runs in the background anyway.
+	resyncTimeout = 10 * time.Second
+)
+
+// resyncBuffer buffers the increments served by the local in-memory fallback,
+// so FallbackResync can flush them to Redis once it recovers.
+type resyncBuffer struct {
+	mu         sync.Mutex
+	increments map[resyncKey]int
+}
+
+type resyncKey struct {
+	key          string // the rate-limit key, for DBForKey
+	hkey         string
+	window       time.Time
+	windowLength time.Duration
+}
+
+// add buffers the increment of the window counter, unless the buffer is full.
+// The refunds of DecrementBy are negative amounts, netted against the buffered
+// increments of the same counter they refund.
+func (b *resyncBuffer) add(k resyncKey, amount int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.increments == nil {
+		b.increments = map[resyncKey]int{}
+	}
+	if _, ok := b.increments[k]; !ok && len(b.increments) >= resyncMaxKeys {
+		return
+	}
+	b.increments[k] += amount
+}
+
+// take returns the buffered increments and empties the buffer.
+func (b *resyncBuffer) take() map[resyncKey]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	increments := b.increments
+	b.increments = nil
+	return increments
+}
+
+// bufferResync buffers the fallback increment of the given rate-limit key.
+// Only the window counters of ModeSlidingWindow are buffered.
+func (c *redisCounter) bufferResync(key string, currentWindow time.Time, amount int) {
+	if c.mode != "" && c.mode != ModeSlidingWindow {
+		return
+	}
+	_, windowLength := c.limits(key)
+	hkey := c.incrementKey(key, currentWindow, windowLength)
+	c.resync.add(resyncKey{key: key, hkey: hkey, window: currentWindow, windowLength: windowLength}, amount)
+}
+
+// flushResync increments the window counters in Redis by the buffered fallback
+// increments, best-effort, by the increment script of IncrementBy. The
+// increments of the windows which are neither the current nor the previous one
+// anymore are dropped, as are those refunded in full by DecrementBy.
+func (c *redisCounter) flushResync() {
+	increments := c.resync.take()
+	if len(increments) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resyncTimeout)
+	defer cancel()
+
+	now := c.now()
+	var dropped, flushed int
+	for k, amount := range increments {
+		if amount <= 0 || now.Sub(k.window) >= 2*k.windowLength {
+			dropped++
+			continue
+		}
+		ttl := c.ttl(k.windowLength).Milliseconds()
+		if err := c.runScriptOn(ctx, c.clientFor(k.key), incrementScript, []string{k.hkey}, amount, ttl).Err(); err != nil {
+			c.logger.Errorf("httprateredis: fallback resync failed: %v", err)
+			return
+		}
+		flushed++
+	}
+	c.logger.Debugf("httprateredis: fallback resync flushed %d window counters, dropped %d", flushed, dropped)
+}
@@ -0,0 +1,186 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestFallbackResync(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	fallbackChanges := make(chan bool, 2)
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  100 * time.Millisecond,
+		CooldownPeriod:   20 * time.Millisecond,
+		FallbackResync:   true,
+		OnFallbackChange: func(activated bool) { fallbackChanges <- activated },
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+	expiredWindow := previousWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:resync", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	redis.Close()
+	if err := limitCounter.IncrementBy("key:resync", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	if activated := <-fallbackChanges; !activated {
+		t.Fatal("fallback should be activated after we simulate redis failure")
+	}
+	for _, window := range []time.Time{currentWindow, previousWindow, expiredWindow} {
+		if err := limitCounter.IncrementBy("key:resync", window, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := limitCounter.IncrementBy("key:other", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := redis.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case activated := <-fallbackChanges:
+		if activated {
+			t.Fatal("fallback should be deactivated once Redis recovers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fallback not deactivated")
+	}
+
+	// The flush runs in the background after the deactivation.
+	tests := []struct {
+		key        string
+		curr, prev int
+		window     time.Time
+	}{
+		{"key:resync", 2 + 3 + 4, 4, currentWindow},
+		{"key:other", 1, 0, currentWindow},
+		{"key:resync", 4, 0, previousWindow}, // The expired window counter is dropped.
+	}
+	deadline := time.Now().Add(time.Second)
+	for _, tt := range tests {
+		for {
+			curr, prev, err := limitCounter.Get(tt.key, tt.window, tt.window.Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if curr == tt.curr && prev == tt.prev {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%v: unexpected curr = %v, prev = %v, expected %v, %v", tt.key, curr, prev, tt.curr, tt.prev)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// TestFallbackResyncFunctions flushes the fallback increments, net of the
+// refunds, by the functions of UseFunctions, like IncrementBy.
+func TestFallbackResyncFunctions(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+	newFunctionsFixture(t, redis)
+
+	fallbackChanges := make(chan bool, 2)
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		CooldownPeriod:   200 * time.Millisecond,
+		FallbackResync:   true,
+		UseFunctions:     true,
+		OnFallbackChange: func(activated bool) { fallbackChanges <- activated },
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+	failures := limitCounter.InjectFailures()
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	failures.FailNext(1, errors.New("injected failure"))
+	if err := limitCounter.IncrementBy("key:refund", currentWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+	if activated := <-fallbackChanges; !activated {
+		t.Fatal("fallback should be activated by the injected failure")
+	}
+	ctx := context.Background()
+	if err := limitCounter.DecrementBy(ctx, "key:refund", currentWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:refunded", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.DecrementBy(ctx, "key:refunded", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fixture runs each FCALL of a loaded function by an EVAL of its body.
+	var fcalls, evals atomic.Int64
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		switch strings.ToUpper(cmd) {
+		case "FCALL":
+			fcalls.Add(1)
+		case "EVAL", "EVALSHA":
+			evals.Add(1)
+		}
+		return false
+	})
+	select {
+	case activated := <-fallbackChanges:
+		if activated {
+			t.Fatal("fallback should be deactivated once Redis recovers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fallback not deactivated")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		curr, _, err := limitCounter.Get("key:refund", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr == 5-2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected curr = %v, expected %v", curr, 5-2)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if key := limitCounter.LimitCounterKey("key:refunded", currentWindow); redis.Exists(key) {
+		t.Errorf("unexpected counter %v of the refunded increment", key)
+	}
+	if fcalls.Load() == 0 || evals.Load() != 1 {
+		t.Errorf("unexpected %v FCALL and %v EVAL calls, expected the resync to call the function once", fcalls.Load(), evals.Load())
+	}
+}
@@ -0,0 +1,70 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const maxRetryBackoff = 512 * time.Millisecond
+
+// withRetry calls fn and retries it up to c.maxRetries times on connection
+// errors. Commands that are not idempotent are only retried if the error
+// guarantees the command was never sent to Redis (e.g. dial errors), so that
+// a retried INCRBY can never be counted twice.
+func (c *redisCounter) withRetry(ctx context.Context, idempotent bool, fn func() error) error {
+	err := fn()
+	for attempt := 0; err != nil && attempt < c.maxRetries; attempt++ {
+		if !shouldRetry(err, idempotent) || contextError(ctx) != nil {
+			return err
+		}
+
+		timer := time.NewTimer(c.retryBackoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		err = fn()
+	}
+	return err
+}
+
+// retryBackoff returns exponential backoff capped at maxRetryBackoff with full
+// jitter, so that goroutines failing at the same time don't reconnect in lockstep.
+func (c *redisCounter) retryBackoff(attempt int) time.Duration {
+	backoff := c.minRetryBackoff << attempt
+	if backoff <= 0 || backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+func shouldRetry(err error, idempotent bool) bool {
+	// Error replies from Redis are not connection errors.
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		return false
+	}
+	if errors.Is(err, redis.ErrClosed) {
+		return false
+	}
+
+	// go-redis doesn't export its pool errors.
+	if strings.HasPrefix(err.Error(), "redis: connection pool") {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	return idempotent
+}
@@ -0,0 +1,138 @@
+package httprateredis_test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestRetryAfterRedisRestart(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+		MaxRetries:       10,
+		RetryBackoff:     20 * time.Millisecond,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:retry", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate Redis restart.
+	redis.Close()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		redis.Restart()
+	}()
+
+	if err := limitCounter.IncrementBy("key:retry", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, err := limitCounter.Get("key:retry", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 {
+		t.Errorf("unexpected curr = %v, expected 2", curr)
+	}
+}
+
+func TestNoRetryByDefault(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	redis.Close()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		redis.Restart()
+	}()
+
+	if err := limitCounter.IncrementBy("key:retry", time.Now().UTC().Truncate(time.Minute), 1); err == nil {
+		t.Error("expected error without retries")
+	}
+}
+
+func TestRetryForcedDialErrors(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+		MaxRetries:       2,
+		RetryBackoff:     time.Millisecond,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+	failures := limitCounter.InjectFailures()
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// The dial errors guarantee INCRBY was not sent, so it's retried.
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	failures.FailNext(2, dialErr)
+	if err := limitCounter.IncrementBy("key:retry", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	failures.FailNext(3, dialErr)
+	if err := limitCounter.IncrementBy("key:retry", currentWindow, 1); !errors.Is(err, dialErr) {
+		t.Errorf("unexpected error %v after the retries, expected %v", err, dialErr)
+	}
+
+	// The other connection errors may come after INCRBY was run.
+	failures.FailNext(1, errors.New("connection reset by peer"))
+	if err := limitCounter.IncrementBy("key:retry", currentWindow, 1); err == nil {
+		t.Error("expected error, INCRBY should not be retried")
+	}
+	if n := failures.Remaining(); n != 0 {
+		t.Errorf("%v forced failures left", n)
+	}
+
+	curr, _, err := limitCounter.Get("key:retry", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 1 {
+		t.Errorf("unexpected curr = %v, expected 1", curr)
+	}
+}
@@ -0,0 +1,290 @@
+package httprateredis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+var _ Store = (*rueidisCounter)(nil)
+
+// rueidisIncrementScript is incrementScript for rueidis, run via EVALSHA and
+// loaded by EVAL on NOSCRIPT.
+var rueidisIncrementScript = rueidis.NewLuaScript(scriptFunctions[incrementScript].src)
+
+// NewCounterWithRueidis returns a counter backed by the given rueidis client
+// (standalone, cluster or sentinel) shared with the rest of the application,
+// instead of a go-redis connection pool. Close doesn't close the client.
+//
+// The counters are the same sliding window keys as of NewCounter without hash
+// tags, incremented by the script of NewCounter and read by GET, so both can
+// share them, e.g. during a migration. The commands of concurrent requests are
+// auto-pipelined by rueidis, i.e. sent in batches over a few connections. With
+// ClientCacheTTL, the reads are served by the client-side cache of rueidis.
+//
+// Only PrefixKey, KeyTTL, ClientCacheTTL, the fallback and breaker options,
+// OnError, OnErrorAllow, the loggers and Tracer of cfg are used, the
+// connection options and the other modes are not supported. The timeouts are
+// those of the client.
+func NewCounterWithRueidis(client rueidis.Client, cfg *Config) *rueidisCounter {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	c.setBackendDefaults()
+
+	rc := &rueidisCounter{
+		client:          client,
+		prefixKey:       c.PrefixKey,
+		keyTTL:          c.KeyTTL,
+		cacheTTL:        c.ClientCacheTTL,
+		now:             time.Now,
+		done:            make(chan struct{}),
+		fallbackOptions: newFallbackOptions(&c, !c.FallbackDisabled),
+	}
+	if c.now != nil {
+		rc.now = c.now
+	}
+	rc.initFallback(&rc.fallbackOptions, "Redis", rc.done, func() error {
+		return rc.Ping(context.Background())
+	})
+	if !c.FallbackDisabled {
+		rc.fallbackCounter = newFallbackCounter(c.FallbackMaxKeys, c.WindowLength)
+	}
+	return rc
+}
+
+type rueidisCounter struct {
+	client      rueidis.Client
+	limitConfig atomic.Pointer[limitConfig]
+	prefixKey   string
+	keyTTL      time.Duration
+	cacheTTL    time.Duration
+	now         func() time.Time
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	fallbackOptions
+	fallback
+}
+
+func (c *rueidisCounter) Config(requestLimit int, windowLength time.Duration) {
+	c.limitConfig.Store(&limitConfig{requestLimit: requestLimit, windowLength: windowLength})
+	c.configFallback(requestLimit, windowLength)
+}
+
+func (c *rueidisCounter) Increment(key string, currentWindow time.Time) error {
+	return c.IncrementBy(key, currentWindow, 1)
+}
+
+func (c *rueidisCounter) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	return c.IncrementByCtx(context.Background(), key, currentWindow, amount)
+}
+
+// IncrementByCtx is like IncrementBy, but the Redis round-trip is bound to ctx.
+func (c *rueidisCounter) IncrementByCtx(ctx context.Context, key string, currentWindow time.Time, amount int) (err error) {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	var fallback bool
+	ctx, span := startSpan(ctx, c.tracer, spanIncrement, c.prefixKey, currentWindow, c.limitConfig.Load())
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.fallbackIncrementBy(key, currentWindow, amount)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				err = c.fallbackIncrementBy(key, currentWindow, amount)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				err = nil
+			}
+		}()
+	}
+
+	cfg := c.limitConfig.Load()
+	if cfg == nil {
+		return errNotConfigured
+	}
+	ttl := 3 * cfg.windowLength
+	if c.keyTTL != 0 {
+		ttl = max(c.keyTTL, 2*cfg.windowLength)
+	}
+
+	err = rueidisIncrementScript.Exec(ctx, c.client,
+		[]string{c.limitCounterKey(key, currentWindow)},
+		[]string{strconv.Itoa(amount), strconv.FormatInt(ttl.Milliseconds(), 10)},
+	).Error()
+	if err != nil {
+		return c.commandError(ctx, "redis incr failed", err)
+	}
+	return nil
+}
+
+func (c *rueidisCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return c.GetCtx(context.Background(), key, currentWindow, previousWindow)
+}
+
+// GetCtx is like Get, but the Redis round-trip is bound to ctx. The counters
+// are read by a GET each, which are pipelined, so they may live on different
+// cluster slots, and cached one by one with ClientCacheTTL.
+func (c *rueidisCounter) GetCtx(ctx context.Context, key string, currentWindow, previousWindow time.Time) (curr int, prev int, err error) {
+	if c.isClosed() {
+		return 0, 0, ErrClosed
+	}
+
+	var fallback bool
+	ctx, span := startSpan(ctx, c.tracer, spanGet, c.prefixKey, currentWindow, c.limitConfig.Load())
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.fallbackGet(key, currentWindow, previousWindow)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				curr, prev, err = c.fallbackGet(key, currentWindow, previousWindow)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				curr, prev, err = 0, 0, nil
+			}
+		}()
+	}
+
+	currKey := c.limitCounterKey(key, currentWindow)
+	prevKey := c.limitCounterKey(key, previousWindow)
+
+	var results []rueidis.RedisResult
+	if c.cacheTTL > 0 {
+		results = c.client.DoMultiCache(ctx,
+			rueidis.CT(c.client.B().Get().Key(currKey).Cache(), c.cacheTTL),
+			rueidis.CT(c.client.B().Get().Key(prevKey).Cache(), c.cacheTTL),
+		)
+	} else {
+		results = c.client.DoMulti(ctx,
+			c.client.B().Get().Key(currKey).Build(),
+			c.client.B().Get().Key(prevKey).Build(),
+		)
+	}
+
+	var counts [2]int
+	for i, result := range results {
+		value, err := result.ToString()
+		if rueidis.IsRedisNil(err) {
+			continue
+		} else if err != nil {
+			return 0, 0, c.commandError(ctx, "redis get failed", err)
+		}
+		counts[i] = parseCount(value)
+	}
+	return counts[0], counts[1], nil
+}
+
+// Reset deletes the current and previous window counters of the given
+// rate-limit key, like Reset of the Redis counter.
+func (c *rueidisCounter) Reset(ctx context.Context, key string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	cfg := c.limitConfig.Load()
+	if cfg == nil || cfg.windowLength <= 0 {
+		return errNotConfigured
+	}
+	currentWindow := c.now().UTC().Truncate(cfg.windowLength)
+	previousWindow := currentWindow.Add(-cfg.windowLength)
+
+	// A DEL each, as the counters may live on different cluster slots.
+	for _, result := range c.client.DoMulti(ctx,
+		c.client.B().Del().Key(c.limitCounterKey(key, currentWindow)).Build(),
+		c.client.B().Del().Key(c.limitCounterKey(key, previousWindow)).Build(),
+	) {
+		if err := result.Error(); err != nil {
+			return wrapCommandError(ctx, c.isClosed(), "redis del failed", rueidisError(err))
+		}
+	}
+	return nil
+}
+
+// Ping checks the connection of the client by a PING.
+func (c *rueidisCounter) Ping(ctx context.Context) error {
+	return rueidisError(c.client.Do(ctx, c.client.B().Ping().Build()).Error())
+}
+
+// IsFallbackActivated reports whether the local in-memory fallback is serving
+// the requests, i.e. Redis is failing.
+func (c *rueidisCounter) IsFallbackActivated() bool {
+	return c.breaker.isOpen()
+}
+
+// Close stops the fallback probes. The client is not closed, it's owned by the
+// caller of NewCounterWithRueidis.
+func (c *rueidisCounter) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+func (c *rueidisCounter) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// commandError wraps and logs the error of a failed IncrementBy or Get call,
+// like of the Redis counter.
+func (c *rueidisCounter) commandError(ctx context.Context, msg string, err error) error {
+	err = wrapCommandError(ctx, c.isClosed(), msg, rueidisError(err))
+	c.logger.Errorf("%v", err)
+	return err
+}
+
+func (c *rueidisCounter) limitCounterKey(key string, window time.Time) string {
+	var buf [keyBufferSize]byte
+	return string(appendPlainKey(buf[:0], c.prefixKey, key, window))
+}
+
+// rueidisRedisError is an error reply of rueidis, handled like the error
+// replies of go-redis, e.g. OOM by ErrRedisOutOfMemory.
+type rueidisRedisError struct {
+	err *rueidis.RedisError
+}
+
+func (e rueidisRedisError) Error() string { return e.err.Error() }
+
+func (e rueidisRedisError) Unwrap() error { return e.err }
+
+func (rueidisRedisError) RedisError() {}
+
+// rueidisError returns the error replies of err as rueidisRedisError, and the
+// other errors, e.g. of the connection, as is.
+func rueidisError(err error) error {
+	if redisErr, ok := rueidis.IsRedisErr(err); ok {
+		return rueidisRedisError{redisErr}
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/rueidis"
+)
+
+func TestRueidis(t *testing.T) {
+	redis := miniredis.RunT(t)
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounterWithRueidis(newRueidisClient(t, redis.Addr()), &httprateredis.Config{
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:rueidis", previousWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.IncrementBy("key:rueidis", currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if curr, prev, err := limitCounter.Get("key:rueidis", currentWindow, previousWindow); err != nil || curr != 3 || prev != 2 {
+		t.Errorf("unexpected curr = %v, prev = %v, err %v, expected 3, 2", curr, prev, err)
+	}
+
+	// The counters are shared with the go-redis counter.
+	redisCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer redisCounter.Close()
+	redisCounter.Config(1000, time.Minute)
+	if err := redisCounter.IncrementBy("key:rueidis", currentWindow, 5); err != nil {
+		t.Fatal(err)
+	}
+	if curr, prev, err := limitCounter.Get("key:rueidis", currentWindow, previousWindow); err != nil || curr != 8 || prev != 2 {
+		t.Errorf("unexpected curr = %v, prev = %v, err %v, expected 8, 2 with the go-redis increments", curr, prev, err)
+	}
+
+	// The TTL is set by the first increment only.
+	key := redisCounter.LimitCounterKey("key:rueidis", currentWindow)
+	if ttl := redis.TTL(key); ttl != 3*time.Minute {
+		t.Errorf("unexpected TTL %v, expected %v", ttl, 3*time.Minute)
+	}
+	redis.FastForward(time.Second)
+	if err := limitCounter.IncrementBy("key:rueidis", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := redis.TTL(key); ttl != 3*time.Minute-time.Second {
+		t.Errorf("unexpected TTL %v after an increment, expected it not to be refreshed", ttl)
+	}
+
+	// Reset deletes both windows of the key.
+	if err := limitCounter.Reset(context.Background(), "key:rueidis"); err != nil {
+		t.Fatal(err)
+	}
+	if curr, prev, err := limitCounter.Get("key:rueidis", currentWindow, previousWindow); err != nil || curr != 0 || prev != 0 {
+		t.Errorf("unexpected curr = %v, prev = %v, err %v after Reset, expected 0, 0", curr, prev, err)
+	}
+
+	// The client is not closed by the counter.
+	limitCounter.Close()
+	if err := limitCounter.IncrementBy("key:rueidis", currentWindow, 1); !errors.Is(err, httprateredis.ErrClosed) {
+		t.Errorf("unexpected error %v after Close, expected %v", err, httprateredis.ErrClosed)
+	}
+}
+
+func TestRueidisClientCache(t *testing.T) {
+	redis := miniredis.RunT(t)
+
+	// miniredis doesn't support CLIENT TRACKING, so the cached reads of the
+	// client with the cache disabled reach Redis, see the integration test.
+	limitCounter := httprateredis.NewCounterWithRueidis(newRueidisClient(t, redis.Addr()), &httprateredis.Config{
+		FallbackDisabled: true,
+		ClientCacheTTL:   time.Minute,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	for i := 1; i <= 3; i++ {
+		if err := limitCounter.IncrementBy("key:cache", currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+		if curr, prev, err := limitCounter.Get("key:cache", currentWindow, previousWindow); err != nil || curr != i || prev != 0 {
+			t.Errorf("unexpected curr = %v, prev = %v, err %v, expected %v, 0", curr, prev, err, i)
+		}
+	}
+}
+
+func TestRueidisFallback(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newRueidisClient(t, redis.Addr())
+	redis.Close() // Redis is down, all requests are served by the fallback.
+
+	limitCounter := httprateredis.NewCounterWithRueidis(client, &httprateredis.Config{
+		CooldownPeriod: time.Hour,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:fallback", currentWindow, 5); err != nil {
+		t.Fatalf("expected the local fallback on Redis errors, got %v", err)
+	}
+	if !limitCounter.IsFallbackActivated() {
+		t.Fatal("expected fallback to be activated")
+	}
+	if curr, _, err := limitCounter.Get("key:fallback", currentWindow, previousWindow); err != nil || curr != 5 {
+		t.Errorf("unexpected curr = %v, err %v, expected 5 from the local fallback", curr, err)
+	}
+}
+
+func newRueidisClient(t *testing.T, addr string) rueidis.Client {
+	t.Helper()
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{addr},
+		DisableCache: true, // miniredis doesn't support CLIENT TRACKING
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
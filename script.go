@@ -0,0 +1,52 @@
+package httprateredis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// runScriptOn runs the script via EVALSHA, so only the SHA is sent. When the
+// script is not cached on the Redis server yet (NOSCRIPT), e.g. after a restart,
+// failover or SCRIPT FLUSH, it's loaded by SCRIPT LOAD and run again. Concurrent
+// callers share the same SCRIPT LOAD, so a flush doesn't cause a storm of them.
+// With UseFunctions, the script function is run via FCALL instead.
+//
+// The client is the one of the database of the keys, see clientFor. The
+// scripts are cached per server, so they're loaded on the counter client.
+func (c *redisCounter) runScriptOn(ctx context.Context, client redis.Cmdable, script *redis.Script, keys []string, args ...any) *redis.Cmd {
+	if c.useFunctions {
+		return c.fcall(ctx, client, script, keys, args...)
+	}
+	cmd := script.EvalSha(ctx, client, keys, args...)
+	if err := cmd.Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return cmd
+	}
+
+	c.logger.Debugf("httprateredis: script %s not loaded, reloading", script.Hash())
+	if err := c.loadScript(ctx, script); err != nil {
+		// Let EVAL cache the script, e.g. if SCRIPT LOAD is not allowed.
+		return script.Eval(ctx, client, keys, args...)
+	}
+	cmd = script.EvalSha(ctx, client, keys, args...)
+	if err := cmd.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		// Flushed again (or loaded on another cluster node).
+		return script.Eval(ctx, client, keys, args...)
+	}
+	return cmd
+}
+
+// loadScript loads the script by SCRIPT LOAD, on all masters in cluster mode
+// and on all shards of ShardAddrs. Concurrent callers share the same load.
+func (c *redisCounter) loadScript(ctx context.Context, script *redis.Script) error {
+	_, err, _ := c.scriptsLoad.Do(script.Hash(), func() (any, error) {
+		if ring, ok := c.client.(*redis.Ring); ok {
+			return nil, ring.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+				return script.Load(ctx, client).Err()
+			})
+		}
+		return nil, script.Load(ctx, c.client).Err()
+	})
+	return err
+}
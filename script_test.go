@@ -0,0 +1,367 @@
+package httprateredis_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestIncrementSetsTTL(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 3; j++ {
+			if err := limitCounter.IncrementBy(fmt.Sprintf("key:%v", i), currentWindow, j+1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	keys := redis.Keys()
+	if len(keys) != 10 {
+		t.Fatalf("unexpected keys %v, expected 10", keys)
+	}
+	for _, key := range keys {
+		if ttl := redis.TTL(key); ttl <= 0 || ttl > 3*time.Minute {
+			t.Errorf("key %q: unexpected TTL %v", key, ttl)
+		}
+		if v, _ := redis.Get(key); v != "6" {
+			t.Errorf("key %q: unexpected value %q, expected 6", key, v)
+		}
+	}
+}
+
+func TestIncrementKeepsTTL(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	if err := limitCounter.IncrementBy("key:ttl", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TTL is set when the counter is created only, the later increments
+	// within the same window don't extend it.
+	for i := 0; i < 3; i++ {
+		redis.FastForward(10 * time.Second)
+		if err := limitCounter.IncrementBy("key:ttl", currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := redis.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("unexpected keys %v, expected 1", keys)
+	}
+	if ttl := redis.TTL(keys[0]); ttl != 3*time.Minute-30*time.Second {
+		t.Errorf("unexpected TTL %v, expected %v", ttl, 3*time.Minute-30*time.Second)
+	}
+}
+
+func TestIncrementNeverLeaksKeysWithoutTTL(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		PrefixKey:        "leak",
+		FallbackTimeout:  200 * time.Millisecond,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	if err := limitCounter.Increment("key:leaked", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+	leakedKey := redis.Keys()[0]
+	redis.Del(leakedKey)
+
+	for i := 0; i < 10; i++ {
+		if err := limitCounter.Increment(fmt.Sprintf("key:%v", i), currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Failed increments must not leave any keys behind.
+	redis.SetError("LOADING Redis is loading the dataset in memory")
+	for i := 10; i < 20; i++ {
+		if err := limitCounter.Increment(fmt.Sprintf("key:%v", i), currentWindow); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	redis.SetError("")
+
+	// Leaked key without TTL, e.g. INCR succeeded but EXPIRE failed in an older
+	// non-atomic client, must get TTL on the next increment.
+	if err := redis.Set(leakedKey, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.Increment("key:leaked", currentWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := redis.Keys()
+	if len(keys) != 11 {
+		t.Fatalf("unexpected keys %v, expected 11", keys)
+	}
+	for _, key := range keys {
+		if ttl := redis.TTL(key); ttl <= 0 {
+			t.Errorf("key %q: unexpected TTL %v, expected positive TTL", key, ttl)
+		}
+	}
+}
+
+func TestKeyTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		keyTTL time.Duration
+		ttl    time.Duration
+	}{
+		{name: "default", ttl: 3 * time.Minute},
+		{name: "custom", keyTTL: 5 * time.Minute, ttl: 5 * time.Minute},
+		{name: "less than 2 windows", keyTTL: time.Minute, ttl: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer redis.Close()
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				KeyTTL:           tt.keyTTL,
+				FallbackDisabled: true,
+			})
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			nextWindow := currentWindow.Add(time.Minute)
+
+			if err := limitCounter.IncrementBy("key:ttl", currentWindow, 5); err != nil {
+				t.Fatal(err)
+			}
+			keys := redis.Keys()
+			if len(keys) != 1 {
+				t.Fatalf("unexpected keys %v, expected 1", keys)
+			}
+			if ttl := redis.TTL(keys[0]); ttl != tt.ttl {
+				t.Errorf("unexpected TTL %v, expected %v", ttl, tt.ttl)
+			}
+
+			// Worst case: the counter was created at the very start of its window and
+			// it's read as the previous window counter at the very end of the next one.
+			redis.FastForward(2*time.Minute - time.Millisecond)
+
+			_, prev, err := limitCounter.Get("key:ttl", nextWindow, currentWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prev != 5 {
+				t.Errorf("unexpected prev = %v, expected the previous window counter to survive", prev)
+			}
+		})
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyTTL   time.Duration
+		min, max time.Duration
+	}{
+		{name: "default", min: 3*time.Minute - 30*time.Second, max: 3*time.Minute + 30*time.Second},
+		{name: "2 windows", keyTTL: 2 * time.Minute, min: 2 * time.Minute, max: 2*time.Minute + 30*time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer redis.Close()
+			redisPort, _ := strconv.Atoi(redis.Port())
+
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				KeyTTL:           tt.keyTTL,
+				TTLJitter:        30 * time.Second,
+				FallbackDisabled: true,
+			})
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+
+			currentWindow := time.Now().UTC().Truncate(time.Minute)
+			for i := 0; i < 100; i++ {
+				if err := limitCounter.IncrementBy(fmt.Sprintf("key:%v", i), currentWindow, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The TTLs are spread, but never below the 2 windows Get needs.
+			ttls := map[time.Duration]bool{}
+			for _, key := range redis.Keys() {
+				ttl := redis.TTL(key)
+				if ttl < tt.min || ttl > tt.max {
+					t.Errorf("unexpected TTL %v, expected between %v and %v", ttl, tt.min, tt.max)
+				}
+				ttls[ttl] = true
+			}
+			if len(ttls) < 10 {
+				t.Errorf("unexpected %v distinct TTLs of 100 keys, expected them to be spread", len(ttls))
+			}
+		})
+	}
+}
+
+func BenchmarkIncrementBy(b *testing.B) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	b.ResetTimer()
+	start := redis.CommandCount()
+
+	for i := 0; i < b.N; i++ {
+		_ = limitCounter.IncrementBy(fmt.Sprintf("key:%v", i%100), currentWindow, 1)
+	}
+
+	b.ReportMetric(float64(redis.CommandCount()-start)/float64(b.N), "cmds/op")
+}
+
+func TestScriptFlush(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	redisPort, _ := strconv.Atoi(mr.Port())
+
+	var evals, scriptLoads atomic.Int64
+	mr.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		switch {
+		case cmd == "EVAL":
+			evals.Add(1)
+		case cmd == "SCRIPT" && len(args) > 0 && strings.EqualFold(args[0], "LOAD"):
+			scriptLoads.Add(1)
+		}
+		return false
+	})
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             mr.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	for round := 0; round < 3; round++ {
+		// Flush the script cache mid-run, e.g. like a Redis restart.
+		if err := client.ScriptFlush(context.Background()).Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		var g errgroup.Group
+		for i := 0; i < 50; i++ {
+			g.Go(func() error {
+				return limitCounter.IncrementBy("key:flush", currentWindow, 1)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+	}
+
+	curr, _, err := limitCounter.Get("key:flush", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 150 {
+		t.Errorf("unexpected curr = %v, expected 150", curr)
+	}
+	// Concurrent callers share the reloads, while EVALSHA keeps the full
+	// script off the wire.
+	if n := scriptLoads.Load(); n < 3 || n > 30 {
+		t.Errorf("unexpected %v SCRIPT LOAD calls, expected about one per flush", n)
+	}
+	if n := evals.Load(); n != 0 {
+		t.Errorf("unexpected %v EVAL calls, expected 0", n)
+	}
+}
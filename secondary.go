@@ -0,0 +1,19 @@
+package httprateredis
+
+// newSecondary returns the counter of the secondary Redis of cfg, see
+// Config.SecondaryHost. It's the primary config with the address replaced,
+// with the local in-memory fallback of the primary, if enabled.
+func newSecondary(cfg *Config) *redisCounter {
+	secondary := *cfg
+	secondary.Host = cfg.SecondaryHost
+	secondary.Port = cfg.SecondaryPort
+	secondary.SecondaryHost = ""
+	secondary.SecondaryPort = 0
+	secondary.Network = "tcp"
+	secondary.Client = nil
+	secondary.SentinelAddrs = nil
+	secondary.ClusterAddrs = nil
+	secondary.ShardAddrs = nil
+	secondary.ReplicaAddrs = nil
+	return newCounter(&secondary)
+}
@@ -0,0 +1,86 @@
+package httprateredis_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestSecondary(t *testing.T) {
+	primary, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+	primaryPort, _ := strconv.Atoi(primary.Port())
+	secondary, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	secondaryPort, _ := strconv.Atoi(secondary.Port())
+
+	// Two app servers sharing the primary and the secondary.
+	var fallbackChanges []bool
+	newCounter := func() httprateredis.LimitCounter {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             primary.Host(),
+			Port:             uint16(primaryPort),
+			SecondaryHost:    secondary.Host(),
+			SecondaryPort:    uint16(secondaryPort),
+			FallbackTimeout:  100 * time.Millisecond,
+			OnFallbackChange: func(activated bool) { fallbackChanges = append(fallbackChanges, activated) },
+		})
+		limitCounter.Config(1000, time.Minute)
+		return limitCounter
+	}
+	server1, server2 := newCounter(), newCounter()
+	defer server1.Close()
+	defer server2.Close()
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	assertCurr := func(limitCounter httprateredis.LimitCounter, expected int) {
+		t.Helper()
+		curr, _, err := limitCounter.Get("key:secondary", currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != expected {
+			t.Errorf("unexpected curr = %v, expected %v", curr, expected)
+		}
+	}
+
+	if err := server1.IncrementBy("key:secondary", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	assertCurr(server2, 1)
+
+	// The primary is down, both servers count on the secondary.
+	primary.Close()
+	for _, limitCounter := range []httprateredis.LimitCounter{server1, server2, server1} {
+		if err := limitCounter.IncrementBy("key:secondary", currentWindow, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertCurr(server1, 6)
+	assertCurr(server2, 6)
+	if keys := secondary.Keys(); len(keys) != 1 {
+		t.Errorf("unexpected secondary keys %v, expected the counter", keys)
+	}
+
+	// Both are down, each server counts locally.
+	secondary.Close()
+	if err := server1.IncrementBy("key:secondary", currentWindow, 10); err != nil {
+		t.Fatal(err)
+	}
+	assertCurr(server1, 10)
+	assertCurr(server2, 0)
+	if len(fallbackChanges) != 4 {
+		t.Errorf("unexpected fallback changes %v, expected the primary and secondary of both servers", fallbackChanges)
+	}
+}
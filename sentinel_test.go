@@ -0,0 +1,108 @@
+package httprateredis_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestSentinelFailover(t *testing.T) {
+	master1, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master1.Close()
+
+	master2, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master2.Close()
+
+	sentinel := newFakeSentinel(t, "mymaster", master1)
+	defer sentinel.Close()
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		SentinelAddrs:    []string{sentinel.Addr()},
+		MasterName:       "mymaster",
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	if err := limitCounter.IncrementBy("key:sentinel", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(master1.Keys()) != 1 {
+		t.Fatalf("expected counter on the first master, got keys %v", master1.Keys())
+	}
+
+	// Simulate failover.
+	sentinel.setMaster(master2)
+	master1.Close()
+
+	// Connections to the old master might fail until they are detected as broken.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err = limitCounter.IncrementBy("key:sentinel", currentWindow, 1)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(master2.Keys()) != 1 {
+		t.Fatalf("expected counter on the new master, got keys %v", master2.Keys())
+	}
+}
+
+// fakeSentinel is a miniredis instance answering the SENTINEL commands
+// the go-redis failover client needs to discover the master.
+type fakeSentinel struct {
+	*miniredis.Miniredis
+
+	mu     sync.Mutex
+	master *miniredis.Miniredis
+}
+
+func newFakeSentinel(t *testing.T, masterName string, master *miniredis.Miniredis) *fakeSentinel {
+	t.Helper()
+
+	s := &fakeSentinel{Miniredis: miniredis.NewMiniRedis(), master: master}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name") && args[1] == masterName:
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			c.WriteStrings([]string{s.master.Host(), s.master.Port()})
+		case len(args) == 2 && args[1] == masterName:
+			c.WriteLen(0)
+		default:
+			c.WriteNull()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (s *fakeSentinel) setMaster(master *miniredis.Miniredis) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.master = master
+}
@@ -0,0 +1,77 @@
+package httprateredis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serverTimeSyncInterval is how often UseServerTime measures the offset of the
+// Redis server clock, which drifts slowly compared to the window lengths.
+const serverTimeSyncInterval = time.Minute
+
+// serverClock is the Redis server clock of UseServerTime, the local clock plus
+// the offset measured by the TIME command, so there's no TIME round-trip per
+// request. Until the first measurement succeeds, it's the local clock.
+type serverClock struct {
+	local  func() time.Time
+	offset atomic.Int64 // nanoseconds
+	start  sync.Once
+	sync   func() // measures the offset, started by the first now call
+}
+
+// now returns the server time. The first call starts the offset measurements,
+// so NewCounter doesn't talk to Redis before the first command, like without
+// UseServerTime.
+func (s *serverClock) now() time.Time {
+	s.start.Do(func() { go s.sync() })
+	return s.local().Add(time.Duration(s.offset.Load()))
+}
+
+// syncServerTime measures the server clock offset right away and then every
+// serverTimeSyncInterval, until the counter is closed.
+func (c *redisCounter) syncServerTime(clock *serverClock) {
+	ticker := time.NewTicker(serverTimeSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		start := clock.local()
+		serverTime, err := c.client.Time(ctx).Result()
+		end := clock.local()
+		cancel()
+		if err != nil {
+			c.logger.Errorf("httprateredis: redis time failed: %v", err)
+		} else {
+			// Assume the server read its clock halfway through the round-trip.
+			clock.offset.Store(int64(serverTime.Sub(start.Add(end.Sub(start) / 2))))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// windowsOf returns the windows to count the given rate-limit key in. With
+// UseServerTime, the windows passed by httprate (computed by the local clock)
+// are replaced by the windows of the server clock.
+func (c *redisCounter) windowsOf(key string, currentWindow, previousWindow time.Time) (time.Time, time.Time) {
+	if !c.useServerTime {
+		return currentWindow, previousWindow
+	}
+	_, windowLength := c.limits(key)
+	serverCurrent, serverPrevious, err := c.windows(c.now(), windowLength)
+	if err != nil {
+		return currentWindow, previousWindow
+	}
+	return serverCurrent, serverPrevious
+}
@@ -0,0 +1,116 @@
+package httprateredis_test
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestUseServerTime(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	serverWindow := time.Now().UTC().Truncate(time.Minute)
+	serverTime := serverWindow.Add(30 * time.Second)
+	redis.SetTime(serverTime)
+	start := time.Now()
+
+	// App servers with clocks 40s ahead of and behind the Redis server clock,
+	// i.e. in the next and the previous window.
+	skews := []time.Duration{40 * time.Second, -40 * time.Second}
+	for _, skew := range skews {
+		clock := func() time.Time { return serverTime.Add(skew + time.Since(start)) }
+		limitCounter := httprateredis.NewCounterWithOptions(
+			httprateredis.WithHost(redis.Host()),
+			httprateredis.WithPort(uint16(redisPort)),
+			httprateredis.WithFallbackDisabled(),
+			httprateredis.WithClock(clock),
+			func(cfg *httprateredis.Config) { cfg.UseServerTime = true },
+		)
+		defer limitCounter.Close()
+		limitCounter.Config(1000, time.Minute)
+
+		deadline := time.Now().Add(time.Second)
+		for !limitCounter.ResetAt("key:time").Equal(serverWindow.Add(time.Minute)) {
+			if time.Now().After(deadline) {
+				t.Fatalf("skew %v: server time not synced, reset at %v", skew, limitCounter.ResetAt("key:time"))
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		// The window computed by httprate from the skewed local clock is ignored.
+		localWindow := clock().UTC().Truncate(time.Minute)
+		if err := limitCounter.IncrementBy("key:time", localWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	curr, prev, err := limitCounter.Get("key:time", serverWindow, serverWindow.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 2 || prev != 0 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected both increments in the server window", curr, prev)
+	}
+}
+
+func TestUseServerTimeFirstCommand(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var times atomic.Int64
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if strings.EqualFold(cmd, "TIME") {
+			times.Add(1)
+		}
+		return false
+	})
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackDisabled: true,
+		UseServerTime:    true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := times.Load(); n != 0 {
+		t.Fatalf("unexpected %v TIME commands before the first command, expected none", n)
+	}
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	if err := limitCounter.IncrementBy("key:time", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for times.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("server time not synced after the first command")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,98 @@
+package httprateredis
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zeebo/xxh3"
+)
+
+// defaultShardVirtualNodes is the default of Config.ShardVirtualNodes, the same
+// as of ketama.
+const defaultShardVirtualNodes = 160
+
+// ringOptions returns the options of the ShardAddrs ring. The shards are named
+// by their addresses, so reordering ShardAddrs doesn't move the keys.
+func ringOptions(opts *redis.UniversalOptions, shardAddrs []string, virtualNodes int) *redis.RingOptions {
+	addrs := make(map[string]string, len(shardAddrs))
+	for _, addr := range shardAddrs {
+		addrs[addr] = addr
+	}
+	return &redis.RingOptions{
+		Addrs:                 addrs,
+		ClientName:            opts.ClientName,
+		Protocol:              opts.Protocol,
+		Username:              opts.Username,
+		Password:              opts.Password,
+		DB:                    opts.DB,
+		MaxRetries:            opts.MaxRetries,
+		DialTimeout:           opts.DialTimeout,
+		ReadTimeout:           opts.ReadTimeout,
+		WriteTimeout:          opts.WriteTimeout,
+		ContextTimeoutEnabled: opts.ContextTimeoutEnabled,
+		PoolSize:              opts.PoolSize,
+		PoolTimeout:           opts.PoolTimeout,
+		MinIdleConns:          opts.MinIdleConns,
+		MaxIdleConns:          opts.MaxIdleConns,
+		ConnMaxLifetime:       opts.ConnMaxLifetime,
+		TLSConfig:             opts.TLSConfig,
+		DisableIdentity:       opts.DisableIdentity,
+		IdentitySuffix:        opts.IdentitySuffix,
+		NewConsistentHash: func(shards []string) redis.ConsistentHash {
+			return newHashRing(shards, virtualNodes)
+		},
+	}
+}
+
+// hashRing is the consistent hash of the ShardAddrs ring: each shard is placed
+// on the ring at virtualNodes points, and the key belongs to the shard of the
+// first point following the key hash. Adding a shard moves only the keys which
+// hash right before its points, about 1/n of the keys of n shards, and removing
+// a shard moves only its keys. More virtual nodes spread the keys more evenly.
+type hashRing struct {
+	points []uint64 // sorted
+	shards []string // of the points
+}
+
+var _ redis.ConsistentHash = (*hashRing)(nil)
+
+func newHashRing(shards []string, virtualNodes int) *hashRing {
+	type point struct {
+		hash  uint64
+		shard string
+	}
+	points := make([]point, 0, len(shards)*virtualNodes)
+	for _, shard := range shards {
+		for i := 0; i < virtualNodes; i++ {
+			points = append(points, point{xxh3.HashString(shard + "#" + strconv.Itoa(i)), shard})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return 0
+	})
+
+	r := &hashRing{points: make([]uint64, len(points)), shards: make([]string, len(points))}
+	for i, p := range points {
+		r.points[i], r.shards[i] = p.hash, p.shard
+	}
+	return r
+}
+
+// Get returns the shard of the key, or "" if there are no shards.
+func (r *hashRing) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	i, _ := slices.BinarySearch(r.points, xxh3.HashString(key))
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[i]
+}
@@ -0,0 +1,129 @@
+package httprateredis_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestShardAddrs(t *testing.T) {
+	var (
+		shards []*miniredis.Miniredis
+		addrs  []string
+	)
+	for i := 0; i < 3; i++ {
+		shard, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer shard.Close()
+		shards = append(shards, shard)
+		addrs = append(addrs, shard.Addr())
+	}
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		ShardAddrs:       addrs,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	const numKeys = 30
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if err := limitCounter.IncrementBy(key, previousWindow, i); err != nil {
+			t.Fatal(err)
+		}
+		if err := limitCounter.IncrementBy(key, currentWindow, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		curr, prev, err := limitCounter.Get(key, currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != i+1 || prev != i {
+			t.Errorf("%v: unexpected curr = %v, prev = %v, expected %v, %v", key, curr, prev, i+1, i)
+		}
+	}
+
+	// Both windows of a key live on the same shard, the keys are spread across the shards.
+	shardOf := map[string]int{}
+	for i, shard := range shards {
+		for _, key := range shard.Keys() {
+			tag := hashTag(key)
+			if j, ok := shardOf[tag]; ok && j != i {
+				t.Errorf("windows of %v on shards %v and %v, expected the same shard", tag, j, i)
+			}
+			shardOf[tag] = i
+		}
+	}
+	if len(shardOf) != numKeys {
+		t.Errorf("unexpected %v hash tags, expected %v", len(shardOf), numKeys)
+	}
+	for i, shard := range shards {
+		if len(shard.Keys()) == 0 {
+			t.Errorf("expected the keys spread across the shards, shard %v is empty", i)
+		}
+	}
+
+	if err := limitCounter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := limitCounter.IncrementBy("key:0", currentWindow, 1); !errors.Is(err, httprateredis.ErrClosed) {
+		t.Errorf("unexpected error %v, expected ErrClosed", err)
+	}
+}
+
+// TestShardRemapping checks that adding a shard moves its share of the keys
+// only, all to the new shard, so the limits of the other keys stay intact.
+func TestShardRemapping(t *testing.T) {
+	const numKeys = 10000
+	for _, virtualNodes := range []int{1, 10, 160} {
+		for n := 2; n <= 5; n++ {
+			var shards []string
+			for i := 0; i < n; i++ {
+				shards = append(shards, fmt.Sprintf("10.0.0.%d:6379", i+1))
+			}
+			grown := append(shards[:n:n], fmt.Sprintf("10.0.0.%d:6379", n+1))
+
+			shardOf, grownShardOf := httprateredis.ShardOf(shards, virtualNodes), httprateredis.ShardOf(grown, virtualNodes)
+			moved := 0
+			counts := map[string]int{}
+			for i := 0; i < numKeys; i++ {
+				key := fmt.Sprintf("key:%d", i)
+				before, after := shardOf(key), grownShardOf(key)
+				counts[after]++
+				if before == after {
+					continue
+				}
+				moved++
+				if after != grown[n] {
+					t.Fatalf("%v virtual nodes, %v shards: key %q moved from %v to %v, expected the new shard only", virtualNodes, n, key, before, after)
+				}
+			}
+			if virtualNodes < 160 {
+				continue // Too few points to spread the keys evenly.
+			}
+
+			// The new shard takes about 1/(n+1) of the keys.
+			if expected := numKeys / (n + 1); moved < expected/2 || moved > expected*3/2 {
+				t.Errorf("%v shards: %v keys moved, expected about %v", n, moved, expected)
+			}
+			for shard, count := range counts {
+				if expected := numKeys / (n + 1); count < expected/2 || count > expected*3/2 {
+					t.Errorf("%v shards: %v keys on %v, expected about %v", n, count, shard, expected)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package httprateredis
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+)
+
+// Mode is the rate-limiting algorithm of the counter.
+type Mode string
+
+const (
+	// ModeSlidingWindow approximates the sliding window by weighting the previous
+	// fixed window count, as httprate does. It stores one integer per rate-limit
+	// key and window, but can over- or under-count when the requests are not
+	// spread evenly over the previous window.
+	ModeSlidingWindow Mode = "sliding_window"
+
+	// ModeSlidingLog counts the requests within the trailing window exactly. Each
+	// request is stored as a timestamped member of a sorted set per rate-limit
+	// key, so memory grows with the request limit (roughly 50-100 bytes per
+	// request within the window) and IncrementBy costs O(amount * log(N)).
+	ModeSlidingLog Mode = "sliding_log"
+)
+
+// incrementLogScript trims the requests out of the trailing window and records
+// the new ones with the current timestamp. ARGV[4] makes the members unique.
+var incrementLogScript = newScript("increment_log", `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+for i = 1, tonumber(ARGV[3]) do
+	redis.call('ZADD', KEYS[1], now, ARGV[4] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return redis.call('ZCARD', KEYS[1])
+`)
+
+func (c *redisCounter) incrementLog(ctx context.Context, key string, amount int) error {
+	_, windowLength := c.limits(key)
+	logKey := c.stateKey(key, "log")
+	now := c.now().UnixMilli()
+	id := strconv.FormatInt(now, 36) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	err := c.withRetry(ctx, false, func() error {
+		return c.runScriptOn(ctx, c.clientFor(key), incrementLogScript, []string{logKey}, now, windowLength.Milliseconds(), amount, id).Err()
+	})
+	if err != nil {
+		return c.commandError(ctx, "redis zadd failed", err)
+	}
+	return nil
+}
+
+// getLog returns the number of requests within the trailing window as the
+// current window count, and zero previous window count, so httprate's
+// weighted rate equals the exact count.
+func (c *redisCounter) getLog(ctx context.Context, key string) (curr int, prev int, err error) {
+	_, windowLength := c.limits(key)
+	logKey := c.stateKey(key, "log")
+	now := c.now().UnixMilli()
+
+	var count int64
+	err = c.withRetry(ctx, true, func() (err error) {
+		count, err = c.clientFor(key).ZCount(ctx, logKey, "("+strconv.FormatInt(now-windowLength.Milliseconds(), 10), "+inf").Result()
+		return err
+	})
+	if err != nil {
+		return 0, 0, c.commandError(ctx, "redis zcount failed", err)
+	}
+	return int(count), 0, nil
+}
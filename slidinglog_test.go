@@ -0,0 +1,94 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestSlidingLog(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	newCounter := func(mode httprateredis.Mode) peekingCounter {
+		limitCounter := httprateredis.NewCounterWithOptions(
+			httprateredis.WithHost(redis.Host()),
+			httprateredis.WithPort(uint16(redisPort)),
+			httprateredis.WithPrefix(string(mode)),
+			httprateredis.WithMode(mode),
+			httprateredis.WithFallbackDisabled(),
+			httprateredis.WithClock(func() time.Time { return now }),
+		)
+		t.Cleanup(func() { limitCounter.Close() })
+		limitCounter.Config(100, time.Minute)
+		return limitCounter
+	}
+	approximate := newCounter(httprateredis.ModeSlidingWindow)
+	exact := newCounter(httprateredis.ModeSlidingLog)
+
+	// A burst at the beginning and the end of the first window.
+	for _, at := range []time.Duration{5 * time.Second, 55 * time.Second} {
+		now = start.Add(at)
+		for _, limitCounter := range []peekingCounter{approximate, exact} {
+			if err := limitCounter.IncrementBy("key:log", now.Truncate(time.Minute), 10); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		at          time.Duration
+		exact       int
+		approximate int
+	}{
+		{at: 59 * time.Second, exact: 20, approximate: 20},
+		{at: 64 * time.Second, exact: 20, approximate: 19}, // 20 * 56/60, the first burst is still within the last minute.
+		{at: 70 * time.Second, exact: 10, approximate: 17}, // 20 * 50/60, the first burst is out of the last minute.
+		{at: 110 * time.Second, exact: 10, approximate: 3}, // 20 * 10/60, the second burst is still within the last minute.
+		{at: 116 * time.Second, exact: 0, approximate: 1},
+	}
+	for _, tt := range tests {
+		now = start.Add(tt.at)
+
+		if used, err := exact.Peek(context.Background(), "key:log"); err != nil || used != tt.exact {
+			t.Errorf("%v: unexpected exact Peek() = %v, %v, expected %v", tt.at, used, err, tt.exact)
+		}
+		if used, err := approximate.Peek(context.Background(), "key:log"); err != nil || used != tt.approximate {
+			t.Errorf("%v: unexpected approximate Peek() = %v, %v, expected %v", tt.at, used, err, tt.approximate)
+		}
+	}
+
+	// Old requests are trimmed on the next increment, the key expires after a window.
+	if err := exact.IncrementBy("key:log", now.Truncate(time.Minute), 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range redis.Keys() {
+		if !strings.HasPrefix(key, "sliding_log:") {
+			continue
+		}
+		if members, _ := redis.ZMembers(key); len(members) != 1 {
+			t.Errorf("unexpected members %v, expected 1", members)
+		}
+		if ttl := redis.TTL(key); ttl != time.Minute {
+			t.Errorf("unexpected TTL %v, expected 1m", ttl)
+		}
+	}
+}
+
+type peekingCounter interface {
+	httprate.LimitCounter
+	Peek(ctx context.Context, key string) (int, error)
+}
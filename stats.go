@@ -0,0 +1,72 @@
+package httprateredis
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are cumulative counters of the counter operations since it was created.
+type Stats struct {
+	Increments          int64 // IncrementBy calls, including those served by the fallback
+	Gets                int64 // Get calls, including those served by the fallback
+	RedisErrors         int64 // failed Redis commands
+	FallbackActivations int64 // number of times the local in-memory fallback was activated
+
+	// PoolWaits counts the Redis commands which waited for a free connection,
+	// PoolWaitTime is their total wait time, as counted by the go-redis pool
+	// shared with the WithPrefix views, see Config.OnPoolWait. They're zero in
+	// cluster mode and with ShardAddrs, which don't sum them over the nodes.
+	PoolWaits    int64
+	PoolWaitTime time.Duration
+}
+
+type stats struct {
+	increments  atomic.Int64
+	gets        atomic.Int64
+	redisErrors atomic.Int64
+}
+
+// Stats returns a snapshot of the counter stats. Safe for concurrent use.
+func (c *redisCounter) Stats() Stats {
+	stats := Stats{
+		Increments:          c.stats.increments.Load(),
+		Gets:                c.stats.gets.Load(),
+		RedisErrors:         c.stats.redisErrors.Load(),
+		FallbackActivations: c.activations.Load(),
+	}
+	s := c.client.PoolStats()
+	stats.PoolWaits = int64(s.WaitCount)
+	stats.PoolWaitTime = time.Duration(s.WaitDurationNs)
+	return stats
+}
+
+// PoolStats are the connection pool stats of the Redis client. Connections are
+// read on each call, while Hits, Misses and Timeouts are cumulative counters.
+//
+// Waits for longer than the pool timeout are counted by Timeouts, while Misses
+// counts the borrows which had to dial a new connection. The time the borrowers
+// waited for a free connection is in Stats.PoolWaitTime.
+type PoolStats struct {
+	ActiveConns int // connections in use
+	IdleConns   int // connections waiting in the pool
+	TotalConns  int // ActiveConns + IdleConns, at most MaxActive per node
+
+	Hits     int64 // borrows served by an idle connection
+	Misses   int64 // borrows which dialed a new connection
+	Timeouts int64 // borrows which timed out waiting for a free connection
+}
+
+// PoolStats returns a snapshot of the connection pool stats, summed over all
+// nodes in cluster mode. It's cheap: the counters are atomic and the connection
+// counts only briefly take the pool lock, so it can be polled e.g. by metrics.
+func (c *redisCounter) PoolStats() PoolStats {
+	s := c.client.PoolStats()
+	return PoolStats{
+		ActiveConns: max(0, int(s.TotalConns)-int(s.IdleConns)),
+		IdleConns:   int(s.IdleConns),
+		TotalConns:  int(s.TotalConns),
+		Hits:        int64(s.Hits),
+		Misses:      int64(s.Misses),
+		Timeouts:    int64(s.Timeouts),
+	}
+}
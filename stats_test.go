@@ -0,0 +1,206 @@
+package httprateredis_test
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestStats(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  time.Minute,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.Increment("key:stats", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := limitCounter.Get("key:stats", currentWindow, previousWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats, expected := limitCounter.Stats(), (httprateredis.Stats{Increments: 3, Gets: 1}); stats != expected {
+		t.Errorf("unexpected stats %+v, expected %+v", stats, expected)
+	}
+
+	redis.Close()
+
+	// The first failure activates the fallback, the following
+	// operations are served by the local counter without Redis.
+	for i := 0; i < 2; i++ {
+		if err := limitCounter.Increment("key:stats", currentWindow); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := limitCounter.Get("key:stats", currentWindow, previousWindow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats, expected := limitCounter.Stats(), (httprateredis.Stats{Increments: 5, Gets: 3, RedisErrors: 1, FallbackActivations: 1}); stats != expected {
+		t.Errorf("unexpected stats %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		MaxActive:        3,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	var g errgroup.Group
+	for i := 0; i < 100; i++ {
+		g.Go(func() error {
+			if err := limitCounter.IncrementBy("key:pool", currentWindow, 1); err != nil {
+				return err
+			}
+			_, _, err := limitCounter.Get("key:pool", currentWindow, previousWindow)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := limitCounter.PoolStats()
+	if stats.Hits+stats.Misses < 200 {
+		t.Errorf("unexpected hits %v + misses %v, expected at least 200 borrows", stats.Hits, stats.Misses)
+	}
+	if stats.Misses < 1 || stats.TotalConns < 1 || stats.TotalConns > 3 {
+		t.Errorf("unexpected stats %+v, expected 1 to 3 dialed connections", stats)
+	}
+	if stats.ActiveConns != 0 || stats.IdleConns != stats.TotalConns {
+		t.Errorf("unexpected stats %+v, expected all connections idle", stats)
+	}
+}
+
+func TestPoolStatsActive(t *testing.T) {
+	// A server which never replies keeps the connection borrowed.
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             host,
+		Port:             port,
+		MaxActive:        1,
+		ReadTimeout:      time.Second,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = limitCounter.Increment("key:pool", time.Now().UTC().Truncate(time.Minute))
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for limitCounter.PoolStats().ActiveConns != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := limitCounter.PoolStats(); stats.ActiveConns != 1 || stats.IdleConns != 0 {
+		t.Errorf("unexpected stats %+v, expected 1 active connection", stats)
+	}
+	<-done
+}
+
+func TestPoolWait(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	// Slow commands keep the only connection borrowed.
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if cmd == "MGET" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	})
+
+	var onPoolWait atomic.Int64
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		MaxActive:        1,
+		FallbackDisabled: true,
+		OnPoolWait:       func(wait time.Duration) { onPoolWait.Add(1) },
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if _, _, err := limitCounter.Get("key:pool", currentWindow, previousWindow); err != nil {
+		t.Fatal(err)
+	}
+	if stats := limitCounter.Stats(); stats.PoolWaits != 0 || stats.PoolWaitTime != 0 {
+		t.Errorf("unexpected stats %+v, expected no waits of a single borrower", stats)
+	}
+
+	var g errgroup.Group
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			_, _, err := limitCounter.Get("key:pool", currentWindow, previousWindow)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := limitCounter.Stats()
+	if stats.PoolWaits < 1 || stats.PoolWaits > 9 {
+		t.Errorf("unexpected %v pool waits, expected 1 to 9 of 10 concurrent borrowers", stats.PoolWaits)
+	}
+	if stats.PoolWaitTime < 10*time.Millisecond {
+		t.Errorf("unexpected pool wait time %v, expected the borrowers to wait for the slow commands", stats.PoolWaitTime)
+	}
+	// The waits are reported by the next sample of the pool stats.
+	deadline := time.Now().Add(time.Second)
+	for onPoolWait.Load() != stats.PoolWaits && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := onPoolWait.Load(); n != stats.PoolWaits {
+		t.Errorf("unexpected %v OnPoolWait calls, expected %v", n, stats.PoolWaits)
+	}
+}
@@ -0,0 +1,124 @@
+package httprateredis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store is the rate-limiting backend seam: LimitCounter plus Reset. It's
+// implemented by the Redis counter returned by NewCounter and by the in-memory
+// NewInMemoryCounter, so the middleware wiring can swap backends, e.g. to A/B
+// test them, without depending on Redis.
+type Store interface {
+	LimitCounter
+	Reset(ctx context.Context, key string) error
+}
+
+var (
+	_ Store = (*redisCounter)(nil)
+	_ Store = (*memoryStore)(nil)
+)
+
+// NewInMemoryCounter returns the in-memory reference Store, counting the
+// current and previous windows of each rate-limit key like the counter returned
+// by NewCounter, e.g. for the handler tests running without Redis. The counts
+// are local to the process. Counters older than two windows are dropped once
+// per window. It never returns an error, Close is a no-op.
+//
+// Of cfg, only WindowLength, until Config is called, and Disabled are used, the
+// Redis fields and the local fallback fields are ignored. A nil cfg is fine.
+func NewInMemoryCounter(cfg *Config) Store {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	windowLength := cfg.WindowLength
+	if windowLength <= 0 {
+		windowLength = time.Minute
+	}
+	return &memoryStore{
+		windowLength: windowLength,
+		disabled:     cfg.Disabled,
+		keys:         map[string]*lruEntry{},
+	}
+}
+
+// NewMemoryStore is NewInMemoryCounter(nil).
+//
+// Deprecated: Use NewInMemoryCounter.
+func NewMemoryStore() Store {
+	return NewInMemoryCounter(nil)
+}
+
+type memoryStore struct {
+	mu           sync.Mutex
+	windowLength time.Duration
+	disabled     bool // see Config.Disabled, nothing is counted
+	keys         map[string]*lruEntry
+	lastSweep    time.Time
+}
+
+func (s *memoryStore) Config(requestLimit int, windowLength time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windowLength = windowLength
+}
+
+func (s *memoryStore) Increment(key string, currentWindow time.Time) error {
+	return s.IncrementBy(key, currentWindow, 1)
+}
+
+func (s *memoryStore) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	if s.disabled {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(currentWindow)
+
+	entry, ok := s.keys[key]
+	if !ok {
+		entry = &lruEntry{key: key}
+		s.keys[key] = entry
+	}
+	entry.add(currentWindow, amount)
+	return nil
+}
+
+func (s *memoryStore) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.keys[key]
+	if !ok {
+		return 0, 0, nil
+	}
+	curr, prev := entry.counts(currentWindow, previousWindow)
+	return curr, prev, nil
+}
+
+// Reset deletes the counters of the given rate-limit key.
+func (s *memoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// sweep drops the keys without a count of the current or previous window, at
+// most once per window.
+func (s *memoryStore) sweep(currentWindow time.Time) {
+	if currentWindow.Sub(s.lastSweep) < s.windowLength {
+		return
+	}
+	s.lastSweep = currentWindow
+	for key, entry := range s.keys {
+		if currentWindow.Sub(entry.windows[0].window) > s.windowLength {
+			delete(s.keys, key)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package httprateredis_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/go-chi/httprate-redis/storetest"
+)
+
+func TestStore(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	t.Run("redis", func(t *testing.T) {
+		storetest.Run(t, storetest.Harness{
+			NewStore: func(t *testing.T) httprateredis.Store {
+				redis.FlushAll()
+				return httprateredis.NewCounter(&httprateredis.Config{
+					Host:             redis.Host(),
+					Port:             uint16(redisPort),
+					FallbackDisabled: true,
+				})
+			},
+			TTLs: func() map[string]time.Duration {
+				ttls := map[string]time.Duration{}
+				for _, key := range redis.Keys() {
+					ttls[key] = redis.TTL(key)
+				}
+				return ttls
+			},
+		})
+	})
+	t.Run("memory", func(t *testing.T) {
+		storetest.Run(t, storetest.Harness{
+			NewStore: func(t *testing.T) httprateredis.Store { return httprateredis.NewInMemoryCounter(nil) },
+		})
+	})
+	t.Run("upstash", func(t *testing.T) {
+		upstash := newFakeUpstash(t, "token")
+		storetest.Run(t, storetest.Harness{
+			NewStore: func(t *testing.T) httprateredis.Store {
+				upstash.redis.FlushAll()
+				return httprateredis.NewCounterWithUpstash(upstash.URL, "token", &httprateredis.Config{
+					FallbackDisabled: true,
+				})
+			},
+			TTLs: upstash.ttls,
+		})
+	})
+	t.Run("rueidis", func(t *testing.T) {
+		client := newRueidisClient(t, redis.Addr())
+		storetest.Run(t, storetest.Harness{
+			NewStore: func(t *testing.T) httprateredis.Store {
+				redis.FlushAll()
+				return httprateredis.NewCounterWithRueidis(client, &httprateredis.Config{
+					FallbackDisabled: true,
+				})
+			},
+			TTLs: func() map[string]time.Duration {
+				ttls := map[string]time.Duration{}
+				for _, key := range redis.Keys() {
+					ttls[key] = redis.TTL(key)
+				}
+				return ttls
+			},
+		})
+	})
+}
+
+// TestInMemoryCounter runs the same random operations against the Redis counter
+// and the in-memory counter over a few windows, expecting the same counts.
+func TestInMemoryCounter(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	const windowLength = 10 * time.Second
+	now := time.Now().UTC().Truncate(windowLength)
+	redisCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer redisCounter.Close()
+	redisCounter.Config(100, windowLength)
+
+	memoryCounter := httprateredis.NewInMemoryCounter(&httprateredis.Config{WindowLength: windowLength})
+	defer memoryCounter.Close()
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed %v", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	ctx := context.Background()
+	for step := 0; step < 500; step++ {
+		if rnd.Intn(50) == 0 {
+			advance := time.Duration(1+rnd.Intn(15)) * time.Second
+			now = now.Add(advance)
+			redis.FastForward(advance)
+		}
+		currentWindow := now.Truncate(windowLength)
+		previousWindow := currentWindow.Add(-windowLength)
+		key := fmt.Sprintf("key:%v", rnd.Intn(5))
+		op := rnd.Intn(20)
+
+		var counts [2][2]int
+		for i, counter := range []httprateredis.Store{redisCounter, memoryCounter} {
+			var err error
+			if op == 0 {
+				err = counter.Reset(ctx, key)
+			} else {
+				err = counter.IncrementBy(key, currentWindow, op)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts[i][0], counts[i][1], err = counter.Get(key, currentWindow, previousWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if counts[0] != counts[1] {
+			t.Fatalf("step %v: %q: unexpected in-memory curr, prev = %v, expected %v of Redis", step, key, counts[1], counts[0])
+		}
+	}
+}
+
+func TestInMemoryCounterOutOfOrder(t *testing.T) {
+	counter := httprateredis.NewInMemoryCounter(nil)
+	defer counter.Close()
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// An increment of the previous window lands after one of the current
+	// window, e.g. racing at the window boundary.
+	for _, inc := range []struct {
+		window time.Time
+		amount int
+	}{
+		{currentWindow, 5},
+		{previousWindow, 1},
+		{currentWindow, 1},
+	} {
+		if err := counter.IncrementBy("key", inc.window, inc.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if curr, prev, _ := counter.Get("key", currentWindow, previousWindow); curr != 6 || prev != 1 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 6, 1", curr, prev)
+	}
+}
@@ -0,0 +1,196 @@
+// Package storetest is the conformance test harness of the httprateredis.Store
+// implementations, so every backend is validated by the same scenarios and
+// properties of the sliding window counters.
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, storetest.Harness{
+//			NewStore: func(t *testing.T) httprateredis.Store { return newMyStore(t) },
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+// Harness describes the backend under test.
+type Harness struct {
+	// NewStore returns a new store with no counters, closed by Run.
+	NewStore func(t *testing.T) httprateredis.Store
+
+	// TTLs returns the TTLs of the backend keys, if it expires them, to check
+	// that no counter is left without a TTL. Nil skips the check.
+	TTLs func() map[string]time.Duration
+
+	// Seed of the randomized properties, 0 picks a random one, which is logged.
+	Seed int64
+}
+
+// windowLength is the window length of all tests, so the windows around now
+// are the same as the windows computed by the Redis counter, e.g. by Reset.
+const windowLength = time.Minute
+
+// Run runs the scenarios and the properties against the backend.
+func Run(t *testing.T, h Harness) {
+	t.Run("Scenarios", func(t *testing.T) { testScenarios(t, h) })
+	t.Run("Reset", func(t *testing.T) { testReset(t, h) })
+	t.Run("Properties", func(t *testing.T) { testProperties(t, h) })
+}
+
+func newStore(t *testing.T, h Harness) httprateredis.Store {
+	store := h.NewStore(t)
+	t.Cleanup(func() { store.Close() })
+	store.Config(1000, windowLength)
+	return store
+}
+
+// testScenarios runs the scenario table of the Redis counter tests: advancing
+// the windows, incrementing the counters and checking both windows.
+func testScenarios(t *testing.T, h Harness) {
+	store := newStore(t, h)
+
+	currentWindow := time.Now().UTC().Truncate(windowLength)
+	previousWindow := currentWindow.Add(-windowLength)
+
+	tests := []struct {
+		name        string        // In each test do the following:
+		advanceTime time.Duration // 1. advance time
+		incrBy      int           // 2. increase counter
+		prev        int           // 3. check previous window counter
+		curr        int           //    and current window counter
+	}{
+		{name: "t=0m: init"},
+		{name: "t=0m: increment by 1", incrBy: 1, curr: 1},
+		{name: "t=0m: increment by 99", incrBy: 99, curr: 100},
+		{name: "t=1m: move clock by 1m", advanceTime: time.Minute, prev: 100},
+		{name: "t=1m: increment by 20", incrBy: 20, prev: 100, curr: 20},
+		{name: "t=1m: increment by 20", incrBy: 20, prev: 100, curr: 40},
+		{name: "t=2m: move clock by 1m", advanceTime: time.Minute, prev: 40},
+		{name: "t=2m: incr++", incrBy: 1, prev: 40, curr: 1},
+		{name: "t=2m: incr+=9", incrBy: 9, prev: 40, curr: 10},
+		{name: "t=2m: incr+=20", incrBy: 20, prev: 40, curr: 30},
+		{name: "t=4m: move clock by 2m", advanceTime: 2 * time.Minute},
+	}
+
+	const keys = 10
+	for _, tt := range tests {
+		currentWindow = currentWindow.Add(tt.advanceTime)
+		previousWindow = previousWindow.Add(tt.advanceTime)
+
+		for i := 0; i < keys; i++ {
+			key := fmt.Sprintf("key:%v", i)
+			if tt.incrBy > 0 {
+				if err := store.IncrementBy(key, currentWindow, tt.incrBy); err != nil {
+					t.Fatalf("%s: %q: %v", tt.name, key, err)
+				}
+			}
+			curr, prev, err := store.Get(key, currentWindow, previousWindow)
+			if err != nil {
+				t.Fatalf("%s: %q: %v", tt.name, key, err)
+			}
+			if curr != tt.curr || prev != tt.prev {
+				t.Errorf("%s: %q: unexpected curr = %v, prev = %v, expected %v, %v", tt.name, key, curr, prev, tt.curr, tt.prev)
+			}
+		}
+	}
+	checkTTLs(t, h)
+}
+
+// testReset checks that Reset deletes the counters of the key only.
+func testReset(t *testing.T, h Harness) {
+	store := newStore(t, h)
+
+	currentWindow := time.Now().UTC().Truncate(windowLength)
+	previousWindow := currentWindow.Add(-windowLength)
+
+	for _, key := range []string{"key:reset", "key:other"} {
+		if err := store.IncrementBy(key, previousWindow, 5); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.IncrementBy(key, currentWindow, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Reset(context.Background(), "key:reset"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string][2]int{"key:reset": {0, 0}, "key:other": {3, 5}} {
+		curr, prev, err := store.Get(key, currentWindow, previousWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curr != expected[0] || prev != expected[1] {
+			t.Errorf("%q: unexpected curr = %v, prev = %v, expected %v, %v", key, curr, prev, expected[0], expected[1])
+		}
+	}
+}
+
+// testProperties runs random increments of random keys over a few windows,
+// checking that curr is the sum of the increments within a window, so it only
+// grows, and that it becomes prev after advancing one window.
+func testProperties(t *testing.T, h Harness) {
+	seed := h.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("seed %v", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	store := newStore(t, h)
+
+	currentWindow := time.Now().UTC().Truncate(windowLength)
+	keys := make([]string, 5)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key:prop:%v", i)
+	}
+	last := map[string]int{}
+
+	for window := 0; window < 4; window++ {
+		previousWindow := currentWindow.Add(-windowLength)
+		curr := map[string]int{}
+
+		for i := 0; i < 50; i++ {
+			key := keys[rnd.Intn(len(keys))]
+			amount := 1 + rnd.Intn(10)
+			if err := store.IncrementBy(key, currentWindow, amount); err != nil {
+				t.Fatal(err)
+			}
+			curr[key] += amount
+
+			got, prev, err := store.Get(key, currentWindow, previousWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != curr[key] {
+				t.Fatalf("window %v: %q: unexpected curr = %v, expected the sum of the increments %v", window, key, got, curr[key])
+			}
+			if prev != last[key] {
+				t.Fatalf("window %v: %q: unexpected prev = %v, expected the last window count %v", window, key, prev, last[key])
+			}
+		}
+
+		last = curr
+		currentWindow = currentWindow.Add(windowLength)
+	}
+	checkTTLs(t, h)
+}
+
+// checkTTLs checks that every backend key expires.
+func checkTTLs(t *testing.T, h Harness) {
+	t.Helper()
+	if h.TTLs == nil {
+		return
+	}
+	for key, ttl := range h.TTLs() {
+		if ttl <= 0 {
+			t.Errorf("key %q: unexpected TTL %v, expected every counter to expire", key, ttl)
+		}
+	}
+}
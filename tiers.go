@@ -0,0 +1,291 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// allowTiersScript is allowScript for several tiers at once: KEYS are the
+// current and previous window counters of each tier, ARGV[1] is the increment
+// and ARGV[3i-1..3i+1] the limit, previous count weight and TTL of the i-th
+// tier. The counters of all tiers are incremented only if the rates of all
+// stay within their limits, atomically. It returns whether they were
+// incremented, the 1-based index of the exceeded tier (0 if none) and the
+// rates of the tiers checked, including the increment if incremented.
+var allowTiersScript = newScript("allow_tiers", `
+local n = tonumber(ARGV[1])
+local res = {1, 0}
+for i = 1, #KEYS / 2 do
+	local curr = tonumber(redis.call('GET', KEYS[2*i-1])) or 0
+	local prev = tonumber(redis.call('GET', KEYS[2*i])) or 0
+	local rate = math.floor(prev * tonumber(ARGV[3*i]) + curr + 0.5)
+	if rate + n > tonumber(ARGV[3*i-1]) then
+		return {0, i, rate}
+	end
+	res[i+2] = rate + n
+end
+for i = 1, #KEYS / 2 do
+	local count = redis.call('INCRBY', KEYS[2*i-1], n)
+	if count == n or redis.call('PTTL', KEYS[2*i-1]) < 0 then
+		redis.call('PEXPIRE', KEYS[2*i-1], ARGV[3*i+1])
+	end
+end
+return res
+`)
+
+var errTiersMode = errors.New("httprateredis: tiers are supported in ModeSlidingWindow without WindowBuckets only")
+
+// plainSlidingWindow reports whether the counters are the current and previous
+// window counters of ModeSlidingWindow without WindowBuckets, which the tiers
+// and GetMany read and increment directly.
+func (c *redisCounter) plainSlidingWindow() bool {
+	return (c.mode == "" || c.mode == ModeSlidingWindow) && c.windowBuckets <= 2
+}
+
+// Tier is one of the limits enforced at once by Allow, see AddTier.
+type Tier struct {
+	Limit  int
+	Window time.Duration
+}
+
+// tier is a Tier and its local in-memory fallback counter, as the shared one
+// counts the windows of Config only.
+type tier struct {
+	Tier
+	fallback Store
+}
+
+// AddTier adds a limit of limit requests per window, e.g. 10/s, 100/min and
+// 1000/hour, which Allow, AllowN, AllowTiers and Limit enforce all at once,
+// instead of the limit set up by Config and LimitFunc. A request is allowed
+// only if it's within all the tiers, and it's counted by all of them then. The
+// tiers are checked and incremented by a single Lua script, i.e. one round-trip.
+//
+// The tiers have their own counters, which the httprate middleware (calling
+// IncrementBy and Get) doesn't use. They're supported in ModeSlidingWindow
+// without WindowBuckets only. It's safe to call AddTier concurrently with the
+// other methods. A limit or window which is not positive returns an error
+// wrapping ErrInvalidConfig, and the tier is not added.
+func (c *redisCounter) AddTier(limit int, window time.Duration) error {
+	if limit <= 0 || window <= 0 {
+		return fmt.Errorf("%w: tier of %d requests per %v, expected positive limit and window", ErrInvalidConfig, limit, window)
+	}
+	t := &tier{Tier: Tier{Limit: limit, Window: window}}
+	if c.fallbackCounter != nil {
+		t.fallback = NewInMemoryCounter(nil)
+		t.fallback.Config(limit, window)
+	}
+	for {
+		old := c.tiers.Load()
+		var tiers []*tier
+		if old != nil {
+			tiers = append(tiers, *old...)
+		}
+		tiers = append(tiers, t)
+		if c.tiers.CompareAndSwap(old, &tiers) {
+			return nil
+		}
+	}
+}
+
+// Tiers returns the tiers added by AddTier.
+func (c *redisCounter) Tiers() []Tier {
+	var tiers []Tier
+	for _, t := range c.loadTiers() {
+		tiers = append(tiers, t.Tier)
+	}
+	return tiers
+}
+
+func (c *redisCounter) loadTiers() []*tier {
+	if tiers := c.tiers.Load(); tiers != nil {
+		return *tiers
+	}
+	return nil
+}
+
+// AllowTiers is like AllowN with tiers, also returning the tier which the
+// request exceeded, or the zero Tier if allowed. With no tiers added, it fails
+// like AllowN without a limit configured.
+func (c *redisCounter) AllowTiers(ctx context.Context, key string, n int) (allowed bool, exceeded Tier, err error) {
+	tiers := c.loadTiers()
+	if len(tiers) == 0 {
+		return false, Tier{}, errNotConfigured
+	}
+	if !c.plainSlidingWindow() {
+		return false, Tier{}, errTiersMode
+	}
+
+	allowed, reported, _, err := c.decideTiers(ctx, key, n, tiers)
+	if err != nil {
+		return false, Tier{}, err
+	}
+	if !allowed {
+		exceeded = reported.Tier
+	}
+	return allowed, exceeded, nil
+}
+
+// decideTiers makes the decision of AllowTiers, also returning the tier which
+// the request exceeded, or the one with the least headroom if allowed, and its
+// rate (including n if allowed).
+func (c *redisCounter) decideTiers(ctx context.Context, key string, n int, tiers []*tier) (allowed bool, reported *tier, used int, err error) {
+	allowed, tierIndex, rates, err := c.allowTiers(ctx, key, n, tiers)
+	if err != nil {
+		return false, nil, 0, err
+	}
+
+	i := tierIndex
+	if allowed {
+		for j := range rates {
+			if tiers[j].Limit-rates[j] < tiers[i].Limit-rates[i] {
+				i = j
+			}
+		}
+	}
+	c.onDecision(key, allowed, rates[i], tiers[i].Limit)
+	return allowed, tiers[i], rates[i], nil
+}
+
+// allowTiers makes the decision of AllowTiers, returning the index of the
+// exceeded tier (0 if allowed) and the rates of the tiers checked.
+func (c *redisCounter) allowTiers(ctx context.Context, key string, n int, tiers []*tier) (allowed bool, tierIndex int, used []int, err error) {
+	c.stats.increments.Add(1)
+	if !c.begin() {
+		return false, 0, nil, errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return true, 0, make([]int, len(tiers)), nil
+	}
+
+	now := c.now().UTC()
+	currentWindow := now.Truncate(tiers[0].Window)
+
+	var fallback bool
+	ctx, span := c.startSpan(ctx, spanIncrement, currentWindow)
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.allowTiersFallback(key, n, tiers, now)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				allowed, tierIndex, used, err = c.allowTiersFallback(key, n, tiers, now)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				allowed, tierIndex, used, err = true, 0, make([]int, len(tiers)), nil
+			}
+		}()
+	}
+
+	keys := make([]string, 0, 2*len(tiers))
+	args := make([]any, 0, 1+3*len(tiers))
+	args = append(args, n)
+	for _, t := range tiers {
+		currentWindow := now.Truncate(t.Window)
+		weight := float64(t.Window-now.Sub(currentWindow)) / float64(t.Window)
+		keys = append(keys, c.tierCounterKey(key, currentWindow, t.Window), c.tierCounterKey(key, currentWindow.Add(-t.Window), t.Window))
+		args = append(args, t.Limit, strconv.FormatFloat(weight, 'f', -1, 64), c.ttl(t.Window).Milliseconds())
+	}
+
+	var res []interface{}
+	err = c.withRetry(ctx, false, func() (err error) {
+		res, err = c.runScriptOn(ctx, c.clientFor(key), allowTiersScript, keys, args...).Slice()
+		return err
+	})
+	if err != nil {
+		return false, 0, nil, c.commandError(ctx, "redis allow failed", err)
+	}
+
+	ok, _ := res[0].(int64)
+	if ok != 1 {
+		i, _ := res[1].(int64)
+		rate, _ := res[2].(int64)
+		used = make([]int, i)
+		used[i-1] = int(rate)
+		return false, int(i) - 1, used, nil
+	}
+	used = make([]int, len(tiers))
+	for i := range used {
+		rate, _ := res[i+2].(int64)
+		used[i] = int(rate)
+	}
+	return true, 0, used, nil
+}
+
+// allowTiersFallback makes the decision of AllowTiers by the local in-memory
+// fallback counters of the tiers.
+func (c *redisCounter) allowTiersFallback(key string, n int, tiers []*tier, now time.Time) (bool, int, []int, error) {
+	used := make([]int, len(tiers))
+	for i, t := range tiers {
+		currentWindow := now.Truncate(t.Window)
+		curr, prev, err := t.fallback.Get(key, currentWindow, currentWindow.Add(-t.Window))
+		if err != nil {
+			return false, 0, nil, err
+		}
+		used[i] = RateInt(prev, curr, currentWindow, now, t.Window)
+		if used[i]+n > t.Limit {
+			return false, i, used[:i+1], nil
+		}
+	}
+	for i, t := range tiers {
+		if err := t.fallback.IncrementBy(key, now.Truncate(t.Window), n); err != nil {
+			return false, 0, nil, err
+		}
+		used[i] += n
+	}
+	return true, 0, used, nil
+}
+
+// tierRetryAfter is RetryAfter of the given tier of the rate-limit key, by the
+// tier counters, or by its local in-memory fallback counter while the fallback
+// is activated.
+func (c *redisCounter) tierRetryAfter(ctx context.Context, key string, t *tier) (time.Duration, error) {
+	now := c.now().UTC()
+	currentWindow := now.Truncate(t.Window)
+	previousWindow := currentWindow.Add(-t.Window)
+
+	var curr, prev int
+	if c.fallbackCounter != nil && c.breaker.isOpen() {
+		var err error
+		if curr, prev, err = t.fallback.Get(key, currentWindow, previousWindow); err != nil {
+			return 0, err
+		}
+	} else {
+		err := c.readKey(ctx, key, func(client redis.Cmdable) error {
+			values, err := client.MGet(ctx, c.tierCounterKey(key, currentWindow, t.Window), c.tierCounterKey(key, previousWindow, t.Window)).Result()
+			if err != nil {
+				return err
+			}
+			curr, prev = parseCount(values[0]), parseCount(values[1])
+			return nil
+		})
+		if err != nil {
+			return 0, c.wrapError(ctx, "redis mget failed", err)
+		}
+	}
+	return retryAfter(curr, prev, t.Limit, currentWindow, now, t.Window), nil
+}
+
+// tierCounterKey returns the Redis key of the tier window counter, which is the
+// window counter key suffixed by the tier window length in milliseconds, as the
+// windows of the tiers (e.g. the minute and the hour) may start at the same
+// time. The suffix keeps the hash tag, so the keys of all the tiers of the same
+// rate-limit key hash to the same Redis Cluster slot.
+func (c *redisCounter) tierCounterKey(key string, window time.Time, windowLength time.Duration) string {
+	return c.limitCounterKey(key, window) + ":" + strconv.FormatInt(windowLength.Milliseconds(), 10)
+}
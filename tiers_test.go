@@ -0,0 +1,158 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestTiers(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var scripts atomic.Int32
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if cmd == "EVALSHA" {
+			scripts.Add(1)
+		}
+		return false
+	})
+
+	now := time.Now().UTC().Truncate(time.Hour).Add(30 * time.Minute)
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithClock(func() time.Time { return now }),
+	)
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	if _, _, err := limitCounter.AllowTiers(ctx, "key:tiers", 1); err == nil {
+		t.Error("expected error when no tier is added")
+	}
+	for _, tier := range []httprateredis.Tier{{Limit: 0, Window: time.Second}, {Limit: 10, Window: 0}, {Limit: 10, Window: -time.Second}} {
+		if err := limitCounter.AddTier(tier.Limit, tier.Window); !errors.Is(err, httprateredis.ErrInvalidConfig) {
+			t.Errorf("AddTier(%v, %v): unexpected error %v, expected %v", tier.Limit, tier.Window, err, httprateredis.ErrInvalidConfig)
+		}
+	}
+	if tiers := limitCounter.Tiers(); len(tiers) != 0 {
+		t.Errorf("unexpected tiers %v, expected the invalid ones not to be added", tiers)
+	}
+	limitCounter.AddTier(10, time.Second)
+	limitCounter.AddTier(100, time.Minute)
+	limitCounter.AddTier(1000, time.Hour)
+
+	// The burst trips the per-second tier, with one round-trip per request.
+	for i := 0; i < 10; i++ {
+		allowed, exceeded, err := limitCounter.AllowTiers(ctx, "key:tiers", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed || exceeded != (httprateredis.Tier{}) {
+			t.Fatalf("request %v: unexpected allowed = %v, exceeded %+v, expected allowed", i+1, allowed, exceeded)
+		}
+		if i == 0 {
+			scripts.Store(0) // the script is loaded by the first request
+		}
+	}
+	if n := scripts.Load(); n != 9 {
+		t.Errorf("unexpected %v scripts run, expected 9", n)
+	}
+	allowed, exceeded, err := limitCounter.AllowTiers(ctx, "key:tiers", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (httprateredis.Tier{Limit: 10, Window: time.Second}); allowed || exceeded != expected {
+		t.Errorf("unexpected allowed = %v, exceeded %+v, expected the %+v tier exceeded", allowed, exceeded, expected)
+	}
+	if allowed, _ := limitCounter.Allow(ctx, "key:tiers"); allowed {
+		t.Error("Allow() should check the tiers")
+	}
+
+	// The blocked requests are not counted by any tier, so the per-hour tier
+	// (and the per-minute one) is fine once the per-second window slides by.
+	now = now.Add(2 * time.Second)
+	for i := 0; i < 10; i++ {
+		if allowed, _ := limitCounter.Allow(ctx, "key:tiers"); !allowed {
+			t.Fatalf("request %v: should be allowed in the next second", i+1)
+		}
+	}
+
+	// The per-minute tier trips on more bursts within the minute.
+	for i := 0; i < 8; i++ {
+		now = now.Add(2 * time.Second)
+		for j := 0; j < 10; j++ {
+			if _, _, err := limitCounter.AllowTiers(ctx, "key:tiers", 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	now = now.Add(2 * time.Second)
+	allowed, exceeded, err = limitCounter.AllowTiers(ctx, "key:tiers", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (httprateredis.Tier{Limit: 100, Window: time.Minute}); allowed || exceeded != expected {
+		t.Errorf("unexpected allowed = %v, exceeded %+v, expected the %+v tier exceeded", allowed, exceeded, expected)
+	}
+
+	// The windows of the tiers start at the same time without sharing keys.
+	for _, key := range redis.Keys() {
+		if ttl := redis.TTL(key); ttl <= 0 {
+			t.Errorf("key %q: unexpected TTL %v", key, ttl)
+		}
+	}
+	if keys := len(redis.Keys()); keys < 3 {
+		t.Errorf("unexpected %v Redis keys, expected the counters of each tier", keys)
+	}
+}
+
+func TestTiersFallback(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  time.Minute,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.AddTier(10, time.Hour)
+	limitCounter.AddTier(1000, 24*time.Hour)
+
+	redis.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if allowed, err := limitCounter.Allow(ctx, "key:tiers"); err != nil || !allowed {
+			t.Fatalf("request %v: unexpected allowed = %v, err %v", i+1, allowed, err)
+		}
+	}
+	allowed, exceeded, err := limitCounter.AllowTiers(ctx, "key:tiers", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (httprateredis.Tier{Limit: 10, Window: time.Hour}); allowed || exceeded != expected {
+		t.Errorf("unexpected allowed = %v, exceeded %+v, expected the %+v tier exceeded", allowed, exceeded, expected)
+	}
+	if !limitCounter.IsFallbackActivated() {
+		t.Error("fallback should be activated")
+	}
+}
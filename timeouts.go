@@ -0,0 +1,39 @@
+package httprateredis
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// commandTimeoutHook bounds each command and pipeline by Config.CommandTimeout.
+// go-redis honors the context deadlines, as ContextTimeoutEnabled is set on the
+// clients created by NewCounter. It's added before the other hooks, so the time
+// waiting for a free connection counts too.
+type commandTimeoutHook time.Duration
+
+var _ redis.Hook = commandTimeoutHook(0)
+
+func (h commandTimeoutHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h commandTimeoutHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(h))
+		defer cancel()
+		return next(ctx, cmd)
+	}
+}
+
+func (h commandTimeoutHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(h))
+		defer cancel()
+		return next(ctx, cmds)
+	}
+}
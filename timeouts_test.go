@@ -0,0 +1,224 @@
+package httprateredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestReadTimeout(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:             host,
+		Port:             port,
+		FallbackTimeout:  5 * time.Second,
+		ReadTimeout:      100 * time.Millisecond,
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+	start := time.Now()
+	if err := limitCounter.IncrementBy("key:timeout", currentWindow, 1); err == nil {
+		t.Error("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("IncrementBy() returned after %v, expected the read timeout to fire", elapsed)
+	}
+}
+
+func TestReadTimeoutFallback(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            host,
+		Port:            port,
+		FallbackTimeout: 5 * time.Second,
+		ReadTimeout:     100 * time.Millisecond,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	start := time.Now()
+	if err := limitCounter.IncrementBy("key:timeout", currentWindow, 1); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("IncrementBy() returned after %v, expected the read timeout to fire", elapsed)
+	}
+	if !limitCounter.IsFallbackActivated() {
+		t.Error("fallback should be activated after a read timeout")
+	}
+
+	curr, _, err := limitCounter.Get("key:timeout", currentWindow, previousWindow)
+	if err != nil {
+		t.Error(err)
+	}
+	if curr != 1 {
+		t.Errorf("unexpected curr = %v, expected 1", curr)
+	}
+}
+
+func TestPoolWaitDisabled(t *testing.T) {
+	host, port := newBlackhole(t)
+
+	for _, poolWaitDisabled := range []bool{false, true} {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             host,
+			Port:             port,
+			MaxActive:        1,
+			ReadTimeout:      500 * time.Millisecond,
+			PoolWaitDisabled: poolWaitDisabled,
+			CooldownPeriod:   time.Minute,
+		})
+		limitCounter.Config(1000, time.Minute)
+
+		currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+		// The first borrower holds the only connection until the read timeout.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = limitCounter.IncrementBy("key:pool", currentWindow, 1)
+		}()
+		for limitCounter.PoolStats().ActiveConns != 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		start := time.Now()
+		if err := limitCounter.IncrementBy("key:pool", currentWindow, 1); err != nil {
+			t.Error(err)
+		}
+		elapsed := time.Since(start)
+		if poolWaitDisabled && elapsed > 100*time.Millisecond {
+			t.Errorf("IncrementBy() returned after %v, expected an immediate failover", elapsed)
+		}
+		if !poolWaitDisabled && elapsed < 300*time.Millisecond {
+			t.Errorf("IncrementBy() returned after %v, expected to wait for the connection", elapsed)
+		}
+		if !limitCounter.IsFallbackActivated() {
+			t.Error("fallback should be activated")
+		}
+
+		<-done
+		limitCounter.Close()
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	// Redis is up, but the increments are slow.
+	redis.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if cmd == "EVALSHA" || cmd == "EVAL" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return false
+	})
+
+	for _, fallbackDisabled := range []bool{true, false} {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(redisPort),
+			FallbackTimeout:  5 * time.Second,
+			CommandTimeout:   50 * time.Millisecond,
+			FallbackDisabled: fallbackDisabled,
+			CooldownPeriod:   time.Minute,
+		})
+		limitCounter.Config(1000, time.Minute)
+
+		currentWindow := time.Now().UTC().Truncate(time.Minute)
+
+		start := time.Now()
+		err := limitCounter.IncrementBy("key:timeout", currentWindow, 1)
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("fallback disabled %v: IncrementBy() returned after %v, expected to abort at the command timeout", fallbackDisabled, elapsed)
+		}
+		if fallbackDisabled {
+			if !errors.Is(err, httprateredis.ErrRedisUnavailable) {
+				t.Errorf("unexpected error %v, expected %v", err, httprateredis.ErrRedisUnavailable)
+			}
+		} else {
+			if err != nil {
+				t.Error(err)
+			}
+			if !limitCounter.IsFallbackActivated() {
+				t.Error("fallback should be activated after a command timeout")
+			}
+		}
+
+		// A shorter context deadline still wins.
+		if fallbackDisabled {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+			start = time.Now()
+			err = limitCounter.IncrementByCtx(ctx, "key:timeout", currentWindow, 1)
+			elapsed := time.Since(start)
+			cancel()
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("unexpected error %v, expected %v", err, context.DeadlineExceeded)
+			}
+			if elapsed > 40*time.Millisecond {
+				t.Errorf("IncrementByCtx() returned after %v, expected to abort at the context deadline", elapsed)
+			}
+		}
+		limitCounter.Close()
+	}
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	for _, lifetime := range []time.Duration{0, 50 * time.Millisecond} {
+		limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+			Host:             redis.Host(),
+			Port:             uint16(redisPort),
+			MaxConnLifetime:  lifetime,
+			FallbackDisabled: true,
+		})
+		limitCounter.Config(1000, time.Minute)
+
+		currentWindow := time.Now().UTC().Truncate(time.Minute)
+		connections := redis.TotalConnectionCount()
+		for i := 0; i < 3; i++ {
+			if err := limitCounter.IncrementBy("key:lifetime", currentWindow, 1); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		// Each increment borrows the connection of the previous one, unless it
+		// outlived MaxConnLifetime.
+		expected := 1
+		if lifetime > 0 {
+			expected = 3
+		}
+		if n := redis.TotalConnectionCount() - connections; n != expected {
+			t.Errorf("MaxConnLifetime %v: unexpected %v connections, expected %v", lifetime, n, expected)
+		}
+		limitCounter.Close()
+	}
+}
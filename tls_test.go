@@ -0,0 +1,214 @@
+package httprateredis_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+
+	redis := miniredis.NewMiniRedis()
+	if err := redis.StartTLS(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	// Empty ServerName must be filled in from Host, otherwise the
+	// certificate verification fails.
+	limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		TLSConfig:        &tls.Config{RootCAs: ca.pool},
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:tls", currentWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, err := limitCounter.Get("key:tls", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 {
+		t.Errorf("unexpected curr = %v, expected 3", curr)
+	}
+
+	// Plain-text connection to a TLS server must fail.
+	_, err = httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Host:             redis.Host(),
+		Port:             uint16(redisPort),
+		FallbackTimeout:  200 * time.Millisecond,
+		FallbackDisabled: true,
+	})
+	if err == nil {
+		t.Error("expected error when connecting without TLS")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+
+	redis := miniredis.NewMiniRedis()
+	if err := redis.StartTLS(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Host: redis.Host(),
+		Port: uint16(redisPort),
+		TLSConfig: &tls.Config{
+			RootCAs:      ca.pool,
+			Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageClientAuth)},
+		},
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+	if err := limitCounter.Increment("key:mtls", time.Now().UTC().Truncate(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	otherCA := newTestCA(t)
+
+	tests := []struct {
+		name  string
+		certs []tls.Certificate
+	}{
+		{name: "no client certificate"},
+		{name: "client certificate signed by unknown CA", certs: []tls.Certificate{otherCA.issue(t, x509.ExtKeyUsageClientAuth)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+				Host:             redis.Host(),
+				Port:             uint16(redisPort),
+				TLSConfig:        &tls.Config{RootCAs: ca.pool, Certificates: tt.certs},
+				FallbackTimeout:  time.Second,
+				FallbackDisabled: true,
+			})
+			if err == nil {
+				t.Fatal("expected handshake error")
+			}
+
+			// At runtime, the handshake error is reported and the fallback kicks in.
+			var onErrorCalled bool
+			limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+				Host:            redis.Host(),
+				Port:            uint16(redisPort),
+				TLSConfig:       &tls.Config{RootCAs: ca.pool, Certificates: tt.certs},
+				FallbackTimeout: time.Second,
+				OnError:         func(err error) { onErrorCalled = true },
+			})
+			defer limitCounter.Close()
+
+			limitCounter.Config(1000, time.Minute)
+			if err := limitCounter.Increment("key:mtls", time.Now().UTC().Truncate(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if !onErrorCalled {
+				t.Error("onError() should be called on handshake failure")
+			}
+			if !limitCounter.IsFallbackActivated() {
+				t.Error("fallback should be activated on handshake failure")
+			}
+		})
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "httprateredis test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for 127.0.0.1/localhost signed by the CA.
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,141 @@
+package httprateredis
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ModeTokenBucket limits by a token bucket per rate-limit key, holding up to
+// Burst tokens and refilling them continuously at RefillRate. Unlike the
+// windows, it lets short bursts through while enforcing the refill rate.
+const ModeTokenBucket Mode = "token_bucket"
+
+// takeScript refills the bucket by the time elapsed since the last refill
+// and takes ARGV[4] tokens, if there are enough of them. With ARGV[5] set,
+// the tokens are taken anyway, e.g. for requests already let through. It
+// returns whether the tokens were taken and in how many milliseconds
+// enough tokens will be refilled otherwise.
+var takeScript = newScript("take", `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last_refill')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) * rate)
+	last = now
+end
+local allowed = 0
+local retry = 0
+if tokens >= n or ARGV[5] == '1' then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last_refill', last)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+return {allowed, retry}
+`)
+
+// Take takes n tokens from the token bucket of the given rate-limit key and
+// reports whether there were enough of them. If not, no tokens are taken and
+// retryAfter is the time until enough tokens are refilled. Requests for more
+// than Burst tokens are never allowed. The bucket is refilled by the counter
+// clock, so the clocks of the app servers sharing Redis should be in sync.
+//
+// Take works in any Mode. It's not served by the local in-memory fallback,
+// Redis errors are returned (or with OnErrorAllow, the tokens are allowed).
+func (c *redisCounter) Take(ctx context.Context, key string, n int) (allowed bool, retryAfter time.Duration, err error) {
+	if !c.begin() {
+		return false, 0, errRefused
+	}
+	defer c.end()
+	if c.disabled.Load() {
+		return true, 0, nil
+	}
+	allowed, retryAfter, err = c.take(ctx, key, n, false)
+	if err != nil && c.onErrorAllow {
+		c.onError(err)
+		return true, 0, nil
+	}
+	return allowed, retryAfter, err
+}
+
+func (c *redisCounter) take(ctx context.Context, key string, n int, force bool) (bool, time.Duration, error) {
+	refillRate, burst, err := c.bucket(key)
+	if err != nil {
+		return false, 0, err
+	}
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+
+	var res []interface{}
+	err = c.withRetry(ctx, false, func() (err error) {
+		res, err = c.runScriptOn(ctx, c.clientFor(key), takeScript, []string{c.stateKey(key, "bucket")},
+			refillRate/1000, burst, c.now().UnixMilli(), n, forceArg).Slice()
+		return err
+	})
+	if err != nil {
+		return false, 0, c.commandError(ctx, "redis take failed", err)
+	}
+	allowed, _ := res[0].(int64)
+	retryAfter, _ := res[1].(int64)
+	return allowed == 1, time.Duration(retryAfter) * time.Millisecond, nil
+}
+
+// getBucket returns the number of tokens missing in the bucket as the current
+// window count, and zero previous window count, so httprate's weighted rate
+// equals the used tokens.
+func (c *redisCounter) getBucket(ctx context.Context, key string) (curr int, prev int, err error) {
+	refillRate, burst, err := c.bucket(key)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var values []interface{}
+	err = c.withRetry(ctx, true, func() (err error) {
+		values, err = c.clientFor(key).HMGet(ctx, c.stateKey(key, "bucket"), "tokens", "last_refill").Result()
+		return err
+	})
+	if err != nil {
+		return 0, 0, c.commandError(ctx, "redis hmget failed", err)
+	}
+
+	v, ok := values[0].(string)
+	if !ok {
+		return 0, 0, nil // Full bucket.
+	}
+	tokens, _ := strconv.ParseFloat(v, 64)
+	if v, ok := values[1].(string); ok {
+		last, _ := strconv.ParseInt(v, 10, 64)
+		if elapsed := c.now().UnixMilli() - last; elapsed > 0 {
+			tokens = math.Min(float64(burst), tokens+float64(elapsed)*refillRate/1000)
+		}
+	}
+	return int(math.Ceil(float64(burst) - tokens)), 0, nil
+}
+
+// bucket returns the refill rate (tokens per second) and burst of the given
+// rate-limit key. By default, the bucket holds the request limit and refills
+// it within the window length.
+func (c *redisCounter) bucket(key string) (refillRate float64, burst int, err error) {
+	requestLimit, windowLength := c.limits(key)
+	refillRate, burst = c.refillRate, c.burst
+	if burst <= 0 {
+		burst = requestLimit
+	}
+	if refillRate <= 0 && windowLength > 0 {
+		refillRate = float64(requestLimit) / windowLength.Seconds()
+	}
+	if burst <= 0 || refillRate <= 0 {
+		return 0, 0, errNotConfigured
+	}
+	return refillRate, burst, nil
+}
@@ -0,0 +1,128 @@
+package httprateredis_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestTake(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithTokenBucket(2, 5), // 2 tokens per second, burst of 5.
+		httprateredis.WithClock(func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}),
+	)
+	defer limitCounter.Close()
+
+	ctx := context.Background()
+	take := func(n int, allowed bool, retryAfter time.Duration) {
+		t.Helper()
+		ok, after, err := limitCounter.Take(ctx, "key:bucket", n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != allowed || after != retryAfter {
+			t.Errorf("unexpected Take(%v) = %v, %v, expected %v, %v", n, ok, after, allowed, retryAfter)
+		}
+	}
+
+	// Burst exhaustion.
+	take(3, true, 0)
+	take(2, true, 0)
+	take(1, false, 500*time.Millisecond)
+	take(6, false, 3*time.Second) // More than the burst, never allowed.
+
+	// Refill over time.
+	advance(250 * time.Millisecond)
+	take(1, false, 250*time.Millisecond)
+	advance(750 * time.Millisecond)
+	take(2, true, 0)
+	take(1, false, 500*time.Millisecond)
+
+	// The bucket never holds more than the burst.
+	advance(time.Hour)
+	take(5, true, 0)
+	take(1, false, 500*time.Millisecond)
+
+	// Concurrent takes must not double-spend.
+	advance(time.Hour)
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := limitCounter.Take(ctx, "key:concurrent", 1)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed.Load() != 5 {
+		t.Errorf("unexpected number of allowed takes %v, expected 5", allowed.Load())
+	}
+}
+
+func TestTokenBucketMode(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	limitCounter := httprateredis.NewCounterWithOptions(
+		httprateredis.WithHost(redis.Host()),
+		httprateredis.WithPort(uint16(redisPort)),
+		httprateredis.WithFallbackDisabled(),
+		httprateredis.WithMode(httprateredis.ModeTokenBucket),
+	)
+	defer limitCounter.Close()
+
+	// The bucket holds the limit of 3 and refills it within an hour.
+	h := httprate.Limit(3, time.Hour, httprate.WithLimitCounter(limitCounter))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	for i, status := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != status {
+			t.Errorf("request %d: unexpected status %v, expected %v", i, rec.Code, status)
+		}
+	}
+}
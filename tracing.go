@@ -0,0 +1,83 @@
+package httprateredis
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer creates spans around the counter operations. It's a small subset of
+// the OpenTelemetry trace.Tracer API, so that users who don't trace aren't
+// forced to depend on OpenTelemetry. An adapter looks like:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...httprateredis.Attribute) (context.Context, httprateredis.Span) {
+//		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+//			return ctx, nil // No active span, don't start a new trace.
+//		}
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(otelAttrs(attrs)...))
+//		return ctx, otelSpan{span}
+//	}
+//
+// Start may return a nil Span to skip tracing of the operation.
+type Tracer interface {
+	Start(ctx context.Context, spanName string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a span attribute. Value is a string, int64 or bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+const (
+	spanIncrement = "httprate-redis.increment"
+	spanGet       = "httprate-redis.get"
+)
+
+func (c *redisCounter) startSpan(ctx context.Context, spanName string, currentWindow time.Time) (context.Context, Span) {
+	return startSpan(ctx, c.tracer, spanName, c.prefixKey, currentWindow, c.limitConfig.Load())
+}
+
+// startSpan starts the span of an operation of a counter with the prefix and
+// limits, if the counter has a tracer.
+func startSpan(ctx context.Context, tracer Tracer, spanName, prefixKey string, currentWindow time.Time, limits *limitConfig) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	var windowLength time.Duration
+	if limits != nil {
+		windowLength = limits.windowLength
+	}
+	return tracer.Start(ctx, spanName,
+		Attribute{Key: "httprate_redis.key_prefix", Value: prefixKey},
+		Attribute{Key: "httprate_redis.window", Value: currentWindow.Unix()},
+		Attribute{Key: "httprate_redis.window_length", Value: windowLength.String()},
+	)
+}
+
+// recordError records the Redis error, which is not returned to the caller
+// when the request is served by the fallback.
+func recordError(span Span, err error) {
+	if span != nil {
+		span.RecordError(err)
+	}
+}
+
+func endSpan(span Span, fallback bool, err error) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(Attribute{Key: "httprate_redis.fallback", Value: fallback})
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,130 @@
+package httprateredis_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestTracer(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	tracer := &testTracer{}
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{
+		Host:            redis.Host(),
+		Port:            uint16(redisPort),
+		PrefixKey:       "tracing",
+		FallbackTimeout: 200 * time.Millisecond,
+		CooldownPeriod:  time.Minute,
+		Tracer:          tracer,
+	})
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	ctx := context.Background()
+	if err := limitCounter.IncrementByCtx(ctx, "key:tracing", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := limitCounter.GetCtx(ctx, "key:tracing", currentWindow, previousWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	redis.Close()
+
+	if err := limitCounter.IncrementByCtx(ctx, "key:tracing", currentWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := limitCounter.GetCtx(ctx, "key:tracing", currentWindow, previousWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fallback bool
+		err      bool
+	}{
+		{name: "httprate-redis.increment"},
+		{name: "httprate-redis.get"},
+		{name: "httprate-redis.increment", fallback: true, err: true}, // Redis error served by the fallback.
+		{name: "httprate-redis.get", fallback: true},                  // Fallback activated, Redis not called.
+	}
+
+	spans := tracer.finished()
+	if len(spans) != len(tests) {
+		t.Fatalf("unexpected number of spans %v, expected %v", len(spans), len(tests))
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.name != tt.name {
+			t.Errorf("span %d: unexpected name %q, expected %q", i, span.name, tt.name)
+		}
+		expected := map[string]any{
+			"httprate_redis.key_prefix":    "tracing",
+			"httprate_redis.window":        currentWindow.Unix(),
+			"httprate_redis.window_length": "1m0s",
+			"httprate_redis.fallback":      tt.fallback,
+		}
+		for key, value := range expected {
+			if span.attrs[key] != value {
+				t.Errorf("span %d: unexpected attribute %s = %v, expected %v", i, key, span.attrs[key], value)
+			}
+		}
+		if hasErr := len(span.errs) > 0; hasErr != tt.err {
+			t.Errorf("span %d: unexpected recorded errors %v", i, span.errs)
+		}
+	}
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, spanName string, attrs ...httprateredis.Attribute) (context.Context, httprateredis.Span) {
+	span := &testSpan{tracer: t, name: spanName, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	return ctx, span
+}
+
+func (t *testTracer) finished() []*testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spans
+}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+	attrs  map[string]any
+	errs   []error
+}
+
+func (s *testSpan) SetAttributes(attrs ...httprateredis.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *testSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
@@ -0,0 +1,101 @@
+package httprateredis_test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestUnixSocket(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+
+	// miniredis only listens on TCP, so proxy a unix socket to it.
+	socketPath := filepath.Join(t.TempDir(), "redis.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			backend, err := net.Dial("tcp", redis.Addr())
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go func() { io.Copy(backend, conn); backend.Close() }()
+			go func() { io.Copy(conn, backend); conn.Close() }()
+		}
+	}()
+
+	limitCounter, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Network:          "unix",
+		SocketPath:       socketPath,
+		FallbackTimeout:  time.Second,
+		FallbackDisabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter.Close()
+
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:unix", currentWindow, 7); err != nil {
+		t.Fatal(err)
+	}
+	curr, _, err := limitCounter.Get("key:unix", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 7 {
+		t.Errorf("unexpected curr = %v, expected 7", curr)
+	}
+
+	limitCounter2, err := httprateredis.NewCounterFromURL("unix://"+socketPath, &httprateredis.Config{FallbackDisabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limitCounter2.Close()
+
+	limitCounter2.Config(1000, time.Minute)
+	curr, _, err = limitCounter2.Get("key:unix", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 7 {
+		t.Errorf("unexpected curr = %v, expected 7", curr)
+	}
+}
+
+func TestUnixSocketValidation(t *testing.T) {
+	_, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Network: "unix",
+	})
+	if err == nil {
+		t.Error("expected error for unix network without socket path")
+	}
+
+	_, err = httprateredis.NewRedisLimitCounter(&httprateredis.Config{
+		Network: "udp",
+	})
+	if err == nil {
+		t.Error("expected error for unsupported network")
+	}
+}
@@ -0,0 +1,331 @@
+package httprateredis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Store = (*upstashCounter)(nil)
+
+// NewCounterWithUpstash returns a counter backed by the Upstash Redis REST API
+// instead of a Redis connection, e.g. on platforms without outbound TCP. The url
+// and token default to the UPSTASH_REDIS_REST_URL and UPSTASH_REDIS_REST_TOKEN
+// environment variables.
+//
+// The counters are the same sliding window keys as of NewCounter, incremented by
+// INCRBY in a single transaction with PEXPIRE NX via the multi-exec endpoint, so
+// the TTL is set once per counter like by NewCounter. Only PrefixKey, KeyTTL,
+// the timeouts, the fallback (FallbackMaxKeys included) and breaker options,
+// OnError, OnErrorAllow, the loggers and Tracer of cfg are used, the
+// connection options and the other modes are not supported. HTTP errors are
+// handled as Redis errors, i.e. served by the local in-memory fallback.
+func NewCounterWithUpstash(url, token string, cfg *Config) *upstashCounter {
+	if url == "" {
+		url = os.Getenv("UPSTASH_REDIS_REST_URL")
+	}
+	if token == "" {
+		token = os.Getenv("UPSTASH_REDIS_REST_TOKEN")
+	}
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	c.setBackendDefaults()
+
+	uc := &upstashCounter{
+		url:             strings.TrimSuffix(url, "/"),
+		token:           token,
+		httpClient:      &http.Client{Timeout: c.FallbackTimeout},
+		prefixKey:       c.PrefixKey,
+		keyTTL:          c.KeyTTL,
+		now:             time.Now,
+		done:            make(chan struct{}),
+		fallbackOptions: newFallbackOptions(&c, !c.FallbackDisabled),
+	}
+	if c.now != nil {
+		uc.now = c.now
+	}
+	uc.initFallback(&uc.fallbackOptions, "Upstash", uc.done, func() error {
+		return uc.Ping(context.Background())
+	})
+	if !c.FallbackDisabled {
+		uc.fallbackCounter = newFallbackCounter(c.FallbackMaxKeys, c.WindowLength)
+	}
+	return uc
+}
+
+type upstashCounter struct {
+	url         string
+	token       string
+	httpClient  *http.Client
+	limitConfig atomic.Pointer[limitConfig]
+	prefixKey   string
+	keyTTL      time.Duration
+	now         func() time.Time
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	fallbackOptions
+	fallback
+}
+
+func (c *upstashCounter) Config(requestLimit int, windowLength time.Duration) {
+	c.limitConfig.Store(&limitConfig{requestLimit: requestLimit, windowLength: windowLength})
+	c.configFallback(requestLimit, windowLength)
+}
+
+func (c *upstashCounter) Increment(key string, currentWindow time.Time) error {
+	return c.IncrementBy(key, currentWindow, 1)
+}
+
+func (c *upstashCounter) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	return c.IncrementByCtx(context.Background(), key, currentWindow, amount)
+}
+
+// IncrementByCtx is like IncrementBy, but the REST call is bound to ctx.
+func (c *upstashCounter) IncrementByCtx(ctx context.Context, key string, currentWindow time.Time, amount int) (err error) {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	var fallback bool
+	ctx, span := startSpan(ctx, c.tracer, spanIncrement, c.prefixKey, currentWindow, c.limitConfig.Load())
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.fallbackIncrementBy(key, currentWindow, amount)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				err = c.fallbackIncrementBy(key, currentWindow, amount)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				err = nil
+			}
+		}()
+	}
+
+	cfg := c.limitConfig.Load()
+	if cfg == nil {
+		return errNotConfigured
+	}
+	hkey := c.limitCounterKey(key, currentWindow)
+	ttl := 3 * cfg.windowLength
+	if c.keyTTL != 0 {
+		ttl = max(c.keyTTL, 2*cfg.windowLength)
+	}
+
+	var results []upstashResult
+	err = c.do(ctx, "/multi-exec", [][]any{
+		{"INCRBY", hkey, amount},
+		{"PEXPIRE", hkey, ttl.Milliseconds(), "NX"},
+	}, &results)
+	if err == nil {
+		for _, result := range results {
+			if result.Error != "" {
+				err = upstashError(result.Error)
+				break
+			}
+		}
+	}
+	if err != nil {
+		return c.commandError(ctx, "upstash incr failed", err)
+	}
+	return nil
+}
+
+func (c *upstashCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return c.GetCtx(context.Background(), key, currentWindow, previousWindow)
+}
+
+// GetCtx is like Get, but the REST call is bound to ctx.
+func (c *upstashCounter) GetCtx(ctx context.Context, key string, currentWindow, previousWindow time.Time) (curr int, prev int, err error) {
+	if c.isClosed() {
+		return 0, 0, ErrClosed
+	}
+
+	var fallback bool
+	ctx, span := startSpan(ctx, c.tracer, spanGet, c.prefixKey, currentWindow, c.limitConfig.Load())
+	defer func() { endSpan(span, fallback, err) }()
+
+	if c.fallbackCounter != nil {
+		if c.breaker.isOpen() {
+			fallback = true
+			return c.fallbackGet(key, currentWindow, previousWindow)
+		}
+		defer func() {
+			if c.shouldFallback(ctx, err) {
+				fallback = true
+				recordError(span, err)
+				curr, prev, err = c.fallbackGet(key, currentWindow, previousWindow)
+			}
+		}()
+	} else if c.onErrorAllow {
+		defer func() {
+			if err != nil {
+				c.onError(err)
+				curr, prev, err = 0, 0, nil
+			}
+		}()
+	}
+
+	var result upstashResult
+	err = c.do(ctx, "", []any{"MGET", c.limitCounterKey(key, currentWindow), c.limitCounterKey(key, previousWindow)}, &result)
+	if err == nil && result.Error != "" {
+		err = upstashError(result.Error)
+	}
+	if err != nil {
+		return 0, 0, c.commandError(ctx, "upstash mget failed", err)
+	}
+
+	values, _ := result.Result.([]any)
+	if len(values) != 2 {
+		return 0, 0, fmt.Errorf("httprateredis: upstash mget returned wrong number of keys: %v, expected 2", len(values))
+	}
+	return parseCount(values[0]), parseCount(values[1]), nil
+}
+
+// Reset deletes the current and previous window counters of the given
+// rate-limit key, like Reset of the Redis counter.
+func (c *upstashCounter) Reset(ctx context.Context, key string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	cfg := c.limitConfig.Load()
+	if cfg == nil || cfg.windowLength <= 0 {
+		return errNotConfigured
+	}
+	currentWindow := c.now().UTC().Truncate(cfg.windowLength)
+	previousWindow := currentWindow.Add(-cfg.windowLength)
+
+	var result upstashResult
+	err := c.do(ctx, "", []any{"DEL", c.limitCounterKey(key, currentWindow), c.limitCounterKey(key, previousWindow)}, &result)
+	if err == nil && result.Error != "" {
+		err = upstashError(result.Error)
+	}
+	if err != nil {
+		return wrapCommandError(ctx, c.isClosed(), "upstash del failed", err)
+	}
+	return nil
+}
+
+// Ping checks the REST endpoint and the credentials by a PING.
+func (c *upstashCounter) Ping(ctx context.Context) error {
+	var result upstashResult
+	err := c.do(ctx, "", []any{"PING"}, &result)
+	if err == nil && result.Error != "" {
+		err = upstashError(result.Error)
+	}
+	return err
+}
+
+// IsFallbackActivated reports whether the local in-memory fallback is serving
+// the requests, i.e. the REST API is failing.
+func (c *upstashCounter) IsFallbackActivated() bool {
+	return c.breaker.isOpen()
+}
+
+// Close stops the fallback probes. There are no connections to close, the HTTP
+// connections are reused by the default transport.
+func (c *upstashCounter) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.httpClient.CloseIdleConnections()
+	})
+	return nil
+}
+
+func (c *upstashCounter) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// commandError wraps and logs the error of a failed IncrementBy or Get call,
+// like of the Redis counter.
+func (c *upstashCounter) commandError(ctx context.Context, msg string, err error) error {
+	err = wrapCommandError(ctx, c.isClosed(), msg, err)
+	c.logger.Errorf("%v", err)
+	return err
+}
+
+// upstashError is an error reply of a command, handled like the error replies
+// of Redis, e.g. OOM by ErrRedisOutOfMemory.
+type upstashError string
+
+func (e upstashError) Error() string { return string(e) }
+
+func (upstashError) RedisError() {}
+
+// upstashResult is the JSON response of a single command.
+type upstashResult struct {
+	Result any    `json:"result"`
+	Error  string `json:"error"`
+}
+
+// do posts the command (or the commands to the multi-exec endpoint) as a JSON
+// array, and decodes the JSON response into v.
+func (c *upstashCounter) do(ctx context.Context, path string, command any, v any) error {
+	body, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRedisUnavailable, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRedisUnavailable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var result upstashResult
+		msg := strings.TrimSpace(string(respBody))
+		if json.Unmarshal(respBody, &result) == nil && result.Error != "" {
+			msg = result.Error
+		}
+		err := fmt.Errorf("http %d: %s", resp.StatusCode, msg)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %w", ErrRedisUnavailable, err)
+		}
+		return err
+	}
+	return json.Unmarshal(respBody, v)
+}
+
+func (c *upstashCounter) limitCounterKey(key string, window time.Time) string {
+	return c.prefixKey + ":" + strconv.FormatUint(limitCounterHash(key, window), 10)
+}
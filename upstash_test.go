@@ -0,0 +1,245 @@
+package httprateredis_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestUpstash(t *testing.T) {
+	upstash := newFakeUpstash(t, "token")
+
+	limitCounter := httprateredis.NewCounterWithUpstash(upstash.URL, "token", &httprateredis.Config{
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:upstash", previousWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := limitCounter.IncrementBy("key:upstash", currentWindow, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	curr, prev, err := limitCounter.Get("key:upstash", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 3 || prev != 2 {
+		t.Errorf("unexpected curr = %v, prev = %v, expected 3, 2", curr, prev)
+	}
+
+	// The TTL is set by the first increment only.
+	key := upstash.redis.Keys()[0]
+	ttl := upstash.redis.TTL(key)
+	if ttl != 3*time.Minute {
+		t.Errorf("unexpected TTL %v, expected %v", ttl, 3*time.Minute)
+	}
+	upstash.redis.FastForward(time.Second)
+	if err := limitCounter.IncrementBy("key:upstash", previousWindow, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := upstash.redis.TTL(key); ttl != 3*time.Minute-time.Second {
+		t.Errorf("unexpected TTL %v after an increment, expected it not to be refreshed", ttl)
+	}
+
+	// Reset deletes both windows of the key.
+	if err := limitCounter.Reset(context.Background(), "key:upstash"); err != nil {
+		t.Fatal(err)
+	}
+	if curr, prev, err := limitCounter.Get("key:upstash", currentWindow, previousWindow); err != nil || curr != 0 || prev != 0 {
+		t.Errorf("unexpected curr = %v, prev = %v, err %v after Reset, expected 0, 0", curr, prev, err)
+	}
+
+	// Invalid token.
+	limitCounter = httprateredis.NewCounterWithUpstash(upstash.URL, "invalid", &httprateredis.Config{
+		FallbackDisabled: true,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+	if err := limitCounter.IncrementBy("key:upstash", currentWindow, 1); !errors.Is(err, httprateredis.ErrAuthFailed) {
+		t.Errorf("unexpected error %v, expected ErrAuthFailed", err)
+	}
+}
+
+func TestUpstashOnErrorAllow(t *testing.T) {
+	upstash := newFakeUpstash(t, "token")
+	upstash.failing.Store(true)
+
+	var errs atomic.Int64
+	limitCounter := httprateredis.NewCounterWithUpstash(upstash.URL, "token", &httprateredis.Config{
+		FallbackDisabled: true,
+		OnErrorAllow:     true,
+		OnError:          func(err error) { errs.Add(1) },
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	if err := limitCounter.IncrementBy("key:allow", currentWindow, 1); err != nil {
+		t.Errorf("unexpected error %v, expected the request to be allowed", err)
+	}
+	if curr, prev, err := limitCounter.Get("key:allow", currentWindow, currentWindow.Add(-time.Minute)); err != nil || curr != 0 || prev != 0 {
+		t.Errorf("unexpected curr = %v, prev = %v, err %v, expected 0, 0", curr, prev, err)
+	}
+	if errs.Load() != 2 {
+		t.Errorf("unexpected %v OnError calls, expected 2", errs.Load())
+	}
+}
+
+func TestUpstashFallback(t *testing.T) {
+	upstash := newFakeUpstash(t, "token")
+	upstash.failing.Store(true)
+
+	limitCounter := httprateredis.NewCounterWithUpstash(upstash.URL, "token", &httprateredis.Config{
+		CooldownPeriod: 10 * time.Millisecond,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	if err := limitCounter.IncrementBy("key:fallback", currentWindow, 5); err != nil {
+		t.Fatalf("expected the local fallback on HTTP errors, got %v", err)
+	}
+	if !limitCounter.IsFallbackActivated() {
+		t.Fatal("expected fallback to be activated")
+	}
+	curr, _, err := limitCounter.Get("key:fallback", currentWindow, previousWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr != 5 {
+		t.Errorf("unexpected curr = %v, expected 5 from the local fallback", curr)
+	}
+
+	upstash.failing.Store(false)
+	deadline := time.Now().Add(time.Second)
+	for limitCounter.IsFallbackActivated() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if limitCounter.IsFallbackActivated() {
+		t.Error("expected fallback to be deactivated once Upstash is healthy")
+	}
+}
+
+func TestUpstashFallbackMaxKeys(t *testing.T) {
+	upstash := newFakeUpstash(t, "token")
+	upstash.failing.Store(true)
+
+	limitCounter := httprateredis.NewCounterWithUpstash(upstash.URL, "token", &httprateredis.Config{
+		FallbackMaxKeys: 1,
+		CooldownPeriod:  time.Hour,
+	})
+	defer limitCounter.Close()
+	limitCounter.Config(1000, time.Minute)
+
+	currentWindow := time.Now().UTC().Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	// The second key evicts the first one from the bounded fallback.
+	for _, key := range []string{"key:first", "key:second"} {
+		if err := limitCounter.IncrementBy(key, currentWindow, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if curr, _, _ := limitCounter.Get("key:first", currentWindow, previousWindow); curr != 0 {
+		t.Errorf("unexpected curr = %v of the evicted key, expected 0", curr)
+	}
+	if curr, _, _ := limitCounter.Get("key:second", currentWindow, previousWindow); curr != 5 {
+		t.Errorf("unexpected curr = %v, expected 5 from the local fallback", curr)
+	}
+}
+
+// fakeUpstash is a minimal Upstash Redis REST API, running the commands on a
+// miniredis.
+type fakeUpstash struct {
+	*httptest.Server
+	redis   *miniredis.Miniredis
+	client  *redis.Client
+	failing atomic.Bool
+}
+
+func newFakeUpstash(t *testing.T, token string) *fakeUpstash {
+	f := &fakeUpstash{redis: miniredis.RunT(t)}
+	f.client = redis.NewClient(&redis.Options{Addr: f.redis.Addr()})
+	t.Cleanup(func() { f.client.Close() })
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{"error": "service unavailable"})
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"error": "Unauthorized"})
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			var command []any
+			if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(f.run(r.Context(), command))
+		case "/multi-exec":
+			var commands [][]any
+			if err := json.NewDecoder(r.Body).Decode(&commands); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			results := make([]map[string]any, len(commands))
+			for i, command := range commands {
+				results[i] = f.run(r.Context(), command)
+			}
+			json.NewEncoder(w).Encode(results)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeUpstash) run(ctx context.Context, command []any) map[string]any {
+	// JSON numbers are decoded as float64, Redis expects integers.
+	for i, arg := range command {
+		if n, ok := arg.(float64); ok {
+			command[i] = int64(n)
+		}
+	}
+	result, err := f.client.Do(ctx, command...).Result()
+	if errors.Is(err, redis.Nil) {
+		return map[string]any{"result": nil}
+	}
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"result": result}
+}
+
+// ttls returns the TTLs of the keys of the fake, for storetest.
+func (f *fakeUpstash) ttls() map[string]time.Duration {
+	ttls := map[string]time.Duration{}
+	for _, key := range f.redis.Keys() {
+		ttls[key] = f.redis.TTL(key)
+	}
+	return ttls
+}
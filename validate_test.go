@@ -0,0 +1,120 @@
+package httprateredis_test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	httprateredis "github.com/go-chi/httprate-redis"
+)
+
+func TestNewCounterWithError(t *testing.T) {
+	redis, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.Close()
+	redisPort, _ := strconv.Atoi(redis.Port())
+
+	tests := []struct {
+		name string
+		cfg  httprateredis.Config
+		err  error
+	}{
+		{name: "valid", cfg: httprateredis.Config{Host: redis.Host(), Port: uint16(redisPort), ConnectEagerly: true}},
+		{name: "valid strict", cfg: httprateredis.Config{Host: redis.Host(), Port: uint16(redisPort), PrefixKey: "api", Strict: true}},
+		{name: "negative db_index", cfg: httprateredis.Config{DBIndex: -1}, err: httprateredis.ErrInvalidConfig},
+		{name: "negative max_idle", cfg: httprateredis.Config{MaxIdle: -1}, err: httprateredis.ErrInvalidConfig},
+		{name: "negative max_active", cfg: httprateredis.Config{MaxActive: -1}, err: httprateredis.ErrInvalidConfig},
+		{name: "empty prefix_key in strict mode", cfg: httprateredis.Config{Strict: true}, err: httprateredis.ErrInvalidConfig},
+		{name: "negative shard_virtual_nodes", cfg: httprateredis.Config{ShardVirtualNodes: -1}, err: httprateredis.ErrInvalidConfig},
+		{name: "negative command_timeout", cfg: httprateredis.Config{CommandTimeout: -time.Second}, err: httprateredis.ErrInvalidConfig},
+		{name: "negative max_conn_lifetime", cfg: httprateredis.Config{MaxConnLifetime: -time.Second}, err: httprateredis.ErrInvalidConfig},
+		{name: "PasswordFunc with shard_addrs", cfg: httprateredis.Config{ShardAddrs: []string{"127.0.0.1:6379"}, PasswordFunc: func() (string, error) { return "", nil }}, err: httprateredis.ErrInvalidConfig},
+		{name: "warn_threshold above 1", cfg: httprateredis.Config{WarnThreshold: 1.5}, err: httprateredis.ErrInvalidConfig},
+		{name: "unsupported network", cfg: httprateredis.Config{Network: "udp"}, err: httprateredis.ErrInvalidConfig},
+		{name: "unix network without socket_path", cfg: httprateredis.Config{Network: "unix"}, err: httprateredis.ErrInvalidConfig},
+		{name: "unreachable host", cfg: httprateredis.Config{Host: "127.0.0.1", Port: 1, ConnectEagerly: true}, err: httprateredis.ErrRedisUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limitCounter, err := httprateredis.NewCounterWithError(&tt.cfg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error %v, expected %v", err, tt.err)
+			}
+			if err == nil {
+				limitCounter.Close()
+			}
+		})
+	}
+
+	// Without ConnectEagerly, Redis isn't contacted.
+	limitCounter, err := httprateredis.NewCounterWithError(&httprateredis.Config{Host: "127.0.0.1", Port: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limitCounter.Close()
+}
+
+func TestLazyConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var conns atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			defer conn.Close()
+		}
+	}()
+	_, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	// Neither an unreachable host nor a reachable one is contacted.
+	for _, cfg := range []*httprateredis.Config{
+		{Host: "192.0.2.1", Port: 6379, DialTimeout: 5 * time.Second},
+		{Host: "127.0.0.1", Port: uint16(port)},
+	} {
+		start := time.Now()
+		limitCounter := httprateredis.NewCounter(cfg)
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%s: NewCounter() returned after %v, expected to return immediately", cfg.Host, elapsed)
+		}
+		defer limitCounter.Close()
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := conns.Load(); n != 0 {
+		t.Errorf("unexpected %v connections, expected none before the first command", n)
+	}
+
+	// With ConnectEagerly, NewCounter logs the ping error.
+	logger := &testLogger{}
+	limitCounter := httprateredis.NewCounter(&httprateredis.Config{Host: "127.0.0.1", Port: 1, ConnectEagerly: true, Logger: logger})
+	defer limitCounter.Close()
+	if lines := logger.get(); len(lines) != 1 || !strings.HasPrefix(lines[0], "ERROR httprateredis: connect eagerly") {
+		t.Errorf("unexpected log output %q, expected the ping error", lines)
+	}
+
+	// NewCounter logs the PasswordFunc it doesn't support.
+	logger = &testLogger{}
+	limitCounter = httprateredis.NewCounter(&httprateredis.Config{
+		ShardAddrs:   []string{"127.0.0.1:6379"},
+		PasswordFunc: func() (string, error) { return "", nil },
+		Logger:       logger,
+	})
+	defer limitCounter.Close()
+	if lines := logger.get(); len(lines) != 1 || !strings.HasPrefix(lines[0], "ERROR httprateredis: PasswordFunc is not supported") {
+		t.Errorf("unexpected log output %q, expected the PasswordFunc error", lines)
+	}
+}